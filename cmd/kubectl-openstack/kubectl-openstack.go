@@ -1,19 +1,28 @@
 package main
 
 import (
+	goflag "flag"
 	"github.com/spf13/pflag"
 	"os"
 
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/cmd"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	// load the auth provider plugins (azure, gcp, oidc, openstack) like kubectl does
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/klog"
 )
 
 func main() {
 	flags := pflag.NewFlagSet("kubectl-openstack", pflag.ExitOnError)
 	pflag.CommandLine = flags
 
+	// only the verbosity of the klog flags is exposed, e.g. -v=1 logs the duration of the OpenStack requests
+	klogFlags := goflag.NewFlagSet("klog", goflag.ExitOnError)
+	klog.InitFlags(klogFlags)
+	flags.AddGoFlag(klogFlags.Lookup("v"))
+
 	root := cmd.NewCmdOpenStack(genericclioptions.IOStreams{In: os.Stdin, Out: os.Stdout, ErrOut: os.Stderr})
 	if err := root.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -14,7 +14,9 @@ require (
 	k8s.io/apimachinery v0.0.0-20191005115455-e71eb83a557c
 	k8s.io/cli-runtime v0.0.0-20191005121332-4d28aef60981
 	k8s.io/client-go v0.0.0-20191005115821-b1fd78950135
+	k8s.io/klog v1.0.0
 	k8s.io/utils v0.0.0-20190923111123-69764acb6e8e // indirect
+	sigs.k8s.io/yaml v1.1.0
 )
 
 go 1.13
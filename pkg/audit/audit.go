@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is a request which changed a volume, it is written as one json line to the audit file
+type Entry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Context string    `json:"context"`
+	Cloud   string    `json:"cloud"`
+	// Action is the change, e.g. attach-nova or force-detach-cinder
+	Action   string `json:"action"`
+	VolumeID string `json:"volumeID"`
+	ServerID string `json:"serverID,omitempty"`
+	// Method and URL of the request
+	Method string          `json:"method,omitempty"`
+	URL    string          `json:"url,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	// ResponseCode is 0 if no response has been received
+	ResponseCode int    `json:"responseCode"`
+	ResponseBody string `json:"responseBody,omitempty"`
+	Error        string `json:"error,omitempty"`
+	// StatusBefore is the Cinder status of the volume before the request. StatusAfterRequest is
+	// read right after the response, the requests are asynchronous so it's usually a transitional
+	// status like attaching or detaching and not the result of the request.
+	StatusBefore       string `json:"statusBefore,omitempty"`
+	StatusAfterRequest string `json:"statusAfterRequest,omitempty"`
+	// Kubernetes is set instead of the request if a Kubernetes object has been changed for the volume
+	Kubernetes *KubernetesChange `json:"kubernetes,omitempty"`
+}
+
+// KubernetesChange is a change of a Kubernetes object, e.g. a StatefulSet which is scaled down
+// while its volume is fixed
+type KubernetesChange struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Field is the changed field with its value before and after the change, it's empty if the
+	// object has been deleted, e.g. an evicted pod
+	Field  string `json:"field,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// Log appends entries to File. A nil Log doesn't record anything.
+type Log struct {
+	File    string
+	User    string
+	Context string
+	Cloud   string
+	// Forward is called with every entry after it has been written, e.g. to send it to exporters.
+	// Its errors are printed to ErrOut, they don't fail the change which is recorded.
+	Forward func(e Entry) error
+	ErrOut  io.Writer
+
+	lock sync.Mutex
+}
+
+// DefaultFile returns the audit file set via KUBECTL_OS_AUDIT_FILE or
+// ~/.kube/kubectl-openstack-audit.jsonl
+func DefaultFile() string {
+	if file := os.Getenv("KUBECTL_OS_AUDIT_FILE"); file != "" {
+		return file
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "kubectl-openstack-audit.jsonl")
+}
+
+// CurrentUser returns the name of the user running the plugin
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Record sets the user, context and cloud of the entry, appends it to the file and forwards it.
+// Only an error writing the file is returned, the entry is in the file even if forwarding fails.
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	e.User = l.User
+	e.Context = l.Context
+	e.Cloud = l.Cloud
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error marshalling audit entry: %v", err)
+	}
+	if err := l.append(append(line, '\n')); err != nil {
+		return err
+	}
+	if l.Forward != nil {
+		if err := l.Forward(e); err != nil && l.ErrOut != nil {
+			fmt.Fprintf(l.ErrOut, "Error forwarding audit entry %s of volume %s: %v\n", e.Action, e.VolumeID, err)
+		}
+	}
+	return nil
+}
+
+// append writes the line at the end of the file, the file is only ever appended to
+func (l *Log) append(line []byte) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.File), 0700); err != nil {
+		return fmt.Errorf("error creating audit dir: %v", err)
+	}
+	f, err := os.OpenFile(l.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit file %s: %v", l.File, err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing audit file %s: %v", l.File, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing audit file %s: %v", l.File, err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var forwarded []Entry
+	l := &Log{
+		File:    filepath.Join(dir, "audit", "audit.jsonl"),
+		User:    "admin",
+		Context: "prod",
+		Cloud:   "cloud",
+		Forward: func(e Entry) error {
+			forwarded = append(forwarded, e)
+			return nil
+		},
+	}
+	for _, action := range []string{"detach-nova", "attach-nova"} {
+		if err := l.Record(Entry{Action: action, VolumeID: "v1", ServerID: "s1", ResponseCode: 202}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(l.File)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 || entries[0].Action != "detach-nova" || entries[1].Action != "attach-nova" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if e := entries[1]; e.User != "admin" || e.Context != "prod" || e.Cloud != "cloud" || e.Time.IsZero() {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	if len(forwarded) != 2 {
+		t.Errorf("expected 2 forwarded entries, got %d", len(forwarded))
+	}
+
+	// forwarding errors are printed but don't fail the recording
+	errOut := &bytes.Buffer{}
+	l.ErrOut = errOut
+	l.Forward = func(e Entry) error {
+		return fmt.Errorf("webhook unreachable")
+	}
+	if err := l.Record(Entry{Action: "detach-nova", VolumeID: "v1"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !bytes.Contains(errOut.Bytes(), []byte("webhook unreachable")) {
+		t.Errorf("expected forwarding error to be printed, got %q", errOut.String())
+	}
+
+	var nilLog *Log
+	if err := nilLog.Record(Entry{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
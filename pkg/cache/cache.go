@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// DefaultDir returns the cache directory, it is set via KUBECTL_OS_CACHE_DIR and defaults to ~/.kube/cache/openstack
+func DefaultDir() string {
+	if dir := os.Getenv("KUBECTL_OS_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "cache", "openstack")
+}
+
+// Cache caches the responses of GET requests on disk. The responses are stored per scope,
+// e.g. per cloud or kube context, below Dir. A nil Cache doesn't cache anything.
+type Cache struct {
+	// Dir is the directory the responses are stored in
+	Dir string
+	// TTL is the duration cached responses are served for
+	TTL time.Duration
+	// Refresh disables reading from the cache, fresh responses are still stored
+	Refresh bool
+}
+
+// entry is a cached response
+type entry struct {
+	URL      string    `json:"url"`
+	Time     time.Time `json:"time"`
+	Response []byte    `json:"response"`
+}
+
+// Transport returns a RoundTripper which serves GET requests of the scope from the cache
+func (c *Cache) Transport(rt http.RoundTripper, scope ...string) http.RoundTripper {
+	if c == nil {
+		return rt
+	}
+	return &transport{cache: c, dir: c.path(scope...), rt: rt}
+}
+
+// WrapTransport returns a wrapper for rest.Config.WrapTransport which caches the responses of the scope
+func (c *Cache) WrapTransport(scope ...string) func(rt http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return nil
+	}
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return c.Transport(rt, scope...)
+	}
+}
+
+// Clear removes all cached responses of the scope, e.g. after modifying resources
+func (c *Cache) Clear(scope ...string) error {
+	if c == nil || c.Dir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(c.path(scope...)); err != nil {
+		return fmt.Errorf("error clearing cache %s: %v", c.path(scope...), err)
+	}
+	return nil
+}
+
+// Load reads the file of the scope into obj, false is returned if the file doesn't exist
+// or Refresh is set. Expiry has to be checked by the caller.
+func (c *Cache) Load(obj interface{}, name string, scope ...string) (bool, error) {
+	if c == nil || c.Refresh {
+		return false, nil
+	}
+	file := filepath.Join(c.path(scope...), name)
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading cache file %s: %v", file, err)
+	}
+	if err := json.Unmarshal(content, obj); err != nil {
+		return false, fmt.Errorf("error parsing cache file %s: %v", file, err)
+	}
+	return true, nil
+}
+
+// Store writes obj to the file of the scope, the file is only readable by the current user
+func (c *Cache) Store(obj interface{}, name string, scope ...string) error {
+	if c == nil {
+		return nil
+	}
+	content, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("error marshalling cache file %s: %v", name, err)
+	}
+	return writeFile(filepath.Join(c.path(scope...), name), content)
+}
+
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// path returns the directory of the scope. Unsafe characters are replaced and a hash of the
+// original name is appended, so e.g. the contexts admin@prod and admin_prod don't share a directory.
+func (c *Cache) path(scope ...string) string {
+	elems := []string{c.Dir}
+	for _, s := range scope {
+		name := unsafeChars.ReplaceAllString(s, "_")
+		if name != s {
+			hash := sha256.Sum256([]byte(s))
+			name = fmt.Sprintf("%s-%x", name, hash[:4])
+		}
+		elems = append(elems, name)
+	}
+	return filepath.Join(elems...)
+}
+
+type transport struct {
+	cache *Cache
+	dir   string
+	rt    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.rt.RoundTrip(req)
+	}
+
+	file := filepath.Join(t.dir, fileName(req))
+	if resp, ok := t.load(file, req); ok {
+		klog.V(2).Infof("Using cached response for %s", req.URL)
+		return resp, nil
+	}
+
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response of %s: %v", req.URL, err)
+	}
+	content, err := json.Marshal(entry{URL: req.URL.String(), Time: time.Now(), Response: dump})
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling response of %s: %v", req.URL, err)
+	}
+	if err := writeFile(file, content); err != nil {
+		// the response is still valid, the next invocation just can't use the cache
+		klog.Warningf("Error caching response of %s: %v", req.URL, err)
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(dump)), req)
+}
+
+func (t *transport) load(file string, req *http.Request) (*http.Response, bool) {
+	if t.cache.Refresh {
+		return nil, false
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+	var e entry
+	if err := json.Unmarshal(content, &e); err != nil || e.URL != req.URL.String() || time.Since(e.Time) > t.cache.TTL {
+		return nil, false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(e.Response)), req)
+	if err != nil {
+		return nil, false
+	}
+	return resp, true
+}
+
+// fileName is the readable path of the request with a hash of the url and the accepted content
+// types, so e.g. json and protobuf responses of the Kubernetes API are cached separately
+func fileName(req *http.Request) string {
+	name := unsafeChars.ReplaceAllString(req.URL.Path, "_")
+	if len(name) > 100 {
+		name = name[len(name)-100:]
+	}
+	hash := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept")))
+	return fmt.Sprintf("%s-%x.json", name, hash[:8])
+}
+
+func writeFile(file string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("error creating cache dir %s: %v", filepath.Dir(file), err)
+	}
+	// write to a temporary file first, so concurrent invocations never read partial files
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error creating cache file %s: %v", file, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing cache file %s: %v", file, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing cache file %s: %v", file, err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("error writing cache file %s: %v", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransport(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"path": %q, "request": %d}`, r.URL.Path, requests)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	get := func(c *Cache, method, path string) string {
+		client := &http.Client{Transport: c.Transport(http.DefaultTransport, "clouds", "cloud-a")}
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %q", resp.Header.Get("Content-Type"))
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return string(body)
+	}
+
+	c := &Cache{Dir: dir, TTL: time.Minute}
+	tests := []struct {
+		name   string
+		cache  *Cache
+		method string
+		path   string
+		want   string
+	}{
+		{name: "first request", cache: c, method: http.MethodGet, path: "/volumes", want: `{"path": "/volumes", "request": 1}`},
+		{name: "cached", cache: c, method: http.MethodGet, path: "/volumes", want: `{"path": "/volumes", "request": 1}`},
+		{name: "other path", cache: c, method: http.MethodGet, path: "/servers", want: `{"path": "/servers", "request": 2}`},
+		{name: "post is not cached", cache: c, method: http.MethodPost, path: "/volumes", want: `{"path": "/volumes", "request": 3}`},
+		{name: "refresh", cache: &Cache{Dir: dir, TTL: time.Minute, Refresh: true}, method: http.MethodGet, path: "/volumes", want: `{"path": "/volumes", "request": 4}`},
+		{name: "refreshed", cache: c, method: http.MethodGet, path: "/volumes", want: `{"path": "/volumes", "request": 4}`},
+		{name: "expired", cache: &Cache{Dir: dir, TTL: time.Nanosecond}, method: http.MethodGet, path: "/volumes", want: `{"path": "/volumes", "request": 5}`},
+		{name: "nil cache", cache: nil, method: http.MethodGet, path: "/volumes", want: `{"path": "/volumes", "request": 6}`},
+	}
+	for _, tt := range tests {
+		if got := get(tt.cache, tt.method, tt.path); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if err := c.Clear("clouds", "cloud-a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := get(c, http.MethodGet, "/volumes"); !strings.Contains(got, `"request": 7`) {
+		t.Errorf("expected request after clearing the cache, got %s", got)
+	}
+}
+
+func TestLoadStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	c := &Cache{Dir: dir}
+
+	var got map[string]string
+	if found, err := c.Load(&got, "token.json", "clouds", "cloud/a"); err != nil || found {
+		t.Fatalf("expected no cached file, got %v, %v", found, err)
+	}
+	if err := c.Store(map[string]string{"id": "token"}, "token.json", "clouds", "cloud/a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info, err := os.Stat(c.path("clouds", "cloud/a") + "/token.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected file mode %v", info.Mode())
+	}
+	if found, err := c.Load(&got, "token.json", "clouds", "cloud/a"); err != nil || !found || got["id"] != "token" {
+		t.Errorf("unexpected cached file %v, %v, %v", got, found, err)
+	}
+
+	// contexts which only differ in unsafe characters don't share their cached files
+	if err := c.Store(map[string]string{"context": "admin@prod"}, "pods.json", "contexts", "admin@prod"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if found, err := c.Load(&got, "pods.json", "contexts", "admin_prod"); err != nil || found {
+		t.Errorf("expected no cached file for admin_prod, got %v, %v, %v", got, found, err)
+	}
+	if found, err := c.Load(&got, "pods.json", "contexts", "admin@prod"); err != nil || !found || got["context"] != "admin@prod" {
+		t.Errorf("unexpected cached file %v, %v, %v", got, found, err)
+	}
+}
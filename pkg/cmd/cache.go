@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/cache"
+	"github.com/spf13/pflag"
+)
+
+// CacheOptions are the options of commands which cache the responses of OpenStack and Kubernetes
+type CacheOptions struct {
+	cacheTTL time.Duration
+	noCache  bool
+}
+
+// AddFlags adds the cache flags to flags
+func (o *CacheOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.DurationVar(&o.cacheTTL, "cache-ttl", 0, "duration for which the responses of OpenStack and Kubernetes are cached on disk, e.g. 1m, by default nothing is cached")
+	flags.BoolVar(&o.noCache, "no-cache", false, "ignore cached responses and tokens, the fresh responses are cached for the next invocations")
+}
+
+// Validate ensures that the cache flags are valid
+func (o *CacheOptions) Validate() error {
+	if o.cacheTTL < 0 {
+		return fmt.Errorf("cache-ttl must not be negative, got %s", o.cacheTTL)
+	}
+	return nil
+}
+
+// cache returns the cache configured by the flags, it is nil if caching is disabled
+func (o *CacheOptions) cache() *cache.Cache {
+	dir := cache.DefaultDir()
+	if o.cacheTTL == 0 || dir == "" {
+		return nil
+	}
+	return &cache.Cache{Dir: dir, TTL: o.cacheTTL, Refresh: o.noCache}
+}
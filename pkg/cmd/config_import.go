@@ -88,6 +88,8 @@ func (o *ImportConfigOptions) Run() error {
 	projectIDRegEx := regexp.MustCompile("OS_PROJECT_ID=['\"](.*)['\"]")
 	authUrlRegEx := regexp.MustCompile("OS_AUTH_URL=['\"](.*)['\"]")
 	caCertRegEx := regexp.MustCompile("OS_CACERT=['\"](.*)['\"]")
+	regionNameRegEx := regexp.MustCompile("OS_REGION_NAME=['\"](.*)['\"]")
+	interfaceRegEx := regexp.MustCompile("OS_INTERFACE=['\"](.*)['\"]")
 
 	clouds := clouds{}
 	clouds.Clouds = map[string]cloud{}
@@ -110,6 +112,8 @@ func (o *ImportConfigOptions) Run() error {
 			projectIDMatch := projectIDRegEx.FindSubmatch(content)
 			authUrlMatch := authUrlRegEx.FindSubmatch(content)
 			caCertMatch := caCertRegEx.FindSubmatch(content)
+			regionNameMatch := regionNameRegEx.FindSubmatch(content)
+			interfaceMatch := interfaceRegEx.FindSubmatch(content)
 
 			if len(usernameMatch) != 2 {
 				return fmt.Errorf("error matching username regex")
@@ -143,12 +147,15 @@ func (o *ImportConfigOptions) Run() error {
 			newCloud := cloud{
 				Auth: auth,
 			}
-			if len(caCertMatch) != 2 {
-				newCloud.Verify = false
-			} else {
-				newCloud.Verify = true
+			if len(caCertMatch) == 2 {
 				newCloud.CaCert = string(caCertMatch[1])
 			}
+			if len(regionNameMatch) == 2 {
+				newCloud.RegionName = string(regionNameMatch[1])
+			}
+			if len(interfaceMatch) == 2 {
+				newCloud.Interface = string(interfaceMatch[1])
+			}
 			clouds.Clouds[string(context)] = newCloud
 		}
 	}
@@ -172,8 +179,11 @@ type clouds struct {
 }
 type cloud struct {
 	Auth   cloudAuth `yaml:"auth"`
-	Verify bool      `yaml:"verify"`
+	Verify *bool     `yaml:"verify,omitempty"`
 	CaCert string    `yaml:"cacert,omitempty"`
+
+	RegionName string `yaml:"region_name,omitempty"`
+	Interface  string `yaml:"interface,omitempty"`
 }
 
 type cloudAuth struct {
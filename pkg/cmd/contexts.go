@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/parallel"
+	"github.com/spf13/pflag"
+)
+
+// ContextOptions are the options of commands which can run for multiple contexts
+type ContextOptions struct {
+	parallelism int
+}
+
+// AddFlags adds the context flags to flags
+func (o *ContextOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.IntVar(&o.parallelism, "parallelism", 10, "maximum number of contexts which are processed concurrently")
+}
+
+// Validate ensures that the context flags are valid
+func (o *ContextOptions) Validate() error {
+	if o.parallelism < 1 {
+		return fmt.Errorf("parallelism must be at least 1, got %d", o.parallelism)
+	}
+	return nil
+}
+
+// contextResult is the result of running a command for one context
+type contextResult struct {
+	context  string
+	tenantID string
+	err      error
+	duration time.Duration
+}
+
+// runContexts calls fn for all contexts with at most parallelism concurrent calls. fn gets the index
+// of the context, so results can be stored without locking. The results are in the order of the contexts.
+func (o *ContextOptions) runContexts(contexts []string, fn func(i int, context string) (string, error)) []contextResult {
+	results := make([]contextResult, len(contexts))
+
+	var fns []func() error
+	for i, context := range contexts {
+		i, context := i, context
+		fns = append(fns, func() error {
+			start := time.Now()
+			tenantID, err := fn(i, context)
+			results[i] = contextResult{context: context, tenantID: tenantID, err: err, duration: time.Since(start)}
+			return nil
+		})
+	}
+	// errors are part of the results
+	_ = parallel.Run(o.parallelism, fns...)
+	return results
+}
+
+// succeeded returns the contexts and tenants of the successful results
+func succeeded(results []contextResult) ([]string, []string) {
+	var contexts, tenantIDs []string
+	for _, r := range results {
+		if r.err == nil {
+			contexts = append(contexts, r.context)
+			tenantIDs = append(tenantIDs, r.tenantID)
+		}
+	}
+	return contexts, tenantIDs
+}
+
+// failedContexts returns an error if any context failed. The exit code is the highest one of
+// the failed contexts.
+func failedContexts(results []contextResult) error {
+	var failed []error
+	code := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, r.err)
+			if c := contextExitCode(r.err); c > code {
+				code = c
+			}
+		}
+	}
+	switch {
+	case len(failed) == 0:
+		return nil
+	case len(results) == 1:
+		return &ExitError{Code: code, Err: failed[0]}
+	default:
+		return &ExitError{Code: code, Err: fmt.Errorf("%d of %d contexts failed", len(failed), len(results))}
+	}
+}
+
+// printSummary prints the success or failure of every context
+func printSummary(out io.Writer, results []contextResult) {
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+	}
+
+	fmt.Fprintf(out, "\nSummary: %d of %d contexts succeeded\n", len(results)-failed, len(results))
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintf(w, "%s\tFAILED\t%s\t%v\n", r.context, r.duration.Round(time.Millisecond), r.err)
+		} else {
+			fmt.Fprintf(w, "%s\tOK\t%s\t\n", r.context, r.duration.Round(time.Millisecond))
+		}
+	}
+	w.Flush()
+}
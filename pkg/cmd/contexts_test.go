@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunContexts(t *testing.T) {
+	o := &ContextOptions{parallelism: 2}
+	contexts := []string{"a", "b", "c", "d", "e"}
+
+	var running, maxRunning int32
+	results := o.runContexts(contexts, func(i int, context string) (string, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		if context == "c" {
+			return "tenant-" + context, fmt.Errorf("failed")
+		}
+		return "tenant-" + context, nil
+	})
+
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 concurrent runs, got %d", maxRunning)
+	}
+	for i, r := range results {
+		if r.context != contexts[i] || r.tenantID != "tenant-"+contexts[i] {
+			t.Errorf("unexpected result %d: %+v", i, r)
+		}
+	}
+
+	succeededContexts, tenantIDs := succeeded(results)
+	if strings.Join(succeededContexts, ",") != "a,b,d,e" || strings.Join(tenantIDs, ",") != "tenant-a,tenant-b,tenant-d,tenant-e" {
+		t.Errorf("unexpected succeeded contexts %v and tenants %v", succeededContexts, tenantIDs)
+	}
+
+	buff := &bytes.Buffer{}
+	printSummary(buff, results)
+	if !strings.Contains(buff.String(), "4 of 5 contexts succeeded") || !strings.Contains(buff.String(), "FAILED") {
+		t.Errorf("unexpected summary: %s", buff.String())
+	}
+}
@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// DiffOptions are the options of the diff command
+type DiffOptions struct {
+	since    string
+	files    []string
+	output   string
+	noHeader bool
+
+	SnapshotSourceOptions
+	ExporterOptions
+	genericclioptions.IOStreams
+}
+
+var (
+	diffExample = `
+	# compare two snapshots
+	%[1]s diff before.json after.json
+
+	# compare a snapshot with the current state of its contexts
+	%[1]s diff --since before.json
+`
+)
+
+// NewCmdDiff creates the diff cmd
+func NewCmdDiff(streams genericclioptions.IOStreams) *cobra.Command {
+	o := &DiffOptions{
+		SnapshotSourceOptions: SnapshotSourceOptions{configFlags: genericclioptions.NewConfigFlags(true)},
+		IOStreams:             streams,
+	}
+	cmd := &cobra.Command{
+		Use:          "diff <old> <new> | --since <old>",
+		Short:        "Show volumes, server and lb listeners and members which changed between two snapshots",
+		Example:      fmt.Sprintf(diffExample, "kubectl openstack"),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&o.since, "since", "", "snapshot which is compared with the current state, the contexts of the snapshot are used if --context is not set")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "markdown, raw, json, yaml, go-template=..., go-template-file=... or jsonpath=...")
+	cmd.Flags().BoolVarP(&o.noHeader, "no-headers", "", false, "hide table headers")
+	o.SnapshotSourceOptions.AddFlags(cmd.Flags())
+	o.ExporterOptions.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// Complete sets all necessary fields in DiffOptions
+func (o *DiffOptions) Complete(cmd *cobra.Command, args []string) error {
+	o.files = args
+	if err := o.ExporterOptions.Complete(o.Out); err != nil {
+		return err
+	}
+	return o.SnapshotSourceOptions.Complete(cmd)
+}
+
+// Validate ensures that all required arguments and flag values are provided
+func (o *DiffOptions) Validate() error {
+	if o.since == "" && len(o.files) != 2 {
+		return fmt.Errorf("either two snapshots or --since are required")
+	}
+	if o.since != "" && len(o.files) != 0 {
+		return fmt.Errorf("snapshots as arguments and --since are mutually exclusive")
+	}
+	return o.SnapshotSourceOptions.Validate()
+}
+
+// Run compares the snapshots
+func (o *DiffOptions) Run() error {
+	var oldSnapshot, newSnapshot *Snapshot
+	// contextsErr is returned after the diff of the succeeded contexts has been shown
+	var contextsErr error
+	var err error
+	if o.since != "" {
+		oldSnapshot, err = loadSnapshot(o.since)
+		if err != nil {
+			return err
+		}
+		contexts, err := o.contexts(oldSnapshot.Contexts)
+		if err != nil {
+			return err
+		}
+		var results []contextResult
+		newSnapshot, results = o.takeSnapshot(contexts)
+		if len(contexts) > 1 {
+			printSummary(o.ErrOut, results)
+		}
+		contextsErr = failedContexts(results)
+		if contextsErr != nil && len(newSnapshot.Contexts) == 0 {
+			return contextsErr
+		}
+	} else {
+		oldSnapshot, err = loadSnapshot(o.files[0])
+		if err != nil {
+			return err
+		}
+		newSnapshot, err = loadSnapshot(o.files[1])
+		if err != nil {
+			return err
+		}
+	}
+
+	// only contexts in both snapshots are compared, otherwise all their objects would show up as added or removed
+	contexts, skipped := commonContexts(oldSnapshot.Contexts, newSnapshot.Contexts)
+	if len(skipped) > 0 {
+		fmt.Fprintf(o.ErrOut, "Skipping contexts which are not in both snapshots: %s\n", strings.Join(skipped, ", "))
+	}
+	records := diffSnapshots(oldSnapshot, newSnapshot, contexts)
+
+	var out string
+	if output.IsStructured(o.output) {
+		if records == nil {
+			records = []DiffRecord{}
+		}
+		out, err = output.ConvertToStructured("DiffList", records, o.output)
+	} else {
+		out, err = o.getPrettyDiffList(records)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating output: %v", err)
+	}
+	if out == "" {
+		fmt.Fprintf(o.Out, "No changes since %s\n", oldSnapshot.Time.Format("2006-01-02 15:04:05"))
+		return contextsErr
+	}
+
+	var notes []string
+	for _, r := range records {
+		notes = append(notes, fmt.Sprintf("%s/%s %s: %s", r.Cluster, r.Kind, r.Name, r.Change))
+	}
+	err = o.Export(output.Message{
+		Command:  "diff",
+		Title:    fmt.Sprintf("Changes since %s", oldSnapshot.Time.Format("2006-01-02 15:04:05")),
+		Contexts: contexts,
+		Output:   o.output,
+		Content:  out,
+		Records:  records,
+		Notes:    notes,
+	})
+	if err != nil {
+		return err
+	}
+	return contextsErr
+}
+
+var diffHeaders = []string{"CLUSTER", "KIND", "NAME", "ID", "CHANGE", "OLD", "NEW"}
+
+func (o *DiffOptions) getPrettyDiffList(records []DiffRecord) (string, error) {
+	var header []string
+	if !o.noHeader {
+		header = diffHeaders
+	}
+
+	var lines [][]string
+	for _, r := range records {
+		lines = append(lines, []string{r.Cluster, r.Kind, r.Name, r.ID, r.Change, orDash(r.Old), orDash(r.New)})
+	}
+	if len(lines) > 0 {
+		return output.ConvertToTable(output.Table{Header: header, Lines: lines, SortIndices: []int{0, 1, 2, 4}, Output: o.output})
+	}
+	return "", nil
+}
+
+// DiffRecord is a change of an object between two snapshots
+type DiffRecord struct {
+	Cluster string `json:"cluster"`
+	// Kind is Volume, Server, Listener or Member
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Change is added, removed or the changed field, e.g. status
+	Change string `json:"change"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+)
+
+// diffObject is the state of an object which is compared
+type diffObject struct {
+	kind   string
+	id     string
+	name   string
+	fields map[string]string
+}
+
+// diffSnapshots returns the changes of the objects of the contexts between the snapshots
+func diffSnapshots(oldSnapshot, newSnapshot *Snapshot, contexts []string) []DiffRecord {
+	var records []DiffRecord
+	for _, context := range contexts {
+		oldObjects := snapshotObjects(oldSnapshot, context)
+		newObjects := snapshotObjects(newSnapshot, context)
+
+		for key, newObj := range newObjects {
+			oldObj, ok := oldObjects[key]
+			if !ok {
+				records = append(records, DiffRecord{Cluster: context, Kind: newObj.kind, ID: newObj.id, Name: newObj.name, Change: changeAdded})
+				continue
+			}
+			var fields []string
+			for field := range newObj.fields {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			for _, field := range fields {
+				if oldObj.fields[field] != newObj.fields[field] {
+					records = append(records, DiffRecord{Cluster: context, Kind: newObj.kind, ID: newObj.id, Name: newObj.name, Change: field, Old: oldObj.fields[field], New: newObj.fields[field]})
+				}
+			}
+		}
+		for key, oldObj := range oldObjects {
+			if _, ok := newObjects[key]; !ok {
+				records = append(records, DiffRecord{Cluster: context, Kind: oldObj.kind, ID: oldObj.id, Name: oldObj.name, Change: changeRemoved})
+			}
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Change < b.Change
+	})
+	return records
+}
+
+// snapshotObjects returns the compared objects of the context by kind and id
+func snapshotObjects(snapshot *Snapshot, context string) map[string]diffObject {
+	objects := map[string]diffObject{}
+	add := func(obj diffObject) {
+		objects[obj.kind+"/"+obj.id] = obj
+	}
+
+	// there is one volume record per pod, but the Cinder and Nova state is the same
+	for _, v := range snapshot.Volumes {
+		if v.Cluster != context {
+			continue
+		}
+		var cinderServers, novaServers []string
+		for _, a := range v.Cinder.Attachments {
+			cinderServers = append(cinderServers, orDash(a.Name))
+		}
+		for _, a := range v.Nova {
+			novaServers = append(novaServers, a.ServerName)
+		}
+		sort.Strings(cinderServers)
+		sort.Strings(novaServers)
+		add(diffObject{kind: "Volume", id: v.Cinder.ID, name: v.Cinder.Name, fields: map[string]string{
+			"status":             v.Cinder.Status,
+			"cinder attachments": strings.Join(cinderServers, " "),
+			"nova attachments":   strings.Join(novaServers, " "),
+		}})
+	}
+	for _, s := range snapshot.Servers {
+		if s.Cluster != context {
+			continue
+		}
+		add(diffObject{kind: "Server", id: s.Server.ID, name: s.Server.Name, fields: map[string]string{
+			"state":  s.Server.Status,
+			"flavor": s.Server.Flavor,
+		}})
+	}
+	for _, lb := range snapshot.LoadBalancers {
+		if lb.Cluster != context {
+			continue
+		}
+		for _, l := range lb.Listeners {
+			listenerName := fmt.Sprintf("%s:%d", lb.Name, l.ProtocolPort)
+			add(diffObject{kind: "Listener", id: l.ID, name: listenerName})
+			for _, p := range l.Pools {
+				for _, m := range p.Members {
+					add(diffObject{kind: "Member", id: m.ID, name: listenerName + " => " + m.Address + ":" + strconv.Itoa(m.ProtocolPort)})
+				}
+			}
+		}
+	}
+	return objects
+}
+
+// commonContexts returns the contexts which are in both lists and the remaining ones
+func commonContexts(a, b []string) ([]string, []string) {
+	inB := map[string]bool{}
+	for _, c := range b {
+		inB[c] = true
+	}
+	var common, skipped []string
+	for _, c := range a {
+		if inB[c] {
+			common = append(common, c)
+			delete(inB, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+	for c := range inB {
+		skipped = append(skipped, c)
+	}
+	sort.Strings(common)
+	sort.Strings(skipped)
+	return common, skipped
+}
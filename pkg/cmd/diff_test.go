@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	oldSnapshot := &Snapshot{
+		Contexts: []string{"prod"},
+		Volumes: []VolumeRecord{
+			// one record per pod, the volume must only be compared once
+			{Cluster: "prod", Pod: "a", Cinder: CinderVolumeRecord{ID: "v1", Name: "data", Status: "in-use", Attachments: []ServerReference{{ID: "s1", Name: "node-1"}}}},
+			{Cluster: "prod", Pod: "b", Cinder: CinderVolumeRecord{ID: "v1", Name: "data", Status: "in-use", Attachments: []ServerReference{{ID: "s1", Name: "node-1"}}}},
+			{Cluster: "prod", Cinder: CinderVolumeRecord{ID: "v2", Name: "old", Status: "available"}},
+			{Cluster: "test", Cinder: CinderVolumeRecord{ID: "v3", Name: "other", Status: "available"}},
+		},
+		Servers: []ServerRecord{
+			{Cluster: "prod", Server: ServerInfoRecord{ID: "s1", Name: "node-1", Status: "ACTIVE", Flavor: "m1.small"}},
+		},
+		LoadBalancers: []LBRecord{
+			{Cluster: "prod", Name: "lb", Listeners: []LBListenerRecord{
+				{ID: "l1", ProtocolPort: 80, Pools: []LBPoolRecord{{Members: []LBMemberRecord{{ID: "m1", Address: "10.0.0.1", ProtocolPort: 30080}}}}},
+			}},
+		},
+	}
+	newSnapshot := &Snapshot{
+		Contexts: []string{"prod"},
+		Volumes: []VolumeRecord{
+			{Cluster: "prod", Pod: "a", Cinder: CinderVolumeRecord{ID: "v1", Name: "data", Status: "available"}},
+			{Cluster: "prod", Cinder: CinderVolumeRecord{ID: "v4", Name: "new", Status: "available"}},
+		},
+		Servers: []ServerRecord{
+			{Cluster: "prod", Server: ServerInfoRecord{ID: "s1", Name: "node-1", Status: "SHUTOFF", Flavor: "m1.large"}},
+		},
+		LoadBalancers: []LBRecord{
+			{Cluster: "prod", Name: "lb", Listeners: []LBListenerRecord{
+				{ID: "l1", ProtocolPort: 80, Pools: []LBPoolRecord{{Members: []LBMemberRecord{{ID: "m2", Address: "10.0.0.2", ProtocolPort: 30080}}}}},
+				{ID: "l2", ProtocolPort: 443},
+			}},
+		},
+	}
+
+	expected := []DiffRecord{
+		{Cluster: "prod", Kind: "Listener", ID: "l2", Name: "lb:443", Change: changeAdded},
+		{Cluster: "prod", Kind: "Member", ID: "m1", Name: "lb:80 => 10.0.0.1:30080", Change: changeRemoved},
+		{Cluster: "prod", Kind: "Member", ID: "m2", Name: "lb:80 => 10.0.0.2:30080", Change: changeAdded},
+		{Cluster: "prod", Kind: "Server", ID: "s1", Name: "node-1", Change: "flavor", Old: "m1.small", New: "m1.large"},
+		{Cluster: "prod", Kind: "Server", ID: "s1", Name: "node-1", Change: "state", Old: "ACTIVE", New: "SHUTOFF"},
+		{Cluster: "prod", Kind: "Volume", ID: "v1", Name: "data", Change: "cinder attachments", Old: "node-1"},
+		{Cluster: "prod", Kind: "Volume", ID: "v1", Name: "data", Change: "status", Old: "in-use", New: "available"},
+		{Cluster: "prod", Kind: "Volume", ID: "v4", Name: "new", Change: changeAdded},
+		{Cluster: "prod", Kind: "Volume", ID: "v2", Name: "old", Change: changeRemoved},
+	}
+
+	contexts, skipped := commonContexts(oldSnapshot.Contexts, newSnapshot.Contexts)
+	if !reflect.DeepEqual(contexts, []string{"prod"}) || len(skipped) != 0 {
+		t.Fatalf("unexpected contexts %v and skipped contexts %v", contexts, skipped)
+	}
+	records := diffSnapshots(oldSnapshot, newSnapshot, contexts)
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected records:\n%+v\ngot:\n%+v", expected, records)
+	}
+}
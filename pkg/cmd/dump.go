@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// DumpOptions are the options of the dump command
+type DumpOptions struct {
+	configFlags *genericclioptions.ConfigFlags
+
+	rawConfig api.Config
+
+	file string
+
+	ContextOptions
+	CacheOptions
+	genericclioptions.IOStreams
+}
+
+var (
+	dumpExample = `
+	# dump the inventory of the current context to a directory
+	%[1]s dump ./dump
+
+	# dump the inventory of all prod contexts to a tarball
+	%[1]s dump dump.tar.gz --context=prod
+
+	# list broken volumes from the dump
+	%[1]s volumes --only-broken --from-dump dump.tar.gz
+`
+)
+
+// NewCmdDump creates the dump cmd
+func NewCmdDump(streams genericclioptions.IOStreams) *cobra.Command {
+	o := &DumpOptions{
+		configFlags: genericclioptions.NewConfigFlags(true),
+		IOStreams:   streams,
+	}
+	cmd := &cobra.Command{
+		Use:          "dump <dir or file.tar.gz>",
+		Short:        "Dump all objects from Kubernetes and OpenStack, so the other commands can be run offline via --from-dump",
+		Example:      fmt.Sprintf(dumpExample, "kubectl openstack"),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	o.ContextOptions.AddFlags(cmd.Flags())
+	o.CacheOptions.AddFlags(cmd.Flags())
+	o.configFlags.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// Complete sets all necessary fields in DumpOptions
+func (o *DumpOptions) Complete(cmd *cobra.Command, args []string) error {
+	if getFromDump(cmd) != "" {
+		return fmt.Errorf("--%s is not supported by %s", fromDumpFlag, cmd.Name())
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one dir or file is required, got %d", len(args))
+	}
+	o.file = args[0]
+
+	var err error
+	o.rawConfig, err = o.configFlags.ToRawKubeConfigLoader().RawConfig()
+	return err
+}
+
+// Validate ensures that all required arguments and flag values are provided
+func (o *DumpOptions) Validate() error {
+	if len(o.rawConfig.CurrentContext) == 0 {
+		return errNoContext
+	}
+
+	if err := o.ContextOptions.Validate(); err != nil {
+		return err
+	}
+	return o.CacheOptions.Validate()
+}
+
+// Run dumps the inventories of all matching contexts
+func (o *DumpOptions) Run() error {
+	contexts := kubernetes.GetMatchingContexts(o.rawConfig, *o.configFlags.Context)
+
+	dump := inventory.NewDump()
+	results := o.runContexts(contexts, func(i int, context string) (string, error) {
+		inv, err := fetchInventory(o.configFlags, o.rawConfig, o.cache(), context, inventory.AllResources)
+		if err != nil {
+			return "", err
+		}
+		dump.Add(inv)
+		return inv.Metadata.Cloud, nil
+	})
+
+	succeededContexts, _ := succeeded(results)
+	var err error
+	if len(succeededContexts) > 0 {
+		err = dump.Save(o.file)
+		if err == nil {
+			fmt.Fprintf(o.Out, "Dumped %d contexts to %s\n", len(succeededContexts), o.file)
+		}
+	}
+	if len(contexts) > 1 {
+		printSummary(o.ErrOut, results)
+	}
+	if err != nil {
+		return err
+	}
+	return failedContexts(results)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Exit codes of kubectl openstack, they are documented in the README. If several apply, the
+// highest one is used.
+const (
+	// ExitCodeError is used for all errors which have no specific exit code, e.g. invalid flags
+	ExitCodeError = 1
+	// ExitCodeFindings is used if a finding with at least the severity of --fail-on is found
+	ExitCodeFindings = 2
+	// ExitCodeAPIError is used if fetching the objects of a context from Kubernetes or OpenStack failed
+	ExitCodeAPIError = 3
+	// ExitCodeAuthError is used if Keystone or the Kubernetes API server rejected the credentials of a context
+	ExitCodeAuthError = 4
+)
+
+// ExitError is an error with the exit code of the process
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code of the process for an error returned by a command
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitCodeError
+}
+
+// contextExitCode returns the exit code for an error of fetching a context
+func contextExitCode(err error) int {
+	var authErr *openstack.AuthError
+	if errors.As(err, &authErr) {
+		return ExitCodeAuthError
+	}
+	var statusErr *apierrors.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.ErrStatus.Reason {
+		case metav1.StatusReasonUnauthorized, metav1.StatusReasonForbidden:
+			return ExitCodeAuthError
+		}
+	}
+	return ExitCodeAPIError
+}
+
+// mostSevere returns the error with the highest exit code, nil errors are ignored
+func mostSevere(errs ...error) error {
+	var result error
+	for _, err := range errs {
+		if err != nil && (result == nil || ExitCode(err) > ExitCode(result)) {
+			result = err
+		}
+	}
+	return result
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/rules"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestExitCode(t *testing.T) {
+	authErr := fmt.Errorf("error creating client: %w", &openstack.AuthError{Cloud: "prod", Err: fmt.Errorf("401")})
+	unauthorizedErr := fmt.Errorf("error getting nodes: %w", apierrors.NewUnauthorized("expired"))
+	apiErr := fmt.Errorf("error getting nodes: %w", apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, "node"))
+
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{name: "no error", err: nil, code: 0},
+		{name: "generic error", err: fmt.Errorf("invalid flag"), code: ExitCodeError},
+		{name: "openstack auth error", err: failedContexts([]contextResult{{err: authErr}}), code: ExitCodeAuthError},
+		{name: "kubernetes auth error", err: failedContexts([]contextResult{{err: unauthorizedErr}}), code: ExitCodeAuthError},
+		{name: "api error", err: failedContexts([]contextResult{{err: apiErr}}), code: ExitCodeAPIError},
+		{name: "highest code of contexts", err: failedContexts([]contextResult{{err: apiErr}, {}, {err: authErr}}), code: ExitCodeAuthError},
+		{name: "findings", err: (&RuleOptions{failOn: "warning"}).checkFailOn([]rules.Finding{{Severity: rules.Critical}}), code: ExitCodeFindings},
+		{name: "findings below fail-on", err: (&RuleOptions{failOn: "critical"}).checkFailOn([]rules.Finding{{Severity: rules.Warning}}), code: 0},
+		{name: "most severe", err: mostSevere(nil, failedContexts([]contextResult{{err: apiErr}, {}}), (&RuleOptions{failOn: "info"}).checkFailOn([]rules.Finding{{Severity: rules.Info}})), code: ExitCodeAPIError},
+	}
+	for _, tt := range tests {
+		if code := ExitCode(tt.err); code != tt.code {
+			t.Errorf("%s: expected exit code %d, got %d (%v)", tt.name, tt.code, code, tt.err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+	"github.com/spf13/pflag"
+
+	// register exporters
+	_ "github.com/sbueringer/kubectl-openstack-plugin/pkg/output/mattermost"
+	_ "github.com/sbueringer/kubectl-openstack-plugin/pkg/output/slack"
+	_ "github.com/sbueringer/kubectl-openstack-plugin/pkg/output/teams"
+	_ "github.com/sbueringer/kubectl-openstack-plugin/pkg/output/webhook"
+)
+
+// ExporterOptions are the options of commands which export their output
+type ExporterOptions struct {
+	exporter       string
+	exporterConfig map[string]string
+
+	exporters []output.Exporter
+}
+
+// AddFlags adds the exporter flags to flags
+func (o *ExporterOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.exporter, "exporter", "e", "stdout", fmt.Sprintf("%s or multiple (comma-separated)", strings.Join(output.ExporterNames(), ", ")))
+	flags.StringToStringVar(&o.exporterConfig, "exporter-config", map[string]string{}, "configuration of the exporters in the form <exporter>.<key>=<value>, e.g. mm.channel=alerts")
+}
+
+// Complete creates the exporters, there are none if no exporter is selected. The stdout exporter
+// writes to out.
+func (o *ExporterOptions) Complete(out io.Writer) error {
+	if o.exporter == "" {
+		return nil
+	}
+	var err error
+	o.exporters, err = output.NewExporters(o.exporter, o.exporterConfig, out)
+	return err
+}
+
+// Export sends msg to all exporters
+func (o *ExporterOptions) Export(msg output.Message) error {
+	return output.Export(o.exporters, msg)
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/cache"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// fromDumpFlag is the global flag to render from a dump instead of fetching from the APIs
+const fromDumpFlag = "from-dump"
+
+// getFromDump returns the value of the global --from-dump flag
+func getFromDump(cmd *cobra.Command) string {
+	if f := cmd.Flags().Lookup(fromDumpFlag); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+// FromDumpOptions are the options of commands which can render from a dump instead of fetching
+// from Kubernetes and OpenStack
+type FromDumpOptions struct {
+	dump *inventory.Dump
+}
+
+// Complete loads the dump if the global --from-dump flag is set
+func (o *FromDumpOptions) Complete(cmd *cobra.Command) error {
+	fromDump := getFromDump(cmd)
+	if fromDump == "" {
+		return nil
+	}
+	var err error
+	o.dump, err = inventory.Load(fromDump)
+	return err
+}
+
+// contexts returns the contexts of the dump matching the comma-separated regexps,
+// all contexts of the dump are returned if context is empty
+func (o *FromDumpOptions) contexts(context string) []string {
+	if context == "" {
+		contexts := o.dump.Contexts()
+		sort.Strings(contexts)
+		return contexts
+	}
+	config := api.Config{Contexts: map[string]*api.Context{}}
+	for _, c := range o.dump.Contexts() {
+		config.Contexts[c] = api.NewContext()
+	}
+	return kubernetes.GetMatchingContexts(config, context)
+}
+
+// getInventory returns the inventory of the context from the dump if set, otherwise it's fetched
+func (o *FromDumpOptions) getInventory(context string, fetch func() (*inventory.Inventory, error)) (*inventory.Inventory, error) {
+	if o.dump != nil {
+		return o.dump.Get(context)
+	}
+	return fetch()
+}
+
+// fetchInventory fetches the resources of the context from Kubernetes and OpenStack
+func fetchInventory(configFlags *genericclioptions.ConfigFlags, rawConfig api.Config, c *cache.Cache, context string, resources inventory.Resources) (*inventory.Inventory, error) {
+	if context == "" {
+		return nil, fmt.Errorf("no context set")
+	}
+
+	restConfig, err := kubernetes.GetRestConfig(configFlags, context)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %v", err)
+	}
+	restConfig.WrapTransport = c.WrapTransport("contexts", context)
+
+	kubeClient, err := kubernetes.GetKubeClient(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %v", err)
+	}
+	osProvider, cloud, err := openstack.GetOpenStackClient(context, rawConfig.Contexts[context], c)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %w", err)
+	}
+
+	inv, err := inventory.Fetch(kubeClient, osProvider, resources)
+	if err != nil {
+		return nil, err
+	}
+	inv.Metadata.Context = context
+	inv.Metadata.Cloud = cloud
+	return inv, nil
+}
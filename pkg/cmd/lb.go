@@ -1,14 +1,13 @@
 package cmd
 
 import (
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
-	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
 	"github.com/spf13/cobra"
 	"k8s.io/api/core/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/tools/clientcmd/api"
-	"os"
 
 	"fmt"
 	"strings"
@@ -18,8 +17,6 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/loadbalancers"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/monitors"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/pools"
-	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output/mattermost"
-	"k8s.io/client-go/rest"
 )
 
 //TODO
@@ -28,11 +25,16 @@ type LBOptions struct {
 
 	rawConfig api.Config
 
-	exporter string
 	output   string
 	noHeader bool
 	args     []string
+	// showRegion is set if loadbalancers of multiple clouds are listed
+	showRegion bool
 
+	ContextOptions
+	CacheOptions
+	FromDumpOptions
+	ExporterOptions
 	genericclioptions.IOStreams
 }
 
@@ -40,6 +42,9 @@ var (
 	lbExample = `
 	# list lb
 	%[1]s lb
+
+	# list the provisioning status of all lb
+	%[1]s lb -o jsonpath='{range .items[*]}{.name}{"\t"}{.objects.loadbalancer.provisioning_status}{"\n"}{end}'
 `
 )
 
@@ -67,9 +72,11 @@ func NewCmdLB(streams genericclioptions.IOStreams) *cobra.Command {
 			return nil
 		},
 	}
-	cmd.Flags().StringVarP(&o.exporter, "exporter", "e", "stdout", "stdout, mm or multiple (comma-separated)")
-	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "markdown or raw")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "markdown, raw, json, yaml, go-template=..., go-template-file=... or jsonpath=...")
 	cmd.Flags().BoolVarP(&o.noHeader, "no-headers", "", false, "hide table headers")
+	o.ContextOptions.AddFlags(cmd.Flags())
+	o.CacheOptions.AddFlags(cmd.Flags())
+	o.ExporterOptions.AddFlags(cmd.Flags())
 	o.configFlags.AddFlags(cmd.Flags())
 	return cmd
 }
@@ -83,176 +90,294 @@ func (o *LBOptions) Complete(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := o.ExporterOptions.Complete(o.Out); err != nil {
+		return err
+	}
+	if err := o.FromDumpOptions.Complete(cmd); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Validate ensures that all required arguments and flag values are provided
 func (o *LBOptions) Validate() error {
-	if len(o.rawConfig.CurrentContext) == 0 {
+	if len(o.rawConfig.CurrentContext) == 0 && o.dump == nil {
 		return errNoContext
 	}
 
-	return nil
+	if err := o.ContextOptions.Validate(); err != nil {
+		return err
+	}
+	return o.CacheOptions.Validate()
 }
 
 // Run lists all loadbalancers
 func (o *LBOptions) Run() error {
 	contexts := kubernetes.GetMatchingContexts(o.rawConfig, *o.configFlags.Context)
+	if o.dump != nil {
+		contexts = o.FromDumpOptions.contexts(*o.configFlags.Context)
+	}
 
 	if len(contexts) == 1 {
-		err := o.runWithConfig(contexts[0])
+		records, tenantID, err := o.getRecords(contexts[0])
 		if err != nil {
-			return fmt.Errorf("Error listing loadbalancers for %s: %v\n", o.rawConfig.CurrentContext, err)
+			return &ExitError{Code: contextExitCode(err), Err: fmt.Errorf("Error listing loadbalancers for %s: %v\n", contexts[0], err)}
 		}
-		return nil
+		return o.exportRecords([]string{contexts[0]}, []string{tenantID}, records)
 	}
 
 	// multiple tenants
-	// disable header here and print them once if required
-	if !o.noHeader {
-		output, err := output.ConvertToTable(output.Table{defaultHeaders, [][]string{}, []int{0, 1}, o.output})
-		if err != nil {
-			return fmt.Errorf("error creating output: %v", err)
-		}
-		fmt.Printf(output)
+	o.showRegion = true
+	recordsPerContext := make([][]LBRecord, len(contexts))
+	results := o.runContexts(contexts, func(i int, context string) (string, error) {
+		records, tenantID, err := o.getRecords(context)
+		recordsPerContext[i] = records
+		return tenantID, err
+	})
+	var records []LBRecord
+	for _, r := range recordsPerContext {
+		records = append(records, r...)
 	}
-	o.noHeader = true
-	for _, context := range contexts {
-		o.configFlags.Context = &context
-		err := o.runWithConfig(context)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error listing loadbalancers for %s: %v\n", context, err)
-		}
+
+	succeededContexts, tenantIDs := succeeded(results)
+	err := o.exportRecords(succeededContexts, tenantIDs, records)
+	printSummary(o.ErrOut, results)
+	if err != nil {
+		return err
 	}
-	return nil
+	return failedContexts(results)
 }
 
-func (o *LBOptions) runWithConfig(context string) error {
-	if context == "" {
-		return fmt.Errorf("no context set")
+// getRecords fetches the loadbalancers of the context from Kubernetes and OpenStack
+func (o *LBOptions) getRecords(context string) ([]LBRecord, string, error) {
+	inv, err := o.getInventory(context, func() (*inventory.Inventory, error) {
+		return fetchInventory(o.configFlags, o.rawConfig, o.cache(), context, inventory.Resources{
+			LoadBalancers: true,
+			Services:      true,
+		})
+	})
+	if err != nil {
+		return nil, "", err
 	}
 
-	contextStruct := o.rawConfig.Contexts[context]
-	cluster := o.rawConfig.Clusters[contextStruct.Cluster]
-	authInfo := o.rawConfig.AuthInfos[contextStruct.AuthInfo]
-	c := &rest.Config{
-		Host: cluster.Server,
-		TLSClientConfig: rest.TLSClientConfig{
-			CAData:   cluster.CertificateAuthorityData,
-			KeyData:  authInfo.ClientKeyData,
-			CertData: authInfo.ClientCertificateData,
-		},
+	openStack := inv.OpenStack
+	records := o.getLBRecords(context, kubernetes.ServicesByNodePort(inv.Kubernetes.Services), openStack.LoadBalancers, openStack.Listeners, openStack.Pools, openStack.Members, openStack.Monitors, openStack.FloatingIPs)
+	for i := range records {
+		records[i].Region = inv.Metadata.Region
 	}
 
-	kubeClient, err := kubernetes.GetKubeClient(c)
-	if err != nil {
-		return fmt.Errorf("error creating client: %v", err)
+	return records, inv.Metadata.Cloud, nil
+}
+
+// exportRecords renders the records of the contexts and exports them
+func (o *LBOptions) exportRecords(contexts, tenantIDs []string, records []LBRecord) error {
+	var out string
+	var err error
+	if output.IsStructured(o.output) {
+		if records == nil {
+			records = []LBRecord{}
+		}
+		out, err = output.ConvertToStructured("LoadBalancerList", records, o.output)
+	} else {
+		out, err = o.getPrettyLBList(records)
 	}
-	osProvider, tenantID, err := openstack.GetOpenStackClient(context)
 	if err != nil {
-		return fmt.Errorf("error creating client: %v", err)
+		return fmt.Errorf("error creating output: %v", err)
 	}
 
-	servicesMap, err := kubernetes.GetServices(kubeClient)
-	if err != nil {
-		return fmt.Errorf("error getting persistent volumes from Kubernetes: %v", err)
+	if out == "" {
+		return nil
 	}
+	return o.export(contexts, tenantIDs, records, out)
+}
 
-	loadBalancersMap, listenersMap, poolsMap, membersMap, monitorsMap, floatingipsMap, err := openstack.GetLB(osProvider)
-	if err != nil {
-		return fmt.Errorf("error getting servers from OpenStack: %v", err)
-	}
+func (o *LBOptions) export(contexts, tenantIDs []string, records []LBRecord, out string) error {
+	return o.Export(output.Message{
+		Command:   "lb",
+		Title:     fmt.Sprintf("LBaaS for %s", strings.Join(tenantIDs, ", ")),
+		Contexts:  contexts,
+		TenantIDs: tenantIDs,
+		Output:    o.output,
+		Content:   out,
+		Records:   records,
+		Notes:     nil,
+	})
+}
 
-	output, err := o.getPrettyLBList(context, servicesMap, loadBalancersMap, listenersMap, poolsMap, membersMap, monitorsMap, floatingipsMap)
-	if err != nil {
-		return fmt.Errorf("error creating output: %v", err)
-	}
+var lbHeaders = []string{"CLUSTER", "NAME", "FLOATING_IPS", "VIP_ADDRESS", "PORTS", "SERVICES"}
 
-	if output == "" {
-		return nil
+func (o *LBOptions) headers() []string {
+	if o.showRegion {
+		return withRegion(lbHeaders, "REGION")
 	}
-	for _, exporter := range strings.Split(o.exporter, ",") {
-		switch exporter {
-		case "stdout":
-			{
-				fmt.Printf(output)
+	return lbHeaders
+}
+
+// LBRecord is the correlated view of an OpenStack loadbalancer, its listeners, pools and
+// members and the Kubernetes services they are forwarding to
+type LBRecord struct {
+	Cluster     string             `json:"cluster"`
+	Region      string             `json:"region,omitempty"`
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	VipAddress  string             `json:"vipAddress"`
+	FloatingIPs []string           `json:"floatingIPs,omitempty"`
+	Listeners   []LBListenerRecord `json:"listeners,omitempty"`
+	Objects     *LBObjects         `json:"objects,omitempty"`
+}
+
+// LBObjects are the raw OpenStack objects a LBRecord is correlated from
+type LBObjects struct {
+	LoadBalancer loadbalancers.LoadBalancer `json:"loadbalancer"`
+	FloatingIPs  []floatingips.FloatingIP   `json:"floatingIPs,omitempty"`
+}
+
+// LBListenerRecord is a listener of a loadbalancer
+type LBListenerRecord struct {
+	ID           string             `json:"id"`
+	Name         string             `json:"name"`
+	Protocol     string             `json:"protocol"`
+	ProtocolPort int                `json:"protocolPort"`
+	Pools        []LBPoolRecord     `json:"pools,omitempty"`
+	Services     []string           `json:"services,omitempty"`
+	Objects      *LBListenerObjects `json:"objects,omitempty"`
+}
+
+// LBListenerObjects are the raw OpenStack and Kubernetes objects a LBListenerRecord is correlated from
+type LBListenerObjects struct {
+	Listener listeners.Listener `json:"listener"`
+	Services []v1.Service       `json:"services,omitempty"`
+}
+
+// LBPoolRecord is a pool of a listener
+type LBPoolRecord struct {
+	ID      string           `json:"id"`
+	Name    string           `json:"name"`
+	Members []LBMemberRecord `json:"members,omitempty"`
+	Objects *LBPoolObjects   `json:"objects,omitempty"`
+}
+
+// LBPoolObjects are the raw OpenStack objects a LBPoolRecord is correlated from
+type LBPoolObjects struct {
+	Pool    pools.Pool        `json:"pool"`
+	Monitor *monitors.Monitor `json:"monitor,omitempty"`
+}
+
+// LBMemberRecord is a member of a pool
+type LBMemberRecord struct {
+	ID           string           `json:"id"`
+	Address      string           `json:"address"`
+	ProtocolPort int              `json:"protocolPort"`
+	Objects      *LBMemberObjects `json:"objects,omitempty"`
+}
+
+// LBMemberObjects are the raw OpenStack objects a LBMemberRecord is correlated from
+type LBMemberObjects struct {
+	Member pools.Member `json:"member"`
+}
+
+func (o *LBOptions) getLBRecords(context string, services map[int32]v1.Service, loadbalancers map[string]loadbalancers.LoadBalancer, listeners map[string]listeners.Listener, pools map[string]pools.Pool, members map[string]pools.Member, monitors map[string]monitors.Monitor, floatingIPs map[string]floatingips.FloatingIP) []LBRecord {
+
+	var records []LBRecord
+	poolsPerListener := getPoolsPerListener(pools)
+
+	for _, lb := range loadbalancers {
+		r := LBRecord{
+			Cluster:    context,
+			ID:         lb.ID,
+			Name:       lb.Name,
+			VipAddress: lb.VipAddress,
+			Objects:    &LBObjects{LoadBalancer: lb},
+		}
+		for _, fip := range getFloatingIPForLB(lb, floatingIPs) {
+			r.FloatingIPs = append(r.FloatingIPs, fip.FloatingIP)
+			r.Objects.FloatingIPs = append(r.Objects.FloatingIPs, fip)
+		}
+
+		for _, l := range getListener(lb.ID, listeners) {
+			lr := LBListenerRecord{
+				ID:           l.ID,
+				Name:         l.Name,
+				Protocol:     l.Protocol,
+				ProtocolPort: l.ProtocolPort,
+				Objects:      &LBListenerObjects{Listener: l},
 			}
-		case "mm":
-			{
-				var msg string
-				switch o.output {
-				case "raw":
-					msg = fmt.Sprintf("LBaaS for %s:\n\n````\n%s````\n\n", tenantID, output)
-				case "markdown":
-					msg = fmt.Sprintf("LBaaS for %s:\n\n%s\n\n", tenantID, output)
+			ports := map[int]bool{}
+			for _, pool := range poolsPerListener[l.ID] {
+				pr := LBPoolRecord{
+					ID:      pool.ID,
+					Name:    pool.Name,
+					Objects: &LBPoolObjects{Pool: pool},
+				}
+				if monitor, ok := monitors[pool.MonitorID]; ok {
+					pr.Objects.Monitor = &monitor
+				}
+				for _, member := range getLBMemberForPool(pool, members) {
+					pr.Members = append(pr.Members, LBMemberRecord{ID: member.ID, Address: member.Address, ProtocolPort: member.ProtocolPort, Objects: &LBMemberObjects{Member: member}})
+					ports[member.ProtocolPort] = true
+				}
+				lr.Pools = append(lr.Pools, pr)
+			}
+			for port := range ports {
+				svc, ok := services[int32(port)]
+				if ok {
+					lr.Services = append(lr.Services, fmt.Sprintf("%s/%s", svc.Namespace, svc.Name))
+					lr.Objects.Services = append(lr.Objects.Services, svc)
 				}
-				mattermost.New().SendMessage(msg)
 			}
+			r.Listeners = append(r.Listeners, lr)
 		}
+		records = append(records, r)
 	}
-	return nil
+	return records
 }
 
-var lbHeaders = []string{"CLUSTER", "NAME", "FLOATING_IPS", "VIP_ADDRESS", "PORTS", "SERVICES"}
-
-func (o *LBOptions) getPrettyLBList(context string, services map[int32]v1.Service, loadbalancers map[string]loadbalancers.LoadBalancer, listeners map[string]listeners.Listener, pools map[string]pools.Pool, members map[string]pools.Member, monitors map[string]monitors.Monitor, floatingIPs map[string]floatingips.FloatingIP) (string, error) {
+func (o *LBOptions) getPrettyLBList(records []LBRecord) (string, error) {
 
 	var header []string
 	if !o.noHeader {
-		header = lbHeaders
+		header = o.headers()
 	}
 
 	var lines [][]string
-	poolsPerListener := getPoolsPerListener(pools)
-
-	for _, lb := range loadbalancers {
-		listenerss := getListener(lb.ID, listeners)
+	for _, r := range records {
+		floatingIPsString := strings.Join(r.FloatingIPs, ",")
 
-		floatingIPs := getFloatingIPForLB(lb, floatingIPs)
-		floatingIPsString := strings.Join(floatingIPs, ",")
-
-		for _, l := range listenerss {
+		for _, l := range r.Listeners {
 			targets := map[int][]string{}
-			poolss := poolsPerListener[l.ID]
-			for _, pool := range poolss {
-				for _, member := range getLBMemberForPool(pool, members) {
-					ports, ok := targets[member.ProtocolPort]
-					if !ok {
-						ports = []string{}
-					}
-					targets[member.ProtocolPort] = append(ports, member.Address)
+			for _, pool := range l.Pools {
+				for _, member := range pool.Members {
+					targets[member.ProtocolPort] = append(targets[member.ProtocolPort], member.Address)
 				}
 			}
 			var targetsArray []string
-			var svcsArray []string
 			for port, addresses := range targets {
 				targetsArray = append(targetsArray, fmt.Sprintf("%s:%d", addresses, port))
-
-				svc, ok := services[int32(port)]
-				if ok {
-					svcsArray = append(svcsArray, fmt.Sprintf("%s/%s", svc.Namespace, svc.Name))
-				}
 			}
 			portMapping := fmt.Sprintf("%d => %s", l.ProtocolPort, strings.Join(targetsArray, ","))
-			svcs := strings.Join(svcsArray, ",")
+			svcs := strings.Join(l.Services, ",")
 			if svcs == "" {
 				svcs = "-"
 			}
 
-			lines = append(lines, []string{context, lb.Name, floatingIPsString, lb.VipAddress, portMapping, svcs})
+			line := []string{r.Cluster, r.Name, floatingIPsString, r.VipAddress, portMapping, svcs}
+			if o.showRegion {
+				line = withRegion(line, orDash(r.Region))
+			}
+			lines = append(lines, line)
 		}
 	}
 	if len(lines) > 0 {
-		return output.ConvertToTable(output.Table{header, lines, []int{0, 1}, o.output})
+		return output.ConvertToTable(output.Table{Header: header, Lines: lines, SortIndices: []int{0, 1}, Output: o.output})
 	}
 	return "", nil
 }
 
-func getFloatingIPForLB(lb loadbalancers.LoadBalancer, floatingIPs map[string]floatingips.FloatingIP) []string {
-	var fips []string
+func getFloatingIPForLB(lb loadbalancers.LoadBalancer, floatingIPs map[string]floatingips.FloatingIP) []floatingips.FloatingIP {
+	var fips []floatingips.FloatingIP
 	for _, floatingIP := range floatingIPs {
 		if floatingIP.PortID == lb.VipPortID {
-			fips = append(fips, floatingIP.FloatingIP)
+			fips = append(fips, floatingIP)
 		}
 	}
 	return fips
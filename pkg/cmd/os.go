@@ -10,6 +10,11 @@ import (
 
 var errNoContext = fmt.Errorf("no context is currently set, use %q to select a new one", "kubectl config use-context <context>")
 
+// withRegion inserts the region as second column right after the cluster
+func withRegion(row []string, region string) []string {
+	return append([]string{row[0], region}, row[1:]...)
+}
+
 // NewCmdNamespace provides a cobra command
 func NewCmdOpenStack(streams genericclioptions.IOStreams) *cobra.Command {
 	cmd := &cobra.Command{
@@ -21,11 +26,16 @@ func NewCmdOpenStack(streams genericclioptions.IOStreams) *cobra.Command {
 		},
 	}
 	genericclioptions.NewConfigFlags(true).AddFlags(cmd.Flags())
+	cmd.PersistentFlags().String(fromDumpFlag, "", "render volumes, server and lb from a dir or tarball written by dump instead of fetching from Kubernetes and OpenStack")
 
 	cmd.AddCommand(NewCmdLB(streams))
 	cmd.AddCommand(NewCmdServer(streams))
 	cmd.AddCommand(NewCmdVolumes(streams))
 	cmd.AddCommand(NewCmdVolumesFix(streams))
 	cmd.AddCommand(NewCmdImportConfig(streams))
+	cmd.AddCommand(NewCmdDump(streams))
+	cmd.AddCommand(NewCmdSnapshot(streams))
+	cmd.AddCommand(NewCmdDiff(streams))
+	cmd.AddCommand(NewCmdRules(streams))
 	return cmd
 }
@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/config"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/rules"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// volumeRule is a consistency check of a volume record, check returns the note of a violation
+// or an empty string
+type volumeRule struct {
+	rules.Rule
+	check func(r VolumeRecord) string
+}
+
+// serverRule is a consistency check of a server record, check returns the note of a violation
+// or an empty string
+type serverRule struct {
+	rules.Rule
+	check func(r ServerRecord) string
+}
+
+// volumeRules are checked in order for every volume record, new checks are added here
+var volumeRules = []volumeRule{
+	{
+		Rule: rules.Rule{ID: "multi-attach", Kind: "Volume", Severity: rules.Critical, Description: "volume is attached more than once in Nova"},
+		check: func(r VolumeRecord) string {
+			count := 0
+			for _, a := range r.Nova {
+				count += a.Count
+			}
+			if count >= 2 {
+				return "multiple attachments"
+			}
+			return ""
+		},
+	},
+	{
+		Rule: rules.Rule{ID: "pod-cinder-mismatch", Kind: "Volume", Severity: rules.Critical, Description: "node of the pod using the volume is not the server the volume is attached to in Cinder"},
+		check: func(r VolumeRecord) string {
+			cinderServers, _ := r.cinderServers()
+			if r.PodNode != "" && r.PodStatus != "Completed" && !strings.Contains(strings.Join(cinderServers, " "), r.PodNode) {
+				return "pod != cinder server"
+			}
+			return ""
+		},
+	},
+	{
+		Rule: rules.Rule{ID: "pod-nova-mismatch", Kind: "Volume", Severity: rules.Critical, Description: "node of the pod using the volume is not the server the volume is attached to in Nova"},
+		check: func(r VolumeRecord) string {
+			novaServers, _ := r.novaServers()
+			if r.PodNode != "" && r.PodStatus != "Completed" && !strings.Contains(strings.Join(novaServers, " "), r.PodNode) {
+				return "pod != nova server"
+			}
+			return ""
+		},
+	},
+	{
+		Rule: rules.Rule{ID: "nova-cinder-mismatch", Kind: "Volume", Severity: rules.Critical, Description: "volume is attached to different servers in Nova and Cinder"},
+		check: func(r VolumeRecord) string {
+			cinderServers, _ := r.cinderServers()
+			novaServers, _ := r.novaServers()
+			if !strings.Contains(strings.Join(novaServers, " "), strings.Join(cinderServers, " ")) {
+				return "nova != cinder server"
+			}
+			return ""
+		},
+	},
+	{
+		Rule: rules.Rule{ID: "available-attached", Kind: "Volume", Severity: rules.Warning, Description: "volume is available in Cinder but attached to a server"},
+		check: func(r VolumeRecord) string {
+			cinderServers, _ := r.cinderServers()
+			novaServers, _ := r.novaServers()
+			if r.Cinder.Status == "available" && (len(novaServers) > 0 || len(cinderServers) > 0) {
+				return "available but attached"
+			}
+			return ""
+		},
+	},
+	{
+		Rule: rules.Rule{ID: "available-pod", Kind: "Volume", Severity: rules.Critical, Description: "volume is available in Cinder but used by a pod which is not completed"},
+		check: func(r VolumeRecord) string {
+			if r.Cinder.Status == "available" && r.Pod != "" && r.PodStatus != "Completed" {
+				return fmt.Sprintf("available but pod %q", r.PodStatus)
+			}
+			return ""
+		},
+	},
+	{
+		Rule: rules.Rule{ID: "in-use-detached", Kind: "Volume", Severity: rules.Critical, Description: "volume is in-use in Cinder but not attached in Nova or Cinder"},
+		check: func(r VolumeRecord) string {
+			cinderServers, _ := r.cinderServers()
+			novaServers, _ := r.novaServers()
+			if r.Cinder.Status == "in-use" && (len(novaServers) == 0 || len(cinderServers) == 0) {
+				return "in-use but not attached"
+			}
+			return ""
+		},
+	},
+	{
+		Rule: rules.Rule{ID: "server-not-found", Kind: "Volume", Severity: rules.Warning, Description: "server the volume is attached to in Cinder doesn't exist"},
+		check: func(r VolumeRecord) string {
+			cinderServers, _ := r.cinderServers()
+			if strings.Contains(strings.Join(cinderServers, " "), "not found") {
+				return "attached server not found"
+			}
+			return ""
+		},
+	},
+	{
+		Rule: rules.Rule{ID: "orphan", Kind: "Volume", Severity: rules.Info, Description: "dynamically provisioned volume has no pv, pvc or pod, it can be deleted via volumes prune"},
+		check: func(r VolumeRecord) string {
+			if r.PVC == "" && r.PV == "" && r.Pod == "" && isKubernetesVolume(r.Cinder.Name) {
+				return "kubernetes disk has no pv/pvc/pod"
+			}
+			return ""
+		},
+	},
+}
+
+// serverRules are checked in order for every server record, new checks are added here
+var serverRules = []serverRule{
+	{
+		Rule: rules.Rule{ID: "multi-attach", Kind: "Server", Severity: rules.Critical, Description: "a volume is attached more than once to the server"},
+		check: func(r ServerRecord) string {
+			for _, v := range r.Volumes {
+				if v.Count > 1 {
+					return "multiple attachments"
+				}
+			}
+			return ""
+		},
+	},
+}
+
+// allRules returns the volume and server rules
+func allRules() []rules.Rule {
+	var all []rules.Rule
+	for _, r := range volumeRules {
+		all = append(all, r.Rule)
+	}
+	for _, r := range serverRules {
+		all = append(all, r.Rule)
+	}
+	return all
+}
+
+// RuleOptions select the consistency rules which are checked
+type RuleOptions struct {
+	rules         string
+	disabledRules string
+	failOn        string
+
+	selection *rules.Selection
+}
+
+// AddFlags adds the rule flags to flags
+func (o *RuleOptions) AddFlags(flags *pflag.FlagSet) {
+	o.AddSelectionFlags(flags)
+	flags.StringVar(&o.failOn, "fail-on", "", fmt.Sprintf("exit with code %d if a finding with at least this severity is shown: info, warning or critical", ExitCodeFindings))
+}
+
+// AddSelectionFlags only adds the flags which select the rules to flags
+func (o *RuleOptions) AddSelectionFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.rules, "rules", "", "comma-separated list of rules which are checked, by default all rules which are not disabled in the plugin config. The rules are listed via \"kubectl openstack rules\"")
+	flags.StringVar(&o.disabledRules, "disable-rules", "", "comma-separated list of rules which are not checked")
+}
+
+// Complete selects the rules. The rules disabled in the plugin config are ignored if --rules is set.
+func (o *RuleOptions) Complete() error {
+	var disabled []string
+	if o.rules == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		disabled = cfg.Rules.Disabled
+	}
+	disabled = append(disabled, splitList(o.disabledRules)...)
+
+	var err error
+	o.selection, err = rules.Select(allRules(), splitList(o.rules), disabled)
+	return err
+}
+
+// Validate ensures that the rule flags are valid
+func (o *RuleOptions) Validate() error {
+	if o.failOn == "" {
+		return nil
+	}
+	_, err := rules.ParseSeverity(o.failOn)
+	return err
+}
+
+// checkFailOn returns an error with ExitCodeFindings if a finding has at least the severity of --fail-on
+func (o *RuleOptions) checkFailOn(findings []rules.Finding) error {
+	if o.failOn == "" {
+		return nil
+	}
+	// the severity has been validated in Validate
+	failOn, _ := rules.ParseSeverity(o.failOn)
+	count := 0
+	for _, f := range findings {
+		if f.Severity.AtLeast(failOn) {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	return &ExitError{Code: ExitCodeFindings, Err: fmt.Errorf("found %d findings with severity %s or higher", count, failOn)}
+}
+
+// checkVolume returns the findings of the enabled volume rules
+func (o *RuleOptions) checkVolume(r VolumeRecord) []rules.Finding {
+	var findings []rules.Finding
+	for _, rule := range volumeRules {
+		if !o.selection.Enabled(rule.ID) {
+			continue
+		}
+		if note := rule.check(r); note != "" {
+			findings = append(findings, rules.Finding{Rule: rule.ID, Severity: rule.Severity, Message: note})
+		}
+	}
+	return findings
+}
+
+// checkServer returns the findings of the enabled server rules
+func (o *RuleOptions) checkServer(r ServerRecord) []rules.Finding {
+	var findings []rules.Finding
+	for _, rule := range serverRules {
+		if !o.selection.Enabled(rule.ID) {
+			continue
+		}
+		if note := rule.check(r); note != "" {
+			findings = append(findings, rules.Finding{Rule: rule.ID, Severity: rule.Severity, Message: note})
+		}
+	}
+	return findings
+}
+
+// splitList splits a comma-separated flag value, an empty value is an empty list
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// RulesOptions are the options of the rules command
+type RulesOptions struct {
+	output   string
+	noHeader bool
+
+	RuleOptions
+	genericclioptions.IOStreams
+}
+
+// RuleRecord is a rule and whether it is checked
+type RuleRecord struct {
+	rules.Rule
+	Enabled bool `json:"enabled"`
+}
+
+// NewCmdRules creates the rules cmd
+func NewCmdRules(streams genericclioptions.IOStreams) *cobra.Command {
+	o := &RulesOptions{
+		IOStreams: streams,
+	}
+	cmd := &cobra.Command{
+		Use:          "rules",
+		Short:        "List the consistency rules which are checked by volumes and server",
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.RuleOptions.Complete(); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "markdown, raw, json, yaml, go-template=..., go-template-file=... or jsonpath=...")
+	cmd.Flags().BoolVarP(&o.noHeader, "no-headers", "", false, "hide table headers")
+	// --fail-on doesn't apply as no records are checked
+	o.RuleOptions.AddSelectionFlags(cmd.Flags())
+	return cmd
+}
+
+// Run prints the rules
+func (o *RulesOptions) Run() error {
+	var records []RuleRecord
+	for _, r := range allRules() {
+		records = append(records, RuleRecord{Rule: r, Enabled: o.selection.Enabled(r.ID)})
+	}
+
+	var out string
+	var err error
+	if output.IsStructured(o.output) {
+		out, err = output.ConvertToStructured("RuleList", records, o.output)
+	} else {
+		var header []string
+		if !o.noHeader {
+			header = []string{"ID", "KIND", "SEVERITY", "ENABLED", "DESCRIPTION"}
+		}
+		var lines [][]string
+		for _, r := range records {
+			lines = append(lines, []string{r.ID, r.Kind, string(r.Severity), fmt.Sprintf("%t", r.Enabled), r.Description})
+		}
+		out, err = output.ConvertToTable(output.Table{Header: header, Lines: lines, SortIndices: []int{1, 0}, Output: o.output})
+	}
+	if err != nil {
+		return fmt.Errorf("error creating output: %v", err)
+	}
+	fmt.Fprint(o.Out, out)
+	return nil
+}
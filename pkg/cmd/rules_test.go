@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/rules"
+)
+
+func TestCheckVolume(t *testing.T) {
+	r := VolumeRecord{
+		Cinder: CinderVolumeRecord{ID: "v1", Name: "kubernetes-dynamic-pvc-1", Status: "available", Attachments: []ServerReference{{ID: "s1"}}},
+		Nova:   []NovaAttachmentRecord{{ServerID: "s1", ServerName: "node-1", Count: 2}},
+	}
+
+	o := &RuleOptions{}
+	var ids []string
+	for _, f := range o.checkVolume(r) {
+		ids = append(ids, f.Rule)
+	}
+	expected := []string{"multi-attach", "nova-cinder-mismatch", "available-attached", "server-not-found", "orphan"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected findings of rules %v, got %v", expected, ids)
+	}
+
+	o = &RuleOptions{rules: "multi-attach,orphan", disabledRules: "orphan"}
+	if err := o.Complete(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	findings := o.checkVolume(r)
+	expectedFindings := []rules.Finding{{Rule: "multi-attach", Severity: rules.Critical, Message: "multiple attachments"}}
+	if !reflect.DeepEqual(findings, expectedFindings) {
+		t.Errorf("expected findings %v, got %v", expectedFindings, findings)
+	}
+}
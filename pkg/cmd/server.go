@@ -2,22 +2,20 @@ package cmd
 
 import (
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
-	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
-	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output/mattermost"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/rules"
 	"github.com/spf13/cobra"
 	"k8s.io/api/core/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/tools/clientcmd/api"
-	"os"
 	"sort"
 
 	"fmt"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/api/resource"
-	"k8s.io/client-go/rest"
 )
 
 //TODO
@@ -28,13 +26,19 @@ type ServerOptions struct {
 
 	states string
 
-	exporter   string
 	output     string
 	noHeader   bool
 	args       []string
 	onlyBroken bool
 	debug      bool
+	// showRegion is set if server of multiple clouds are listed
+	showRegion bool
 
+	ContextOptions
+	CacheOptions
+	FromDumpOptions
+	RuleOptions
+	ExporterOptions
 	genericclioptions.IOStreams
 }
 
@@ -45,6 +49,9 @@ var (
 	
 	# list server with debug columns
 	%[1]s server --debug
+
+	# list the flavor of all server
+	%[1]s server -o go-template='{{range .items}}{{.server.name}} {{.objects.server.flavor.id}}{{"\n"}}{{end}}'
 `
 )
 
@@ -74,11 +81,14 @@ func NewCmdServer(streams genericclioptions.IOStreams) *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVar(&o.states, "states", "", "filter by states, default list all")
-	cmd.Flags().StringVarP(&o.exporter, "exporter", "e", "stdout", "stdout, mm or multiple (comma-separated)")
-	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "markdown or raw")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "markdown, raw, json, yaml, go-template=..., go-template-file=... or jsonpath=...")
 	cmd.Flags().BoolVarP(&o.debug, "debug", "", false, "debug prints more columns")
 	cmd.Flags().BoolVarP(&o.onlyBroken, "only-broken", "", false, "only show disks which are broken/out of sync")
 	cmd.Flags().BoolVarP(&o.noHeader, "no-headers", "", false, "hide table headers")
+	o.ContextOptions.AddFlags(cmd.Flags())
+	o.CacheOptions.AddFlags(cmd.Flags())
+	o.RuleOptions.AddFlags(cmd.Flags())
+	o.ExporterOptions.AddFlags(cmd.Flags())
 	o.configFlags.AddFlags(cmd.Flags())
 	return cmd
 }
@@ -92,184 +102,235 @@ func (o *ServerOptions) Complete(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	if err := o.ExporterOptions.Complete(o.Out); err != nil {
+		return err
+	}
+	if err := o.FromDumpOptions.Complete(cmd); err != nil {
+		return err
+	}
+	return o.RuleOptions.Complete()
 }
 
 // Validate ensures that all required arguments and flag values are provided
 func (o *ServerOptions) Validate() error {
-	if len(o.rawConfig.CurrentContext) == 0 {
+	if len(o.rawConfig.CurrentContext) == 0 && o.dump == nil {
 		return errNoContext
 	}
 
-	return nil
+	if err := o.ContextOptions.Validate(); err != nil {
+		return err
+	}
+	if err := o.RuleOptions.Validate(); err != nil {
+		return err
+	}
+	return o.CacheOptions.Validate()
 }
 
 // Run lists all server
 func (o *ServerOptions) Run() error {
 	contexts := kubernetes.GetMatchingContexts(o.rawConfig, *o.configFlags.Context)
-
-	if len(contexts) == 1 {
-		err := o.runWithConfig(contexts[0])
-		if err != nil {
-			return fmt.Errorf("error listing server for %s: %v\n", o.rawConfig.CurrentContext, err)
-		}
-		return nil
+	if o.dump != nil {
+		contexts = o.FromDumpOptions.contexts(*o.configFlags.Context)
 	}
 
-	// multiple tenants
-	// disable header here and print them once if required
-	if !o.noHeader {
-		var header []string
-		if o.debug {
-			header = serverDebugHeaders
-		} else {
-			header = serverHeaders
-		}
-		output, err := output.ConvertToTable(output.Table{header, [][]string{}, []int{0, 1}, o.output})
+	if len(contexts) == 1 {
+		records, tenantID, err := o.getRecords(contexts[0])
 		if err != nil {
-			return fmt.Errorf("error creating output: %v", err)
+			return &ExitError{Code: contextExitCode(err), Err: fmt.Errorf("error listing server for %s: %v\n", contexts[0], err)}
 		}
-		fmt.Printf(output)
-	}
-	o.noHeader = true
-	for _, context := range contexts {
-		o.configFlags.Context = &context
-		err := o.runWithConfig(context)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error listing server for %s: %v\n", context, err)
+		if err := o.exportRecords([]string{contexts[0]}, []string{tenantID}, records); err != nil {
+			return err
 		}
-	}
-	return nil
-}
-
-func (o *ServerOptions) runWithConfig(context string) error {
-	if context == "" {
-		return fmt.Errorf("no context set")
+		return o.checkFailOn(serverFindings(records))
 	}
 
-	contextStruct := o.rawConfig.Contexts[context]
-	cluster := o.rawConfig.Clusters[contextStruct.Cluster]
-	authInfo := o.rawConfig.AuthInfos[contextStruct.AuthInfo]
-	c := &rest.Config{
-		Host: cluster.Server,
-		TLSClientConfig: rest.TLSClientConfig{
-			CAData:   cluster.CertificateAuthorityData,
-			KeyData:  authInfo.ClientKeyData,
-			CertData: authInfo.ClientCertificateData,
-		},
+	// multiple tenants
+	o.showRegion = true
+	recordsPerContext := make([][]ServerRecord, len(contexts))
+	results := o.runContexts(contexts, func(i int, context string) (string, error) {
+		records, tenantID, err := o.getRecords(context)
+		recordsPerContext[i] = records
+		return tenantID, err
+	})
+	var records []ServerRecord
+	for _, r := range recordsPerContext {
+		records = append(records, r...)
 	}
 
-	kubeClient, err := kubernetes.GetKubeClient(c)
-	if err != nil {
-		return fmt.Errorf("error creating client: %v", err)
-	}
-	osProvider, tenantID, err := openstack.GetOpenStackClient(context)
+	succeededContexts, tenantIDs := succeeded(results)
+	err := o.exportRecords(succeededContexts, tenantIDs, records)
+	printSummary(o.ErrOut, results)
 	if err != nil {
-		return fmt.Errorf("error creating client: %v", err)
+		return err
 	}
+	return mostSevere(failedContexts(results), o.checkFailOn(serverFindings(records)))
+}
 
-	nodesMap, err := kubernetes.GetNodes(kubeClient)
+// getRecords fetches the server of the context from Kubernetes and OpenStack
+func (o *ServerOptions) getRecords(context string) ([]ServerRecord, string, error) {
+	inv, err := o.getInventory(context, func() (*inventory.Inventory, error) {
+		return fetchInventory(o.configFlags, o.rawConfig, o.cache(), context, inventory.Resources{
+			Servers: true,
+			Nodes:   true,
+		})
+	})
 	if err != nil {
-		return fmt.Errorf("error getting persistent volumes from Kubernetes: %v", err)
+		return nil, "", err
 	}
 
-	serversMap, err := openstack.GetServer(osProvider)
-	if err != nil {
-		return fmt.Errorf("error getting servers from OpenStack: %v", err)
+	records := o.getServerRecords(context, kubernetes.NodesByServerID(inv.Kubernetes.Nodes), inv.OpenStack.Servers)
+	for i := range records {
+		records[i].Region = inv.Metadata.Region
 	}
 
-	output, err := o.getPrettyServerList(context, nodesMap, serversMap)
+	return records, inv.Metadata.Cloud, nil
+}
+
+// exportRecords renders the records of the contexts and exports them
+func (o *ServerOptions) exportRecords(contexts, tenantIDs []string, records []ServerRecord) error {
+	var out string
+	var err error
+	if output.IsStructured(o.output) {
+		if records == nil {
+			records = []ServerRecord{}
+		}
+		out, err = output.ConvertToStructured("ServerList", records, o.output)
+	} else {
+		out, err = o.getPrettyServerList(records)
+	}
 	if err != nil {
 		return fmt.Errorf("error creating output: %v", err)
 	}
 
-	if output == "" {
+	if out == "" {
 		return nil
 	}
-	for _, exporter := range strings.Split(o.exporter, ",") {
-		switch exporter {
-		case "stdout":
-			{
-				fmt.Printf(output)
-			}
-		case "mm":
-			{
-				var msg string
-				switch o.output {
-				case "raw":
-					msg = fmt.Sprintf("Server for %s:\n\n````\n%s````\n\n", tenantID, output)
-				case "markdown":
-					msg = fmt.Sprintf("Server for %s:\n\n%s\n\n", tenantID, output)
-				}
-				mattermost.New().SendMessage(msg)
-			}
-		}
-	}
-	return nil
+	return o.export(contexts, tenantIDs, records, out)
+}
+
+func (o *ServerOptions) export(contexts, tenantIDs []string, records []ServerRecord, out string) error {
+	return o.Export(output.Message{
+		Command:   "server",
+		Title:     fmt.Sprintf("Server for %s", strings.Join(tenantIDs, ", ")),
+		Contexts:  contexts,
+		TenantIDs: tenantIDs,
+		Output:    o.output,
+		Content:   out,
+		Records:   records,
+		Notes:     serverNotes(records),
+	})
 }
 
 var serverHeaders = []string{"CLUSTER", "NODE_NAME", "STATUS", "KUBELET_VERSION", "KUBEPROXY_VERSION", "RUNTIME_VERSION", "DHC_VERSION", "SERVER_NAME", "SERVER_ID", "STATE", "CPU", "RAM", "IP", "NOTE"}
 var serverDebugHeaders = []string{"CLUSTER", "NODE_NAME", "STATUS", "KUBELET_VERSION", "KUBEPROXY_VERSION", "RUNTIME_VERSION", "DHC_VERSION", "SERVER_NAME", "SERVER_ID", "VOLUMES", "STATE", "CPU", "RAM", "IP", "NOTE"}
 
-func (o *ServerOptions) getPrettyServerList(context string, nodes map[string]v1.Node, server map[string]servers.Server) (string, error) {
-
-	var header []string
-	if !o.noHeader {
-		if o.debug {
-			header = serverDebugHeaders
-		} else {
-			header = serverHeaders
-		}
+func (o *ServerOptions) headers() []string {
+	header := serverHeaders
+	if o.debug {
+		header = serverDebugHeaders
+	}
+	if o.showRegion {
+		header = withRegion(header, "REGION")
 	}
+	return header
+}
 
-	var lines [][]string
+// ServerRecord is the correlated view of an OpenStack server and the Kubernetes node running on it
+type ServerRecord struct {
+	Cluster  string                 `json:"cluster"`
+	Region   string                 `json:"region,omitempty"`
+	Server   ServerInfoRecord       `json:"server"`
+	Node     *NodeRecord            `json:"node,omitempty"`
+	Volumes  []AttachedVolumeRecord `json:"volumes,omitempty"`
+	Notes    []string               `json:"notes,omitempty"`
+	Findings []rules.Finding        `json:"findings,omitempty"`
+	Objects  *ServerObjects         `json:"objects,omitempty"`
+}
+
+// ServerObjects are the raw OpenStack and Kubernetes objects a ServerRecord is correlated from
+type ServerObjects struct {
+	Server servers.Server `json:"server"`
+	Node   *v1.Node       `json:"node,omitempty"`
+}
+
+// ServerInfoRecord is the server as seen by Nova
+type ServerInfoRecord struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Flavor string `json:"flavor,omitempty"`
+}
+
+// NodeRecord is the Kubernetes node running on a server
+type NodeRecord struct {
+	Name             string `json:"name"`
+	Status           string `json:"status"`
+	KubeletVersion   string `json:"kubeletVersion"`
+	KubeProxyVersion string `json:"kubeProxyVersion"`
+	RuntimeVersion   string `json:"runtimeVersion"`
+	DHCVersion       string `json:"dhcVersion,omitempty"`
+	CPU              string `json:"cpu"`
+	RAM              string `json:"ram"`
+	IP               string `json:"ip,omitempty"`
+}
+
+// AttachedVolumeRecord is a volume attached to a server as seen by Nova
+type AttachedVolumeRecord struct {
+	ID    string `json:"id"`
+	Count int    `json:"count"`
+}
+
+func (o *ServerOptions) getServerRecords(context string, nodes map[string]v1.Node, server map[string]servers.Server) []ServerRecord {
+
+	var records []ServerRecord
 	for _, s := range server {
-		name := "-"
-		status := "-"
-		kubeletVersion := "-"
-		kubeProxyVersion := "-"
-		containerRuntimeVersion := "-"
-		dhcVersion := "-"
-		cpu := "-"
-		ram := "-"
-		ip := "-"
+		r := ServerRecord{
+			Cluster: context,
+			Server: ServerInfoRecord{
+				ID:     s.ID,
+				Name:   s.Name,
+				Status: s.Status,
+				Flavor: flavorName(s.Flavor),
+			},
+			Objects: &ServerObjects{Server: s},
+		}
+
 		attachmentCount := map[string]int{}
 		var attachments []string
-		var attachedVolumes []string
-		overallNovaAttachmentCount := 0
 		for _, attachedVolume := range s.AttachedVolumes {
 			attachmentCount[attachedVolume.ID]++
-			overallNovaAttachmentCount++
 		}
 		for a := range attachmentCount {
 			attachments = append(attachments, a)
 		}
 		sort.Strings(attachments)
 		for _, a := range attachments {
-			attachedVolumes = append(attachedVolumes, fmt.Sprintf("%dx %s", attachmentCount[a], a))
+			r.Volumes = append(r.Volumes, AttachedVolumeRecord{ID: a, Count: attachmentCount[a]})
 		}
 		if node, ok := nodes[s.ID]; ok {
-			name = node.Name
+			r.Objects.Node = &node
+			n := &NodeRecord{
+				Name:             node.Name,
+				Status:           "NotReady",
+				KubeletVersion:   node.Status.NodeInfo.KubeletVersion,
+				KubeProxyVersion: node.Status.NodeInfo.KubeProxyVersion,
+				RuntimeVersion:   node.Status.NodeInfo.ContainerRuntimeVersion,
+				DHCVersion:       node.Labels["dhc-version"],
+				CPU:              node.Status.Capacity.Cpu().String(),
+				RAM:              fmt.Sprintf("%dMB", node.Status.Capacity.Memory().ScaledValue(resource.Mega)),
+			}
 			for _, st := range node.Status.Conditions {
 				if st.Type == v1.NodeReady {
-					status = "Ready"
+					n.Status = "Ready"
 					break
 				}
 			}
-			if status == "" {
-				status = "NotReady"
-			}
-			kubeletVersion = node.Status.NodeInfo.KubeletVersion
-			kubeProxyVersion = node.Status.NodeInfo.KubeProxyVersion
-			containerRuntimeVersion = node.Status.NodeInfo.ContainerRuntimeVersion
-			dhcVersion = node.Labels["dhc-version"]
-			cpu = node.Status.Capacity.Cpu().String()
-			ram = fmt.Sprintf("%dMB", node.Status.Capacity.Memory().ScaledValue(resource.Mega))
 			for _, addr := range node.Status.Addresses {
 				if addr.Type == v1.NodeInternalIP {
-					ip = addr.Address
+					n.IP = addr.Address
 				}
 			}
+			r.Node = n
 		}
 
 		matchesStates := false
@@ -280,25 +341,80 @@ func (o *ServerOptions) getPrettyServerList(context string, nodes map[string]v1.
 			}
 		}
 
-		var notes []string
-		showDiskIfOnlyBroken := false
-		// check error states
-		if overallNovaAttachmentCount > len(attachedVolumes) {
-			showDiskIfOnlyBroken = true
-			notes = append(notes, "multiple attachments")
+		r.Findings = o.checkServer(r)
+		r.Notes = rules.Messages(r.Findings)
+
+		if (!o.onlyBroken || len(r.Notes) > 0) && (matchesStates || o.states == "") {
+			records = append(records, r)
 		}
-		note := strings.Join(notes, ", ")
+	}
+	return records
+}
 
-		if (!o.onlyBroken || showDiskIfOnlyBroken) && (matchesStates || o.states == "") {
-			if o.debug {
-				lines = append(lines, []string{context, name, status, kubeletVersion, kubeProxyVersion, containerRuntimeVersion, dhcVersion, s.Name, s.ID, strings.Join(attachedVolumes, " "), s.Status, cpu, ram, ip, note})
-			} else {
-				lines = append(lines, []string{context, name, status, kubeletVersion, kubeProxyVersion, containerRuntimeVersion, dhcVersion, s.Name, s.ID, s.Status, cpu, ram, ip, note})
-			}
+func (o *ServerOptions) getPrettyServerList(records []ServerRecord) (string, error) {
+
+	var header []string
+	if !o.noHeader {
+		header = o.headers()
+	}
+
+	var lines [][]string
+	for _, r := range records {
+		n := NodeRecord{Name: "-", Status: "-", KubeletVersion: "-", KubeProxyVersion: "-", RuntimeVersion: "-", DHCVersion: "-", CPU: "-", RAM: "-", IP: "-"}
+		if r.Node != nil {
+			n = *r.Node
+			n.IP = orDash(n.IP)
+		}
+		var attachedVolumes []string
+		for _, v := range r.Volumes {
+			attachedVolumes = append(attachedVolumes, fmt.Sprintf("%dx %s", v.Count, v.ID))
+		}
+		note := strings.Join(r.Notes, ", ")
+
+		var line []string
+		if o.debug {
+			line = []string{r.Cluster, n.Name, n.Status, n.KubeletVersion, n.KubeProxyVersion, n.RuntimeVersion, n.DHCVersion, r.Server.Name, r.Server.ID, strings.Join(attachedVolumes, " "), r.Server.Status, n.CPU, n.RAM, n.IP, note}
+		} else {
+			line = []string{r.Cluster, n.Name, n.Status, n.KubeletVersion, n.KubeProxyVersion, n.RuntimeVersion, n.DHCVersion, r.Server.Name, r.Server.ID, r.Server.Status, n.CPU, n.RAM, n.IP, note}
 		}
+		if o.showRegion {
+			line = withRegion(line, orDash(r.Region))
+		}
+		lines = append(lines, line)
 	}
 	if len(lines) > 0 {
-		return output.ConvertToTable(output.Table{header, lines, []int{0, 1}, o.output})
+		return output.ConvertToTable(output.Table{Header: header, Lines: lines, SortIndices: []int{0, 1}, Output: o.output})
 	}
 	return "", nil
 }
+
+// flavorName returns the name of the flavor of a server. Depending on the compute microversion
+// only the id is available.
+func flavorName(flavor map[string]interface{}) string {
+	for _, key := range []string{"original_name", "id"} {
+		if name, ok := flavor[key].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// serverFindings returns the findings of all records
+func serverFindings(records []ServerRecord) []rules.Finding {
+	var findings []rules.Finding
+	for _, r := range records {
+		findings = append(findings, r.Findings...)
+	}
+	return findings
+}
+
+// serverNotes returns the notes of all records prefixed with cluster and server name
+func serverNotes(records []ServerRecord) []string {
+	var notes []string
+	for _, r := range records {
+		if len(r.Notes) > 0 {
+			notes = append(notes, fmt.Sprintf("%s/%s: %s", r.Cluster, r.Server.Name, strings.Join(r.Notes, ", ")))
+		}
+	}
+	return notes
+}
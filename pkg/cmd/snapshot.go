@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const snapshotKind = "Snapshot"
+
+// Snapshot is the correlated state of volumes, server and lb of one or more contexts at a point in time.
+// The raw objects are omitted.
+type Snapshot struct {
+	APIVersion    string         `json:"apiVersion"`
+	Kind          string         `json:"kind"`
+	Time          time.Time      `json:"time"`
+	Contexts      []string       `json:"contexts"`
+	Volumes       []VolumeRecord `json:"volumes"`
+	Servers       []ServerRecord `json:"servers"`
+	LoadBalancers []LBRecord     `json:"loadBalancers"`
+}
+
+// SnapshotSourceOptions are the options of commands which take snapshots of the current state
+type SnapshotSourceOptions struct {
+	configFlags *genericclioptions.ConfigFlags
+
+	rawConfig api.Config
+
+	ContextOptions
+	CacheOptions
+	FromDumpOptions
+}
+
+// AddFlags adds the flags to select and fetch the contexts to flags
+func (o *SnapshotSourceOptions) AddFlags(flags *pflag.FlagSet) {
+	o.ContextOptions.AddFlags(flags)
+	o.CacheOptions.AddFlags(flags)
+	o.configFlags.AddFlags(flags)
+}
+
+// Complete loads the kubeconfig and the dump if --from-dump is set
+func (o *SnapshotSourceOptions) Complete(cmd *cobra.Command) error {
+	var err error
+	o.rawConfig, err = o.configFlags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return err
+	}
+	return o.FromDumpOptions.Complete(cmd)
+}
+
+// Validate ensures that the flags are valid
+func (o *SnapshotSourceOptions) Validate() error {
+	if err := o.ContextOptions.Validate(); err != nil {
+		return err
+	}
+	return o.CacheOptions.Validate()
+}
+
+// contexts returns the contexts matching --context, defaultContexts are used if --context is not set
+func (o *SnapshotSourceOptions) contexts(defaultContexts []string) ([]string, error) {
+	context := *o.configFlags.Context
+	if o.dump != nil {
+		return o.FromDumpOptions.contexts(context), nil
+	}
+	if context == "" && len(defaultContexts) > 0 {
+		return defaultContexts, nil
+	}
+	if context == "" && len(o.rawConfig.CurrentContext) == 0 {
+		return nil, errNoContext
+	}
+	return kubernetes.GetMatchingContexts(o.rawConfig, context), nil
+}
+
+// takeSnapshot correlates the inventories of the contexts like volumes, server and lb do.
+// The snapshot only contains the contexts which succeeded.
+func (o *SnapshotSourceOptions) takeSnapshot(contexts []string) (*Snapshot, []contextResult) {
+	type records struct {
+		volumes       []VolumeRecord
+		servers       []ServerRecord
+		loadBalancers []LBRecord
+	}
+	recordsPerContext := make([]records, len(contexts))
+	results := o.runContexts(contexts, func(i int, context string) (string, error) {
+		inv, err := o.getInventory(context, func() (*inventory.Inventory, error) {
+			return fetchInventory(o.configFlags, o.rawConfig, o.cache(), context, inventory.AllResources)
+		})
+		if err != nil {
+			return "", err
+		}
+		recordsPerContext[i] = records{
+			volumes:       (&VolumesOptions{}).getVolumeRecords(context, kubernetes.PersistentVolumesByVolumeID(inv.Kubernetes.PersistentVolumes), kubernetes.PodsByPVC(inv.Kubernetes.Pods), inv.OpenStack.Volumes, inv.OpenStack.Servers, inv.OpenStack.VolumeAttachments),
+			servers:       (&ServerOptions{}).getServerRecords(context, kubernetes.NodesByServerID(inv.Kubernetes.Nodes), inv.OpenStack.Servers),
+			loadBalancers: (&LBOptions{}).getLBRecords(context, kubernetes.ServicesByNodePort(inv.Kubernetes.Services), inv.OpenStack.LoadBalancers, inv.OpenStack.Listeners, inv.OpenStack.Pools, inv.OpenStack.Members, inv.OpenStack.Monitors, inv.OpenStack.FloatingIPs),
+		}
+		return inv.Metadata.Cloud, nil
+	})
+
+	snapshot := &Snapshot{APIVersion: output.APIVersion, Kind: snapshotKind, Time: time.Now()}
+	snapshot.Contexts, _ = succeeded(results)
+	for _, r := range recordsPerContext {
+		for _, v := range r.volumes {
+			v.Objects = nil
+			snapshot.Volumes = append(snapshot.Volumes, v)
+		}
+		for _, s := range r.servers {
+			s.Objects = nil
+			snapshot.Servers = append(snapshot.Servers, s)
+		}
+		for _, lb := range r.loadBalancers {
+			lb.Objects = nil
+			for i := range lb.Listeners {
+				lb.Listeners[i].Objects = nil
+				for j := range lb.Listeners[i].Pools {
+					lb.Listeners[i].Pools[j].Objects = nil
+					for k := range lb.Listeners[i].Pools[j].Members {
+						lb.Listeners[i].Pools[j].Members[k].Objects = nil
+					}
+				}
+			}
+			snapshot.LoadBalancers = append(snapshot.LoadBalancers, lb)
+		}
+	}
+	return snapshot, results
+}
+
+// loadSnapshot reads a snapshot written by snapshot save
+func loadSnapshot(file string) (*Snapshot, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %v", file, err)
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(content, snapshot); err != nil {
+		return nil, fmt.Errorf("error parsing snapshot %s: %v", file, err)
+	}
+	if snapshot.Kind != snapshotKind {
+		return nil, fmt.Errorf("error parsing snapshot %s: expected kind %s, got %q", file, snapshotKind, snapshot.Kind)
+	}
+	return snapshot, nil
+}
+
+// SnapshotSaveOptions are the options of the snapshot save command
+type SnapshotSaveOptions struct {
+	file string
+
+	SnapshotSourceOptions
+	genericclioptions.IOStreams
+}
+
+var (
+	snapshotSaveExample = `
+	# save the state of all prod contexts before a maintenance
+	%[1]s snapshot save before.json --context=prod
+
+	# compare it with the current state after the maintenance
+	%[1]s diff --since before.json
+`
+)
+
+// NewCmdSnapshot creates the snapshot cmd
+func NewCmdSnapshot(streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Record the correlated state of volumes, server and lb to compare it later via diff",
+		RunE: func(c *cobra.Command, args []string) error {
+			return fmt.Errorf("subcommand is mandatory")
+		},
+	}
+	cmd.AddCommand(NewCmdSnapshotSave(streams))
+	return cmd
+}
+
+// NewCmdSnapshotSave creates the snapshot save cmd
+func NewCmdSnapshotSave(streams genericclioptions.IOStreams) *cobra.Command {
+	o := &SnapshotSaveOptions{
+		SnapshotSourceOptions: SnapshotSourceOptions{configFlags: genericclioptions.NewConfigFlags(true)},
+		IOStreams:             streams,
+	}
+	cmd := &cobra.Command{
+		Use:          "save <file>",
+		Short:        "Save the correlated state of volumes, server and lb to a file",
+		Example:      fmt.Sprintf(snapshotSaveExample, "kubectl openstack"),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	o.SnapshotSourceOptions.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// Complete sets all necessary fields in SnapshotSaveOptions
+func (o *SnapshotSaveOptions) Complete(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one file is required, got %d", len(args))
+	}
+	o.file = args[0]
+	return o.SnapshotSourceOptions.Complete(cmd)
+}
+
+// Run saves the snapshot of all matching contexts
+func (o *SnapshotSaveOptions) Run() error {
+	contexts, err := o.contexts(nil)
+	if err != nil {
+		return err
+	}
+
+	snapshot, results := o.takeSnapshot(contexts)
+	if len(snapshot.Contexts) > 0 {
+		content, err := json.MarshalIndent(snapshot, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling snapshot: %v", err)
+		}
+		if err := ioutil.WriteFile(o.file, content, 0644); err != nil {
+			return fmt.Errorf("error writing snapshot %s: %v", o.file, err)
+		}
+		fmt.Fprintf(o.Out, "Saved snapshot of %d contexts to %s\n", len(snapshot.Contexts), o.file)
+	}
+	if len(contexts) > 1 {
+		printSummary(o.ErrOut, results)
+	}
+	return failedContexts(results)
+}
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+	"sigs.k8s.io/yaml"
+)
+
+const volumeFixPlanKind = "VolumeFixPlan"
+
+// actions of the steps of a plan
+const (
+	actionDetachNova        = "detach-nova"
+	actionForceDetachCinder = "force-detach-cinder"
+	actionAttachNova        = "attach-nova"
+)
+
+// VolumeFixPlan are the steps which fix the broken volumes of a context
+type VolumeFixPlan struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Context    string      `json:"context"`
+	Cloud      string      `json:"cloud"`
+	Time       time.Time   `json:"time"`
+	Volumes    []VolumeFix `json:"volumes"`
+}
+
+// VolumeFix are the ordered steps which fix a volume. Status and CinderServerIDs are the state
+// of the volume the steps have been planned for.
+type VolumeFix struct {
+	ID              string          `json:"id"`
+	Name            string          `json:"name"`
+	PVC             string          `json:"pvc,omitempty"`
+	PodNode         string          `json:"podNode,omitempty"`
+	Status          string          `json:"status"`
+	CinderServerIDs []string        `json:"cinderServerIDs,omitempty"`
+	Notes           []string        `json:"notes,omitempty"`
+	Steps           []VolumeFixStep `json:"steps,omitempty"`
+	// Skipped is the reason why the volume can't be fixed automatically
+	Skipped string `json:"skipped,omitempty"`
+	// BarePods are the pods using the volume without a controller, --safe only evicts them with
+	// --evict-bare-pods and they are lost
+	BarePods []string `json:"barePods,omitempty"`
+}
+
+// VolumeFixStep is an attach or detach of a volume
+type VolumeFixStep struct {
+	Action     string `json:"action"`
+	ServerID   string `json:"serverID,omitempty"`
+	ServerName string `json:"serverName,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// planVolumeFixes plans the fixes of the volumes of the records which have notes. The records are
+// grouped by volume, volumes which don't need any step are omitted.
+func planVolumeFixes(records []VolumeRecord, serversMap map[string]servers.Server) []VolumeFix {
+	var ids []string
+	recordsByVolume := map[string][]VolumeRecord{}
+	for _, r := range records {
+		if len(r.Notes) == 0 {
+			continue
+		}
+		if _, ok := recordsByVolume[r.Cinder.ID]; !ok {
+			ids = append(ids, r.Cinder.ID)
+		}
+		recordsByVolume[r.Cinder.ID] = append(recordsByVolume[r.Cinder.ID], r)
+	}
+	sort.Strings(ids)
+
+	var fixes []VolumeFix
+	for _, id := range ids {
+		fix := planVolumeFix(recordsByVolume[id], serversMap)
+		if len(fix.Steps) > 0 || fix.Skipped != "" {
+			fixes = append(fixes, fix)
+		}
+	}
+	return fixes
+}
+
+// planVolumeFix plans the fix of a volume based on its records, there is one record per pod.
+// The volume should only be attached to the server of the node its running pod is scheduled to
+// or to no server at all if there is no running pod. The steps are: detach the stale attachments
+// in Nova, force-detach the volume in Cinder and re-attach it via Nova to the server of the pod.
+// If the attachment to the server of the pod is consistent in Nova and Cinder, only the stale
+// Nova attachments are detached.
+func planVolumeFix(records []VolumeRecord, serversMap map[string]servers.Server) VolumeFix {
+	r := records[0]
+	fix := VolumeFix{ID: r.Cinder.ID, Name: r.Cinder.Name, PVC: r.PVC, Status: r.Cinder.Status}
+	for _, a := range r.Cinder.Attachments {
+		fix.CinderServerIDs = append(fix.CinderServerIDs, a.ID)
+	}
+
+	var nodes []string
+	for _, record := range records {
+		for _, note := range record.Notes {
+			if !containsString(fix.Notes, note) {
+				fix.Notes = append(fix.Notes, note)
+			}
+		}
+		if record.PodNode != "" && record.PodStatus != "Completed" && !containsString(nodes, record.PodNode) {
+			nodes = append(nodes, record.PodNode)
+		}
+		if record.Objects != nil && record.Objects.Pod != nil && record.PodStatus != "Completed" && isBarePod(*record.Objects.Pod) {
+			fix.BarePods = append(fix.BarePods, fmt.Sprintf("%s/%s", record.Objects.Pod.Namespace, record.Objects.Pod.Name))
+		}
+	}
+	if r.PVC == "" {
+		fix.Skipped = "volume is not used by a pv, it has to be fixed manually"
+		return fix
+	}
+	if len(nodes) > 1 {
+		fix.Skipped = fmt.Sprintf("volume is used by pods on multiple nodes: %s", strings.Join(nodes, ", "))
+		return fix
+	}
+
+	desired := ""
+	if len(nodes) == 1 {
+		fix.PodNode = nodes[0]
+		for _, srv := range serversMap {
+			if srv.Name == nodes[0] {
+				desired = srv.ID
+				break
+			}
+		}
+		if desired == "" {
+			fix.Skipped = fmt.Sprintf("node %s of the pod is not a server of the cloud", nodes[0])
+			return fix
+		}
+	}
+
+	novaCount := map[string]int{}
+	var novaServerIDs []string
+	for _, a := range r.Nova {
+		novaCount[a.ServerID] += a.Count
+		novaServerIDs = append(novaServerIDs, a.ServerID)
+	}
+	sort.Strings(novaServerIDs)
+	serverName := func(id string) string {
+		return serversMap[id].Name
+	}
+
+	keep := desired != "" && novaCount[desired] == 1 && len(fix.CinderServerIDs) == 1 && fix.CinderServerIDs[0] == desired
+	for _, id := range novaServerIDs {
+		switch {
+		case id != desired:
+			reason := fmt.Sprintf("volume is attached to %s in Nova but no running pod uses it", orDash(serverName(id)))
+			if desired != "" {
+				reason = fmt.Sprintf("volume is attached to %s in Nova but the pod runs on %s", orDash(serverName(id)), fix.PodNode)
+			}
+			fix.Steps = append(fix.Steps, VolumeFixStep{Action: actionDetachNova, ServerID: id, ServerName: serverName(id), Reason: reason})
+		case !keep:
+			fix.Steps = append(fix.Steps, VolumeFixStep{Action: actionDetachNova, ServerID: id, ServerName: serverName(id), Reason: fmt.Sprintf("attachment to %s is inconsistent (%dx in Nova), it is re-created", fix.PodNode, novaCount[id])})
+		}
+	}
+	if keep {
+		return fix
+	}
+
+	if len(fix.CinderServerIDs) > 0 {
+		fix.Steps = append(fix.Steps, VolumeFixStep{Action: actionForceDetachCinder, Reason: fmt.Sprintf("Cinder attachments to %s are stale", strings.Join(cinderServerNames(r), ", "))})
+	} else if fix.Status != "available" {
+		fix.Steps = append(fix.Steps, VolumeFixStep{Action: actionForceDetachCinder, Reason: fmt.Sprintf("volume is %s in Cinder without attachments", fix.Status)})
+	}
+	if desired != "" {
+		fix.Steps = append(fix.Steps, VolumeFixStep{Action: actionAttachNova, ServerID: desired, ServerName: serverName(desired), Reason: fmt.Sprintf("the pod runs on %s", fix.PodNode)})
+	}
+	return fix
+}
+
+// withoutAttachNova returns the fix without its attach-nova step. With --safe the pods of the
+// volume are stopped and the restored pod can be scheduled to another node, so the volume is
+// attached by Kubernetes instead. A volume attached manually would be in-use for the other node
+// and Kubernetes never detaches it.
+func withoutAttachNova(fix VolumeFix) VolumeFix {
+	var steps []VolumeFixStep
+	for _, step := range fix.Steps {
+		if step.Action != actionAttachNova {
+			steps = append(steps, step)
+		}
+	}
+	fix.Steps = steps
+	return fix
+}
+
+func cinderServerNames(r VolumeRecord) []string {
+	names, _ := r.cinderServers()
+	return names
+}
+
+// hasAction returns true if one of the steps has the action
+func hasAction(steps []VolumeFixStep, action string) bool {
+	for _, s := range steps {
+		if s.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// getPrettyPlan renders the steps of the plan as table with one line per step. The pods without a
+// controller which are lost if they are evicted by --safe are listed below the table.
+func getPrettyPlan(plan *VolumeFixPlan, format string, noHeader bool) (string, error) {
+	var header []string
+	if !noHeader {
+		header = []string{"VOLUME", "VOLUME_ID", "PVC", "POD_NODE", "STEP", "ACTION", "SERVER", "REASON"}
+	}
+
+	var lines [][]string
+	var barePods []string
+	for _, v := range plan.Volumes {
+		if v.Skipped != "" {
+			lines = append(lines, []string{v.Name, v.ID, orDash(v.PVC), orDash(v.PodNode), "-", "skip", "-", v.Skipped})
+			continue
+		}
+		for i, s := range v.Steps {
+			lines = append(lines, []string{v.Name, v.ID, orDash(v.PVC), orDash(v.PodNode), strconv.Itoa(i + 1), s.Action, orDash(s.ServerName), s.Reason})
+		}
+		if len(v.BarePods) > 0 {
+			barePods = append(barePods, fmt.Sprintf("Volume %s is used by pods without a controller: %s. --safe only evicts them with --evict-bare-pods, they are lost and not re-created.\n", v.Name, strings.Join(v.BarePods, ", ")))
+		}
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	out, err := output.ConvertToTable(output.Table{Header: header, Lines: lines, SortIndices: []int{0, 1, 4}, Output: format})
+	if err != nil {
+		return "", err
+	}
+	if len(barePods) > 0 {
+		out += "\n" + strings.Join(barePods, "")
+	}
+	return out, nil
+}
+
+// marshalPlan renders the plan as json or yaml, so it can be reviewed and applied via --apply-plan
+func marshalPlan(plan *VolumeFixPlan, format string) (string, error) {
+	var content []byte
+	var err error
+	if format == "json" {
+		content, err = json.MarshalIndent(plan, "", "  ")
+		content = append(content, '\n')
+	} else {
+		content, err = yaml.Marshal(plan)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error marshalling plan: %v", err)
+	}
+	return string(content), nil
+}
+
+// loadPlan reads a plan written via --plan -o json or -o yaml
+func loadPlan(file string) (*VolumeFixPlan, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan %s: %v", file, err)
+	}
+	plan := &VolumeFixPlan{}
+	if err := yaml.Unmarshal(content, plan); err != nil {
+		return nil, fmt.Errorf("error parsing plan %s: %v", file, err)
+	}
+	if plan.Kind != volumeFixPlanKind {
+		return nil, fmt.Errorf("error parsing plan %s: expected kind %s, got %q", file, volumeFixPlanKind, plan.Kind)
+	}
+	for _, v := range plan.Volumes {
+		for _, s := range v.Steps {
+			switch s.Action {
+			case actionDetachNova, actionAttachNova:
+				if s.ServerID == "" {
+					return nil, fmt.Errorf("error parsing plan %s: step %s of volume %s has no server", file, s.Action, v.ID)
+				}
+			case actionForceDetachCinder:
+			default:
+				return nil, fmt.Errorf("error parsing plan %s: unknown action %q of volume %s", file, s.Action, v.ID)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// verifyPlan returns an error if the status or the Cinder attachments of a volume changed since
+// the plan has been created
+func verifyPlan(plan *VolumeFixPlan, volumesMap map[string]volumes.Volume) error {
+	for _, fix := range plan.Volumes {
+		if len(fix.Steps) == 0 || fix.Skipped != "" {
+			continue
+		}
+		v, ok := volumesMap[fix.ID]
+		if !ok {
+			return fmt.Errorf("volume %s of the plan not found", fix.ID)
+		}
+		var cinderServerIDs []string
+		for _, a := range v.Attachments {
+			cinderServerIDs = append(cinderServerIDs, a.ServerID)
+		}
+		if v.Status != fix.Status || strings.Join(cinderServerIDs, ",") != strings.Join(fix.CinderServerIDs, ",") {
+			return fmt.Errorf("volume %s changed since the plan has been created (status %s, attached to %v in Cinder), create a new plan", fix.ID, v.Status, cinderServerIDs)
+		}
+	}
+	return nil
+}
+
+// applyStep executes a step of a plan
+func applyStep(osProvider *openstack.Client, volumeID string, step VolumeFixStep) error {
+	switch step.Action {
+	case actionDetachNova:
+		return openstack.DetachVolumeNova(osProvider, volumeID, step.ServerID)
+	case actionForceDetachCinder:
+		return openstack.DetachVolumeCinder(osProvider, volumeID, true)
+	case actionAttachNova:
+		return openstack.AttachVolumeNova(osProvider, volumeID, step.ServerID)
+	}
+	return fmt.Errorf("unknown action %q", step.Action)
+}
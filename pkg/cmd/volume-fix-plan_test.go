@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPlanVolumeFix(t *testing.T) {
+	serversMap := map[string]servers.Server{
+		"s1": {ID: "s1", Name: "node-1"},
+		"s2": {ID: "s2", Name: "node-2"},
+	}
+	notes := []string{"broken"}
+	barePod := &VolumeObjects{Pod: &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "debug"}}}
+
+	tests := []struct {
+		name    string
+		records  []VolumeRecord
+		steps    []string
+		skipped  bool
+		barePods []string
+	}{
+		{
+			name: "stale nova attachment",
+			records: []VolumeRecord{{PVC: "ns/pvc", PodNode: "node-1", PodStatus: "Running", Notes: notes,
+				Cinder: CinderVolumeRecord{ID: "v1", Status: "in-use", Attachments: []ServerReference{{ID: "s1", Name: "node-1"}}},
+				Nova:   []NovaAttachmentRecord{{ServerID: "s1", Count: 1}, {ServerID: "s2", Count: 1}}}},
+			steps: []string{"detach-nova s2"},
+		},
+		{
+			name: "cinder attached to old node",
+			records: []VolumeRecord{{PVC: "ns/pvc", PodNode: "node-1", PodStatus: "ContainerCreating", Notes: notes,
+				Cinder: CinderVolumeRecord{ID: "v1", Status: "in-use", Attachments: []ServerReference{{ID: "s2", Name: "node-2"}}},
+				Nova:   []NovaAttachmentRecord{{ServerID: "s2", Count: 1}}}},
+			steps: []string{"detach-nova s2", "force-detach-cinder ", "attach-nova s1"},
+		},
+		{
+			name: "pod without controller",
+			records: []VolumeRecord{{PVC: "ns/pvc", PodNode: "node-1", PodStatus: "Running", Notes: notes, Objects: barePod,
+				Cinder: CinderVolumeRecord{ID: "v1", Status: "in-use", Attachments: []ServerReference{{ID: "s2", Name: "node-2"}}},
+				Nova:   []NovaAttachmentRecord{{ServerID: "s2", Count: 1}}}},
+			steps:    []string{"detach-nova s2", "force-detach-cinder ", "attach-nova s1"},
+			barePods: []string{"ns/debug"},
+		},
+		{
+			name: "multiple attachments to the node of the pod",
+			records: []VolumeRecord{{PVC: "ns/pvc", PodNode: "node-1", PodStatus: "Running", Notes: notes,
+				Cinder: CinderVolumeRecord{ID: "v1", Status: "in-use", Attachments: []ServerReference{{ID: "s1", Name: "node-1"}}},
+				Nova:   []NovaAttachmentRecord{{ServerID: "s1", Count: 2}}}},
+			steps: []string{"detach-nova s1", "force-detach-cinder ", "attach-nova s1"},
+		},
+		{
+			name: "in-use without pod and attachments",
+			records: []VolumeRecord{{PVC: "ns/pvc", Notes: notes,
+				Cinder: CinderVolumeRecord{ID: "v1", Status: "in-use"}}},
+			steps: []string{"force-detach-cinder "},
+		},
+		{
+			name: "no pv",
+			records: []VolumeRecord{{Notes: notes,
+				Cinder: CinderVolumeRecord{ID: "v1", Status: "in-use", Attachments: []ServerReference{{ID: "s1", Name: "node-1"}}}}},
+			skipped: true,
+		},
+		{
+			name: "pods on multiple nodes",
+			records: []VolumeRecord{
+				{PVC: "ns/pvc", PodNode: "node-1", PodStatus: "Running", Notes: notes, Cinder: CinderVolumeRecord{ID: "v1", Status: "in-use"}},
+				{PVC: "ns/pvc", PodNode: "node-2", PodStatus: "Running", Notes: notes, Cinder: CinderVolumeRecord{ID: "v1", Status: "in-use"}},
+			},
+			skipped: true,
+		},
+	}
+	for _, tt := range tests {
+		fix := planVolumeFix(tt.records, serversMap)
+		if (fix.Skipped != "") != tt.skipped {
+			t.Errorf("%s: unexpected skipped reason %q", tt.name, fix.Skipped)
+		}
+		var steps []string
+		for _, s := range fix.Steps {
+			steps = append(steps, s.Action+" "+s.ServerID)
+		}
+		if !reflect.DeepEqual(steps, tt.steps) {
+			t.Errorf("%s: expected steps %v, got %v", tt.name, tt.steps, steps)
+		}
+		if !reflect.DeepEqual(fix.BarePods, tt.barePods) {
+			t.Errorf("%s: expected bare pods %v, got %v", tt.name, tt.barePods, fix.BarePods)
+		}
+	}
+}
+
+func TestWithoutAttachNova(t *testing.T) {
+	serversMap := map[string]servers.Server{
+		"s1": {ID: "s1", Name: "node-1"},
+		"s2": {ID: "s2", Name: "node-2"},
+	}
+	// the pod is stopped by --safe, so the volume is only detached and attached by Kubernetes
+	// to the node of the restored pod
+	fix := planVolumeFix([]VolumeRecord{{PVC: "ns/pvc", PodNode: "node-1", PodStatus: "ContainerCreating", Notes: []string{"broken"},
+		Cinder: CinderVolumeRecord{ID: "v1", Status: "in-use", Attachments: []ServerReference{{ID: "s2", Name: "node-2"}}},
+		Nova:   []NovaAttachmentRecord{{ServerID: "s2", Count: 1}}}}, serversMap)
+	var steps []string
+	for _, s := range withoutAttachNova(fix).Steps {
+		steps = append(steps, s.Action+" "+s.ServerID)
+	}
+	if expected := []string{"detach-nova s2", "force-detach-cinder "}; !reflect.DeepEqual(steps, expected) {
+		t.Errorf("expected steps %v, got %v", expected, steps)
+	}
+	if len(fix.Steps) != 3 {
+		t.Errorf("expected the steps of the plan to be unchanged, got %v", fix.Steps)
+	}
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/audit"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "k8s.io/client-go/kubernetes"
+)
+
+// safeFix stops the pods using a volume before the volume is changed and restores them afterwards,
+// see --safe. Pods of StatefulSets and Deployments are stopped by scaling them to zero, other
+// pods are evicted after their node has been cordoned. Pods without a controller are lost when
+// they are evicted, so they are only evicted with evictBarePods. Every change is printed and
+// recorded in the audit log.
+type safeFix struct {
+	kubeClient    kubeclient.Interface
+	out           io.Writer
+	audit         *audit.Log
+	dryRun        bool
+	timeout       time.Duration
+	evictBarePods bool
+
+	volumeID string
+	// pvc is the claim of the pv of the volume, nil if the volume has no pv
+	pvc *v1.ObjectReference
+	// workloads are the scaled down workloads with their original replicas
+	workloads []kubernetes.Workload
+	// cordoned are the nodes which have been cordoned
+	cordoned []string
+}
+
+// pvcOfVolume returns the claim of the pv of the volume, nil if the volume has no bound pv
+func pvcOfVolume(inv *inventory.Inventory, volumeID string) *v1.ObjectReference {
+	pv, ok := kubernetes.PersistentVolumesByVolumeID(inv.Kubernetes.PersistentVolumes)[volumeID]
+	if !ok {
+		return nil
+	}
+	return pv.Spec.ClaimRef
+}
+
+// podsOfVolume returns the pods using the volume via its pv and pvc which are not terminated
+func podsOfVolume(inv *inventory.Inventory, volumeID string) []v1.Pod {
+	pvc := pvcOfVolume(inv, volumeID)
+	if pvc == nil {
+		return nil
+	}
+	var pods []v1.Pod
+	for _, pod := range kubernetes.PodsByPVC(inv.Kubernetes.Pods)[fmt.Sprintf("%s/%s", pvc.Namespace, pvc.Name)] {
+		if pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+// stop scales down the workloads of the pods or evicts them and waits until they are terminated.
+// Afterwards the pods using the pvc are listed again, so pods which have been re-created by a
+// controller which isn't scaled down, e.g. a DaemonSet, abort the fix.
+func (s *safeFix) stop(pods []v1.Pod) error {
+	// nothing is changed before it's clear that all pods can be stopped
+	var workloads []kubernetes.Workload
+	var evict []v1.Pod
+	for _, pod := range pods {
+		workload, err := kubernetes.GetWorkload(s.kubeClient, pod)
+		if err != nil {
+			return err
+		}
+		if workload != nil {
+			workloads = append(workloads, *workload)
+			continue
+		}
+		if isBarePod(pod) && !s.evictBarePods {
+			return fmt.Errorf("pod %s/%s of volume %s has no controller and would be lost, use --evict-bare-pods to evict it anyway", pod.Namespace, pod.Name, s.volumeID)
+		}
+		evict = append(evict, pod)
+	}
+
+	for _, workload := range workloads {
+		if s.scaledDown(workload) {
+			continue
+		}
+		if err := s.scale(workload, workload.Replicas, 0, "scale-workload"); err != nil {
+			return err
+		}
+		s.workloads = append(s.workloads, workload)
+	}
+
+	for _, pod := range evict {
+		if pod.Spec.NodeName != "" && !containsString(s.cordoned, pod.Spec.NodeName) {
+			unschedulable, err := kubernetes.IsUnschedulable(s.kubeClient, pod.Spec.NodeName)
+			if err != nil {
+				return err
+			}
+			// nodes which are already cordoned are not uncordoned afterwards
+			if !unschedulable {
+				if err := s.setUnschedulable(pod.Spec.NodeName, true, "cordon-node"); err != nil {
+					return err
+				}
+				s.cordoned = append(s.cordoned, pod.Spec.NodeName)
+			}
+		}
+		if isBarePod(pod) {
+			s.printf("Evicting pod %s/%s, it has no controller and is lost\n", pod.Namespace, pod.Name)
+		} else {
+			s.printf("Evicting pod %s/%s\n", pod.Namespace, pod.Name)
+		}
+		if s.dryRun {
+			continue
+		}
+		if err := kubernetes.EvictPod(s.kubeClient, pod); err != nil {
+			return err
+		}
+		if err := s.record("evict-pod", audit.KubernetesChange{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name}); err != nil {
+			return err
+		}
+	}
+
+	if s.dryRun {
+		return nil
+	}
+	if len(pods) > 0 {
+		s.printf("Waiting until the pods of volume %s are terminated\n", s.volumeID)
+		if err := kubernetes.WaitForPodsDeleted(s.kubeClient, pods, s.timeout, waitInterval); err != nil {
+			return err
+		}
+	}
+	return s.verifyStopped()
+}
+
+// verifyStopped returns an error if a pod which isn't terminated still uses the pvc of the volume
+func (s *safeFix) verifyStopped() error {
+	if s.pvc == nil {
+		return nil
+	}
+	pods, err := kubernetes.ListPodsOfPVC(s.kubeClient, s.pvc.Namespace, s.pvc.Name)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+	var names []string
+	for _, pod := range pods {
+		names = append(names, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+	}
+	return fmt.Errorf("pods %s still use pvc %s/%s of volume %s after stopping, they have probably been re-created by a controller which isn't scaled down", strings.Join(names, ", "), s.pvc.Namespace, s.pvc.Name, s.volumeID)
+}
+
+// isBarePod returns true if the pod has no controller which re-creates it
+func isBarePod(pod v1.Pod) bool {
+	return metav1.GetControllerOf(&pod) == nil
+}
+
+// restore restores the replicas of the workloads and uncordons the nodes. Everything is restored
+// even if a step fails, the error lists what has to be restored manually.
+func (s *safeFix) restore() error {
+	var failed []string
+	for _, w := range s.workloads {
+		if err := s.scale(w, 0, w.Replicas, "restore-workload"); err != nil {
+			failed = append(failed, fmt.Sprintf("%v (restore %s to %d replicas)", err, w, w.Replicas))
+		}
+	}
+	for _, node := range s.cordoned {
+		if err := s.setUnschedulable(node, false, "uncordon-node"); err != nil {
+			failed = append(failed, fmt.Sprintf("%v (uncordon node %s)", err, node))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("error restoring the pods of volume %s: %s", s.volumeID, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (s *safeFix) scaledDown(w kubernetes.Workload) bool {
+	for _, scaled := range s.workloads {
+		if scaled.Kind == w.Kind && scaled.Namespace == w.Namespace && scaled.Name == w.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *safeFix) scale(w kubernetes.Workload, from, to int32, action string) error {
+	s.printf("Scaling %s from %d to %d replicas\n", w, from, to)
+	if s.dryRun {
+		return nil
+	}
+	if err := kubernetes.ScaleWorkload(s.kubeClient, w, to); err != nil {
+		return err
+	}
+	return s.record(action, audit.KubernetesChange{Kind: w.Kind, Namespace: w.Namespace, Name: w.Name, Field: "spec.replicas", Before: strconv.Itoa(int(from)), After: strconv.Itoa(int(to))})
+}
+
+func (s *safeFix) setUnschedulable(node string, unschedulable bool, action string) error {
+	s.printf("Setting node %s unschedulable to %t\n", node, unschedulable)
+	if s.dryRun {
+		return nil
+	}
+	if err := kubernetes.SetUnschedulable(s.kubeClient, node, unschedulable); err != nil {
+		return err
+	}
+	return s.record(action, audit.KubernetesChange{Kind: "Node", Name: node, Field: "spec.unschedulable", Before: strconv.FormatBool(!unschedulable), After: strconv.FormatBool(unschedulable)})
+}
+
+func (s *safeFix) printf(format string, a ...interface{}) {
+	if s.dryRun {
+		format = "(dry run) " + format
+	}
+	fmt.Fprintf(s.out, format, a...)
+}
+
+func (s *safeFix) record(action string, change audit.KubernetesChange) error {
+	return s.audit.Record(audit.Entry{Action: action, VolumeID: s.volumeID, Kubernetes: &change})
+}
+
+// safely runs fix. With --safe the pods using the volume are stopped before and restored after fix.
+func (o *VolumesFixOptions) safely(osProvider *openstack.Client, inv *inventory.Inventory, volumeID string, fix func() error) error {
+	if !o.safe {
+		return fix()
+	}
+
+	s := &safeFix{
+		kubeClient:    o.kubeClient,
+		out:           o.Out,
+		audit:         osProvider.Audit,
+		dryRun:        o.dryRun,
+		timeout:       o.timeout,
+		evictBarePods: o.evictBarePods,
+		volumeID:      volumeID,
+		pvc:           pvcOfVolume(inv, volumeID),
+	}
+	err := s.stop(podsOfVolume(inv, volumeID))
+	if err == nil {
+		err = fix()
+	}
+	if restoreErr := s.restore(); restoreErr != nil {
+		if err != nil {
+			return fmt.Errorf("%v, %v", err, restoreErr)
+		}
+		return restoreErr
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSafeFix(t *testing.T) {
+	three := int32(3)
+	controller := true
+	kubeClient := fake.NewSimpleClientset(
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db"}, Spec: appsv1.StatefulSetSpec{Replicas: &three}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+	)
+	// the pods are already terminated, so stop doesn't have to wait
+	pods := []v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db-0", OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "db", Controller: &controller}}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "debug"}, Spec: v1.PodSpec{NodeName: "node-1"}},
+	}
+
+	pvc := &v1.ObjectReference{Namespace: "ns", Name: "data"}
+
+	// the bare pod debug is lost if it's evicted, so nothing is changed without --evict-bare-pods
+	s := &safeFix{kubeClient: kubeClient, out: ioutil.Discard, timeout: time.Second, volumeID: "v1", pvc: pvc}
+	if err := s.stop(pods); err == nil || !strings.Contains(err.Error(), "--evict-bare-pods") {
+		t.Fatalf("expected error for bare pod, got %v", err)
+	}
+	assertState(t, kubeClient, 3, false)
+
+	s = &safeFix{kubeClient: kubeClient, out: ioutil.Discard, timeout: time.Second, evictBarePods: true, volumeID: "v1", pvc: pvc}
+	if err := s.stop(pods); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertState(t, kubeClient, 0, true)
+
+	if err := s.restore(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertState(t, kubeClient, 3, false)
+
+	// a pod re-created by a ReplicaSet without Deployment still uses the pvc after stopping
+	if _, err := kubeClient.CoreV1().Pods("ns").Create(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "worker-abc", OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "worker", Controller: &controller}}},
+		Spec:       v1.PodSpec{Volumes: []v1.Volume{{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}}}},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s = &safeFix{kubeClient: kubeClient, out: ioutil.Discard, timeout: time.Second, evictBarePods: true, volumeID: "v1", pvc: pvc}
+	if err := s.stop(pods); err == nil || !strings.Contains(err.Error(), "ns/worker-abc") {
+		t.Fatalf("expected error for pod still using the pvc, got %v", err)
+	}
+	if err := s.restore(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertState(t, kubeClient, 3, false)
+}
+
+func assertState(t *testing.T, kubeClient *fake.Clientset, replicas int32, unschedulable bool) {
+	sts, err := kubeClient.AppsV1().StatefulSets("ns").Get("db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *sts.Spec.Replicas != replicas {
+		t.Errorf("expected %d replicas, got %d", replicas, *sts.Spec.Replicas)
+	}
+	node, err := kubeClient.CoreV1().Nodes().Get("node-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if node.Spec.Unschedulable != unschedulable {
+		t.Errorf("expected node unschedulable %t, got %t", unschedulable, node.Spec.Unschedulable)
+	}
+}
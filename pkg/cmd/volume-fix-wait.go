@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+)
+
+// actions of the flags which are not used in plans
+const (
+	actionAttachCinder     = "attach-cinder"
+	actionDetachCinder     = "detach-cinder"
+	actionResetStatus      = "reset-status"
+	actionDeleteAttachment = "delete-attachment"
+)
+
+// waitInterval is the interval in which the volume is polled with --wait
+const waitInterval = 2 * time.Second
+
+// expectedState returns the check of the state a volume has to reach after the action. The check
+// describes which side, Cinder or Nova, diverges from the expected state. The Cinder attachments
+// are not checked after a Nova detach if checkCinder is false, e.g. because the volume is
+// force-detached in Cinder afterwards.
+func expectedState(action, serverID, serverName string, checkCinder bool) func(state openstack.VolumeState) string {
+	return func(state openstack.VolumeState) string {
+		v := state.Volume
+		var cinderServerIDs []string
+		cinderAttached := false
+		for _, a := range v.Attachments {
+			cinderServerIDs = append(cinderServerIDs, a.ServerID)
+			if a.ServerID == serverID {
+				cinderAttached = true
+			}
+		}
+
+		switch action {
+		case actionAttachNova, actionAttachCinder:
+			if action == actionAttachNova && !state.NovaAttached {
+				return fmt.Sprintf("volume is not attached to %s in Nova", serverName)
+			}
+			if !cinderAttached {
+				return fmt.Sprintf("volume is not attached to %s in Cinder", serverName)
+			}
+			if v.Status != "in-use" {
+				return fmt.Sprintf("volume is %s in Cinder instead of in-use", v.Status)
+			}
+		case actionDetachNova:
+			if state.NovaAttached {
+				return fmt.Sprintf("volume is still attached to %s in Nova", serverName)
+			}
+			if checkCinder && cinderAttached {
+				return fmt.Sprintf("volume is still attached to %s in Cinder", serverName)
+			}
+			if v.Status == "attaching" || v.Status == "detaching" {
+				return fmt.Sprintf("volume is %s in Cinder", v.Status)
+			}
+		case actionDetachCinder, actionForceDetachCinder:
+			if len(cinderServerIDs) > 0 {
+				return fmt.Sprintf("volume is still attached to %s in Cinder", strings.Join(cinderServerIDs, ", "))
+			}
+			if v.Status != "available" {
+				return fmt.Sprintf("volume is %s in Cinder instead of available", v.Status)
+			}
+		}
+		return ""
+	}
+}
+
+// expectedStatus returns the check of the Cinder status of a volume after it has been reset
+func expectedStatus(status string) func(state openstack.VolumeState) string {
+	return func(state openstack.VolumeState) string {
+		if status != "" && state.Volume.Status != status {
+			return fmt.Sprintf("volume is %s in Cinder instead of %s", state.Volume.Status, status)
+		}
+		return ""
+	}
+}
+
+// expectedAttachmentDeleted returns the check that the attachment record is gone from the volume
+func expectedAttachmentDeleted(attachmentID string) func(state openstack.VolumeState) string {
+	return func(state openstack.VolumeState) string {
+		for _, a := range state.Volume.Attachments {
+			if a.AttachmentID == attachmentID {
+				return fmt.Sprintf("attachment %s of the volume still exists in Cinder", attachmentID)
+			}
+		}
+		return ""
+	}
+}
+
+// waitFor waits until the volume reached the expected state after the action if --wait is set
+func (o *VolumesFixOptions) waitFor(osProvider *openstack.Client, volumeID, action, serverID, serverName string, checkCinder bool) error {
+	// Nova is only polled if the action changed the attachments in Nova
+	novaServerID := ""
+	if action == actionAttachNova || action == actionDetachNova {
+		novaServerID = serverID
+	}
+	return o.waitUntil(osProvider, volumeID, action, novaServerID, expectedState(action, serverID, serverName, checkCinder))
+}
+
+// waitUntil waits until check doesn't report a divergence anymore if --wait is set
+func (o *VolumesFixOptions) waitUntil(osProvider *openstack.Client, volumeID, action, novaServerID string, check func(state openstack.VolumeState) string) error {
+	if !o.wait || o.dryRun {
+		return nil
+	}
+	fmt.Fprintf(o.Out, "Waiting for %s of volume %s\n", action, volumeID)
+	return openstack.WaitForVolume(osProvider, volumeID, novaServerID, o.timeout, waitInterval, check)
+}
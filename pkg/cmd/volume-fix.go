@@ -1,13 +1,24 @@
 package cmd
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
+	"time"
+
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/audit"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/cache"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	kubeclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -24,7 +35,36 @@ type VolumesFixOptions struct {
 	attachNova             string
 	attachCinder           string
 	attachCinderMountpoint string
+	resetStatus            string
+	attachStatus           string
+	listAttachments        bool
+	// deleteAttachments are ids of Cinder attachment records or dangling
+	deleteAttachments []string
+
+	plan          bool
+	applyPlanFile string
+	output        string
+	noHeader      bool
+	// appliedPlan is the plan loaded from applyPlanFile
+	appliedPlan *VolumeFixPlan
+	dryRun      bool
+	yes         bool
+	wait        bool
+	timeout     time.Duration
+	// answers reads the answers to the confirmations from In
+	answers *bufio.Reader
+	// safe stops the pods using a volume before it's changed, see safeFix
+	safe bool
+	// evictBarePods evicts pods without a controller with --safe, they are lost
+	evictBarePods bool
+	// kubeClient is set if the state of the volumes includes the pods
+	kubeClient kubeclient.Interface
+	// auditFile is the file the requests which change volumes are recorded in, they are forwarded
+	// to the exporters of ExporterOptions
+	auditFile string
 
+	RuleOptions
+	ExporterOptions
 	genericclioptions.IOStreams
 }
 
@@ -35,6 +75,32 @@ var (
 	
 	# detach disk in Nova
 	%[1]s volumes-fix <volumes-id> --detach-nova
+
+	# reset a volume stuck in detaching
+	%[1]s volumes-fix <volumes-id> --reset-status=available --attach-status=detached
+
+	# list the attachment records in Cinder and delete those without server or Nova attachment
+	%[1]s volumes-fix <volumes-id> --list-attachments
+	%[1]s volumes-fix <volumes-id> --delete-attachment=dangling
+
+	# show the steps which fix all broken volumes
+	%[1]s volumes-fix --plan
+
+	# save the plan, review it and apply it
+	%[1]s volumes-fix --plan -o yaml > plan.yaml
+	%[1]s volumes-fix --apply-plan plan.yaml
+
+	# print the requests which would be sent
+	%[1]s volumes-fix <volumes-id> --detach-cinder --force --dry-run
+
+	# don't ask before each volume is changed
+	%[1]s volumes-fix --apply-plan plan.yaml --yes
+
+	# wait until Cinder and Nova show the volume as attached
+	%[1]s volumes-fix <volumes-id> --attach-nova <server> --wait --timeout 5m
+
+	# scale down the StatefulSet of the pod using the volume while the volume is re-attached
+	%[1]s volumes-fix --apply-plan plan.yaml --safe --wait
 `
 )
 
@@ -67,6 +133,8 @@ func NewCmdVolumesFix(streams genericclioptions.IOStreams) *cobra.Command {
 	// Nova: https://developer.openstack.org/api-ref/compute/?expanded=detach-a-volume-from-an-instance-detail#detach-a-volume-from-an-instance
 	// Cinder: https://developer.openstack.org/api-ref/block-storage/v3/index.html?expanded=detach-volume-from-server-detail#volume-actions-volumes-action
 	// https://raymii.org/s/articles/Fix_inconsistent_Openstack_volumes_and_instances_from_Cinder_and_Nova_via_the_database.html
+	// Cinder reset status: https://docs.openstack.org/api-ref/block-storage/v3/index.html#reset-a-volume-s-statuses
+	// Cinder attachments: https://docs.openstack.org/api-ref/block-storage/v3/index.html#attachments
 	cmd.Flags().BoolVarP(&o.detachCinder, "detach-cinder", "", false, "Detach the disk in Cinder. Be careful this does not remove the attachment from the server in Nova.")
 	cmd.Flags().StringVarP(&o.attachCinder, "attach-cinder", "", "", "server to which the volume to")
 	cmd.Flags().StringVarP(&o.attachCinderMountpoint, "attach-cinder-mountpoint", "", "", "")
@@ -74,12 +142,36 @@ func NewCmdVolumesFix(streams genericclioptions.IOStreams) *cobra.Command {
 	cmd.Flags().BoolVarP(&o.detachNova, "detach-nova", "", false, "Detach disk in Nova. This only works if the volume is really attached (so it doesn't when cinder shows no attachments to this server).")
 	cmd.Flags().StringVarP(&o.attachNova, "attach-nova", "", "", "server to which the volume to")
 	cmd.Flags().BoolVarP(&o.force, "force", "f", false, "Currently only affects detach-cinder. Use force-detach.")
+
+	cmd.Flags().StringVar(&o.resetStatus, "reset-status", "", "Reset the status of the volume in the Cinder database via os-reset_status, e.g. to available or in-use. This is done before attaching or detaching, nothing is changed on the servers.")
+	cmd.Flags().StringVar(&o.attachStatus, "attach-status", "", "Reset the attach status of the volume in the Cinder database via os-reset_status: attached or detached.")
+	cmd.Flags().BoolVar(&o.listAttachments, "list-attachments", false, "List the attachment records of the volumes via the Cinder attachments API (microversion 3.27 or higher).")
+	cmd.Flags().StringSliceVar(&o.deleteAttachments, "delete-attachment", nil, "Delete attachment records of the volumes via the Cinder attachments API (microversion 3.27 or higher) after attaching and detaching. Either ids or dangling for all records whose server doesn't exist or doesn't have the volume attached in Nova.")
+
+	cmd.Flags().BoolVar(&o.plan, "plan", false, "show the ordered steps which fix the broken volumes given as arguments or all broken volumes, nothing is changed")
+	cmd.Flags().StringVar(&o.applyPlanFile, "apply-plan", "", "execute the steps of a plan written via --plan -o yaml or -o json")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "output of --plan and --list-attachments: markdown, raw, json or yaml")
+	cmd.Flags().BoolVarP(&o.noHeader, "no-headers", "", false, "hide table headers")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", false, "print the requests (method, url and body) which would be sent to OpenStack instead of sending them")
+	cmd.Flags().BoolVarP(&o.yes, "yes", "y", false, "don't ask for confirmation before a volume is changed")
+	cmd.Flags().BoolVar(&o.wait, "wait", false, "wait after every attach and detach until the volume is in the expected state in Cinder and Nova")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", 3*time.Minute, "how long --wait waits for the expected state of a volume")
+	cmd.Flags().BoolVar(&o.safe, "safe", false, "stop the pods using a volume before it's changed and restore them afterwards: StatefulSets and Deployments are scaled to zero, other pods are evicted after cordoning their node")
+	cmd.Flags().BoolVar(&o.evictBarePods, "evict-bare-pods", false, "with --safe also evict pods without a controller, they are lost and not re-created")
+	cmd.Flags().StringVar(&o.auditFile, "audit-file", audit.DefaultFile(), "file every request which changes a volume is appended to as json line, an empty value disables the audit log")
+	cmd.Flags().StringVar(&o.exporter, "audit-exporter", "", fmt.Sprintf("forward every audit entry to the exporters: %s or multiple (comma-separated)", strings.Join(output.ExporterNames(), ", ")))
+	cmd.Flags().StringToStringVar(&o.exporterConfig, "exporter-config", map[string]string{}, "configuration of the audit exporters in the form <exporter>.<key>=<value>, e.g. mm.channel=alerts")
+	o.RuleOptions.AddSelectionFlags(cmd.Flags())
 	o.configFlags.AddFlags(cmd.Flags())
 	return cmd
 }
 
 // Complete sets als necessary fields in VolumeOptions
 func (o *VolumesFixOptions) Complete(cmd *cobra.Command, args []string) error {
+	// volumes can only be fixed based on their current state
+	if getFromDump(cmd) != "" {
+		return fmt.Errorf("--%s is not supported by %s", fromDumpFlag, cmd.Name())
+	}
 	o.args = args
 
 	var err error
@@ -87,21 +179,75 @@ func (o *VolumesFixOptions) Complete(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	if o.applyPlanFile != "" {
+		o.appliedPlan, err = loadPlan(o.applyPlanFile)
+		if err != nil {
+			return err
+		}
+	}
+	if err := o.ExporterOptions.Complete(o.Out); err != nil {
+		return err
+	}
+	return o.RuleOptions.Complete()
 }
 
 // Validate ensures that all required arguments and flag values are provided
 func (o *VolumesFixOptions) Validate() error {
-	if len(o.rawConfig.CurrentContext) == 0 {
+	if len(o.rawConfig.CurrentContext) == 0 && o.appliedPlan == nil {
 		return errNoContext
 	}
 
+	manual := o.detachCinder || o.detachNova || o.attachNova != "" || o.attachCinder != "" || o.resetStatus != "" || o.attachStatus != "" || len(o.deleteAttachments) > 0
+	if o.listAttachments && (manual || o.plan || o.appliedPlan != nil) {
+		return fmt.Errorf("--list-attachments can't be combined with --plan, --apply-plan or attach, detach and reset flags")
+	}
+	if o.listAttachments && len(o.args) == 0 {
+		return fmt.Errorf("--list-attachments requires at least one volume")
+	}
+	switch o.attachStatus {
+	case "", "attached", "detached":
+	default:
+		return fmt.Errorf("unknown attach status %s, --attach-status supports attached and detached", o.attachStatus)
+	}
+	if o.plan && (manual || o.appliedPlan != nil) {
+		return fmt.Errorf("--plan can't be combined with --apply-plan or attach and detach flags")
+	}
+	if o.appliedPlan != nil && (manual || len(o.args) > 0) {
+		return fmt.Errorf("--apply-plan can't be combined with volumes or attach and detach flags")
+	}
+	if o.safe && (o.plan || o.listAttachments) {
+		return fmt.Errorf("--safe can't be combined with --plan or --list-attachments")
+	}
+	if o.safe && (o.attachNova != "" || o.attachCinder != "") {
+		return fmt.Errorf("--safe can't be combined with --attach-nova or --attach-cinder, the volume is attached by Kubernetes when the pods are restored")
+	}
+	if o.evictBarePods && !o.safe {
+		return fmt.Errorf("--evict-bare-pods can only be used with --safe")
+	}
+	if o.plan && (o.dryRun || o.yes || o.wait) {
+		return fmt.Errorf("--plan doesn't change volumes, it can't be combined with --dry-run, --yes or --wait")
+	}
+	if (o.wait || o.safe) && o.timeout <= 0 {
+		return fmt.Errorf("--timeout has to be positive")
+	}
+	switch o.output {
+	case "markdown", "raw", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output %s, --plan and --list-attachments support markdown, raw, json and yaml", o.output)
+	}
 	return nil
 }
 
 // Run lists all volumes
 func (o *VolumesFixOptions) Run() error {
 	contexts := kubernetes.GetMatchingContexts(o.rawConfig, *o.configFlags.Context)
+	if o.appliedPlan != nil {
+		// the plan is applied in the context it has been created for
+		if *o.configFlags.Context != "" && !containsString(contexts, o.appliedPlan.Context) {
+			return fmt.Errorf("plan has been created for context %s", o.appliedPlan.Context)
+		}
+		contexts = []string{o.appliedPlan.Context}
+	}
 
 	if len(contexts) == 1 {
 		err := o.runWithConfig(contexts[0])
@@ -118,21 +264,41 @@ func (o *VolumesFixOptions) runWithConfig(context string) error {
 	if context == "" {
 		return fmt.Errorf("no context set")
 	}
+	if o.plan {
+		return o.createPlan(context)
+	}
 
-	osProvider, _, err := openstack.GetOpenStackClient(context)
+	// volumes are fixed based on the current state, so responses are not cached
+	osProvider, cloudName, err := openstack.GetOpenStackClient(context, o.rawConfig.Contexts[context], nil)
 	if err != nil {
 		return fmt.Errorf("error creating client: %v", err)
 	}
-
-	volumesMap, err := openstack.GetVolumes(osProvider)
-	if err != nil {
-		return fmt.Errorf("error getting volumes from OpenStack: %v", err)
+	if o.dryRun {
+		osProvider.DryRun = o.Out
+	} else {
+		if o.auditFile != "" {
+			osProvider.Audit = &audit.Log{File: o.auditFile, User: audit.CurrentUser(), Context: context, Cloud: cloudName, ErrOut: o.ErrOut}
+			if len(o.exporters) > 0 {
+				osProvider.Audit.Forward = o.exportAuditEntry
+			}
+		}
+		// the cached responses of the cloud are outdated after fixing volumes
+		defer func() {
+			c := &cache.Cache{Dir: cache.DefaultDir()}
+			if err := c.Clear("clouds", cloudName, "responses"); err != nil {
+				fmt.Fprintf(o.ErrOut, "%v\n", err)
+			}
+		}()
 	}
 
-	serversMap, err := openstack.GetServer(osProvider)
+	inv, recordsByVolume, err := o.fetchVolumeState(context, osProvider)
 	if err != nil {
-		return fmt.Errorf("error getting servers from OpenStack: %v", err)
+		return err
+	}
+	if o.appliedPlan != nil {
+		return o.applyPlan(osProvider, inv, recordsByVolume)
 	}
+	volumesMap, serversMap := inv.OpenStack.Volumes, inv.OpenStack.Servers
 
 	// resolve volume ids, if id is not of expected lenght try to find via name
 	var vIDs []string
@@ -143,12 +309,16 @@ func (o *VolumesFixOptions) runWithConfig(context string) error {
 		}
 		vIDs = append(vIDs, vID)
 	}
+	if o.listAttachments {
+		return o.printCinderAttachments(osProvider, vIDs, volumesMap, serversMap)
+	}
 
 	// loop over volumes
 	for _, vID := range vIDs {
 		volume, ok := volumesMap[vID]
 		if !ok {
 			fmt.Printf("Volume with id %s not found\n", vID)
+			continue
 		}
 
 		var srvs []servers.Server
@@ -160,57 +330,480 @@ func (o *VolumesFixOptions) runWithConfig(context string) error {
 			}
 		}
 
-		// attach via Cinder
-		if o.attachCinder != "" && o.attachCinderMountpoint != "" {
-			serverID, err := resolveServer(serversMap, o.attachCinder)
+		if actions := o.manualActions(srvs); len(actions) > 0 && o.needsConfirmation() {
+			describeVolume(o.Out, volume, recordsByVolume[vID])
+			ok, err := o.confirm(fmt.Sprintf("Volume %s: %s?", volume.Name, strings.Join(actions, ", ")))
 			if err != nil {
 				return err
 			}
-			err = openstack.AttachVolumeCinder(osProvider, volume.ID, serverID, o.attachCinderMountpoint)
+			if !ok {
+				fmt.Fprintf(o.Out, "Skipping volume %s\n", volume.Name)
+				continue
+			}
+		}
+
+		err := o.safely(osProvider, inv, volume.ID, func() error {
+			return o.fixVolume(osProvider, volume, srvs, serversMap)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fixVolume resets, attaches and detaches the volume as requested by the flags, srvs are the
+// servers the volume is attached to in Nova
+func (o *VolumesFixOptions) fixVolume(osProvider *openstack.Client, volume volumes.Volume, srvs []servers.Server, serversMap map[string]servers.Server) error {
+	// reset status in Cinder
+	if o.resetStatus != "" || o.attachStatus != "" {
+		err := openstack.ResetVolumeStatus(osProvider, volume.ID, o.resetStatus, o.attachStatus)
+		if err != nil {
+			return err
+		}
+		if err := o.waitUntil(osProvider, volume.ID, actionResetStatus, "", expectedStatus(o.resetStatus)); err != nil {
+			return err
+		}
+	}
+	// attach via Cinder
+	if o.attachCinder != "" && o.attachCinderMountpoint != "" {
+		serverID, err := resolveServer(serversMap, o.attachCinder)
+		if err != nil {
+			return err
+		}
+		err = openstack.AttachVolumeCinder(osProvider, volume.ID, serverID, o.attachCinderMountpoint)
+		if err != nil {
+			return err
+		}
+		if err := o.waitFor(osProvider, volume.ID, actionAttachCinder, serverID, o.attachCinder, true); err != nil {
+			return err
+		}
+	}
+	// attach via Nova
+	if o.attachNova != "" {
+		serverID, err := resolveServer(serversMap, o.attachNova)
+		if err != nil {
+			return err
+		}
+		err = openstack.AttachVolumeNova(osProvider, volume.ID, serverID)
+		if err != nil {
+			return err
+		}
+		if err := o.waitFor(osProvider, volume.ID, actionAttachNova, serverID, o.attachNova, true); err != nil {
+			return err
+		}
+	}
+	// detach via Cinder
+	if o.detachCinder {
+		err := openstack.DetachVolumeCinder(osProvider, volume.ID, o.force)
+		if err != nil {
+			return err
+		}
+		if err := o.waitFor(osProvider, volume.ID, actionDetachCinder, "", "", true); err != nil {
+			return err
+		}
+	}
+	// detach via Nova
+	if o.detachNova {
+		uniqueServerIDs := map[string]bool{}
+		for _, srv := range srvs {
+			uniqueServerIDs[srv.ID] = true
+		}
+		for srvID := range uniqueServerIDs {
+			err := openstack.DetachVolumeNova(osProvider, volume.ID, srvID)
 			if err != nil {
 				return err
 			}
+			if err := o.waitFor(osProvider, volume.ID, actionDetachNova, srvID, serversMap[srvID].Name, true); err != nil {
+				return err
+			}
+		}
+	}
+	// delete attachment records in Cinder
+	if len(o.deleteAttachments) > 0 {
+		attachmentIDs, err := o.attachmentsToDelete(osProvider, volume.ID, serversMap)
+		if err != nil {
+			return err
 		}
-		// attach via Nova
-		if o.attachNova != "" {
-			serverID, err := resolveServer(serversMap, o.attachNova)
+		for _, attachmentID := range attachmentIDs {
+			err := openstack.DeleteAttachmentCinder(osProvider, volume.ID, attachmentID)
 			if err != nil {
 				return err
 			}
-			err = openstack.AttachVolumeNova(osProvider, volume.ID, serverID)
-			if err != nil {
+			if err := o.waitUntil(osProvider, volume.ID, actionDeleteAttachment, "", expectedAttachmentDeleted(attachmentID)); err != nil {
 				return err
 			}
 		}
-		// detach via Cinder
-		if o.detachCinder {
-			err := openstack.DetachVolumeCinder(osProvider, volume.ID, o.force)
+	}
+	return nil
+}
+
+// createPlan prints the plan which fixes the broken volumes of the context
+func (o *VolumesFixOptions) createPlan(context string) error {
+	// the plan is based on the current state, so responses are not cached
+	inv, err := fetchInventory(o.configFlags, o.rawConfig, nil, context, inventory.Resources{
+		Volumes:           true,
+		VolumeAttachments: true,
+		PersistentVolumes: true,
+		Pods:              true,
+	})
+	if err != nil {
+		return err
+	}
+
+	records := (&VolumesOptions{RuleOptions: o.RuleOptions}).getVolumeRecords(context, kubernetes.PersistentVolumesByVolumeID(inv.Kubernetes.PersistentVolumes), kubernetes.PodsByPVC(inv.Kubernetes.Pods), inv.OpenStack.Volumes, inv.OpenStack.Servers, inv.OpenStack.VolumeAttachments)
+	if len(o.args) > 0 {
+		vIDs := map[string]bool{}
+		for _, arg := range o.args {
+			vID, err := resolveVolume(inv.OpenStack.Volumes, arg)
+			if err != nil {
+				return fmt.Errorf("error finding volume %v: %v", arg, err)
+			}
+			vIDs[vID] = true
+		}
+		var selected []VolumeRecord
+		for _, r := range records {
+			if vIDs[r.Cinder.ID] {
+				selected = append(selected, r)
+			}
+		}
+		records = selected
+	}
+
+	plan := &VolumeFixPlan{
+		APIVersion: output.APIVersion,
+		Kind:       volumeFixPlanKind,
+		Context:    context,
+		Cloud:      inv.Metadata.Cloud,
+		Time:       time.Now(),
+		Volumes:    planVolumeFixes(records, inv.OpenStack.Servers),
+	}
+
+	var out string
+	if o.output == "json" || o.output == "yaml" {
+		out, err = marshalPlan(plan, o.output)
+	} else {
+		out, err = getPrettyPlan(plan, o.output, o.noHeader)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating output: %v", err)
+	}
+	if out == "" {
+		fmt.Fprintf(o.ErrOut, "No broken volumes to fix in context %s\n", context)
+		return nil
+	}
+	fmt.Fprint(o.Out, out)
+	return nil
+}
+
+// applyPlan executes the steps of the plan after verifying that the volumes didn't change
+func (o *VolumesFixOptions) applyPlan(osProvider *openstack.Client, inv *inventory.Inventory, recordsByVolume map[string][]VolumeRecord) error {
+	volumesMap := inv.OpenStack.Volumes
+	if err := verifyPlan(o.appliedPlan, volumesMap); err != nil {
+		return err
+	}
+
+	for _, fix := range o.appliedPlan.Volumes {
+		if fix.Skipped != "" {
+			fmt.Fprintf(o.Out, "Skipping volume %s: %s\n", fix.Name, fix.Skipped)
+			continue
+		}
+		if o.safe && hasAction(fix.Steps, actionAttachNova) {
+			fix = withoutAttachNova(fix)
+			if len(fix.Steps) == 0 {
+				fmt.Fprintf(o.Out, "Skipping volume %s: it's attached by Kubernetes, --safe doesn't attach volumes\n", fix.Name)
+				continue
+			}
+			fmt.Fprintf(o.Out, "Volume %s: skipping step attach-nova, the volume is attached by Kubernetes when the pods are restored\n", fix.Name)
+		}
+		if o.needsConfirmation() {
+			describeVolume(o.Out, volumesMap[fix.ID], recordsByVolume[fix.ID])
+			var actions []string
+			for _, step := range fix.Steps {
+				actions = append(actions, strings.TrimSpace(step.Action+" "+step.ServerName))
+			}
+			ok, err := o.confirm(fmt.Sprintf("Volume %s: %s?", fix.Name, strings.Join(actions, ", ")))
 			if err != nil {
 				return err
 			}
+			if !ok {
+				fmt.Fprintf(o.Out, "Skipping volume %s\n", fix.Name)
+				continue
+			}
 		}
-		// detach via Nova
-		if o.detachNova {
-			uniqueServerIDs := map[string]bool{}
-			for _, srv := range srvs {
-				uniqueServerIDs[srv.ID] = true
+		err := o.safely(osProvider, inv, fix.ID, func() error {
+			return o.applySteps(osProvider, fix)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySteps executes and waits for the steps of a volume
+func (o *VolumesFixOptions) applySteps(osProvider *openstack.Client, fix VolumeFix) error {
+	for i, step := range fix.Steps {
+		fmt.Fprintf(o.Out, "Volume %s step %d/%d: %s %s (%s)\n", fix.Name, i+1, len(fix.Steps), step.Action, step.ServerName, step.Reason)
+		if err := applyStep(osProvider, fix.ID, step); err != nil {
+			return fmt.Errorf("error applying step %d of volume %s: %v", i+1, fix.ID, err)
+		}
+		// stale Cinder attachments are removed by a later force-detach
+		checkCinder := !(step.Action == actionDetachNova && hasAction(fix.Steps[i+1:], actionForceDetachCinder))
+		if err := o.waitFor(osProvider, fix.ID, step.Action, step.ServerID, step.ServerName, checkCinder); err != nil {
+			return fmt.Errorf("error applying step %d of volume %s: %v", i+1, fix.ID, err)
+		}
+	}
+	return nil
+}
+
+// exportAuditEntry sends the audit entry as json to the exporters
+func (o *VolumesFixOptions) exportAuditEntry(e audit.Entry) error {
+	content, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling audit entry: %v", err)
+	}
+	return o.Export(output.Message{
+		Command:   "volumes-fix",
+		Title:     fmt.Sprintf("%s of volume %s by %s", e.Action, e.VolumeID, e.User),
+		Contexts:  []string{e.Context},
+		TenantIDs: []string{e.Cloud},
+		Output:    "json",
+		Content:   string(content) + "\n",
+		Records:   []audit.Entry{e},
+	})
+}
+
+// needsConfirmation returns true if each volume has to be confirmed before it's changed
+func (o *VolumesFixOptions) needsConfirmation() bool {
+	return !o.dryRun && !o.yes && !o.listAttachments
+}
+
+// fetchVolumeState fetches the volumes and servers of the context. If the volumes have to be
+// confirmed or the pods have to be stopped via --safe, the Nova attachments and the pods are
+// fetched too, so the state of a volume can be shown. The records of the volumes are returned by
+// volume id.
+func (o *VolumesFixOptions) fetchVolumeState(context string, osProvider *openstack.Client) (*inventory.Inventory, map[string][]VolumeRecord, error) {
+	if !o.needsConfirmation() && !o.safe {
+		inv, err := inventory.Fetch(nil, osProvider, inventory.Resources{Volumes: true, Servers: true})
+		return inv, nil, err
+	}
+
+	restConfig, err := kubernetes.GetRestConfig(o.configFlags, context)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating client: %v", err)
+	}
+	kubeClient, err := kubernetes.GetKubeClient(restConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating client: %v", err)
+	}
+	o.kubeClient = kubeClient
+	inv, err := inventory.Fetch(kubeClient, osProvider, inventory.Resources{
+		Volumes:           true,
+		VolumeAttachments: true,
+		PersistentVolumes: true,
+		Pods:              true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := (&VolumesOptions{RuleOptions: o.RuleOptions}).getVolumeRecords(context, kubernetes.PersistentVolumesByVolumeID(inv.Kubernetes.PersistentVolumes), kubernetes.PodsByPVC(inv.Kubernetes.Pods), inv.OpenStack.Volumes, inv.OpenStack.Servers, inv.OpenStack.VolumeAttachments)
+	recordsByVolume := map[string][]VolumeRecord{}
+	for _, r := range records {
+		recordsByVolume[r.Cinder.ID] = append(recordsByVolume[r.Cinder.ID], r)
+	}
+	return inv, recordsByVolume, nil
+}
+
+// manualActions describes the changes the attach and detach flags make to a volume which is
+// attached to srvs in Nova
+func (o *VolumesFixOptions) manualActions(srvs []servers.Server) []string {
+	var actions []string
+	if o.attachCinder != "" && o.attachCinderMountpoint != "" {
+		actions = append(actions, fmt.Sprintf("attach via Cinder to %s", o.attachCinder))
+	}
+	if o.attachNova != "" {
+		actions = append(actions, fmt.Sprintf("attach via Nova to %s", o.attachNova))
+	}
+	if o.detachCinder && o.force {
+		actions = append(actions, "force-detach in Cinder")
+	} else if o.detachCinder {
+		actions = append(actions, "detach in Cinder")
+	}
+	if o.resetStatus != "" || o.attachStatus != "" {
+		actions = append(actions, fmt.Sprintf("reset in Cinder to status %s and attach status %s", orDash(o.resetStatus), orDash(o.attachStatus)))
+	}
+	if o.detachNova {
+		var names []string
+		for _, srv := range srvs {
+			if !containsString(names, srv.Name) {
+				names = append(names, srv.Name)
 			}
-			for srvID := range uniqueServerIDs {
-				err := openstack.DetachVolumeNova(osProvider, volume.ID, srvID)
-				if err != nil {
-					return err
-				}
+		}
+		actions = append(actions, fmt.Sprintf("detach in Nova from %s", orDash(strings.Join(names, ", "))))
+	}
+	if len(o.deleteAttachments) > 0 {
+		actions = append(actions, fmt.Sprintf("delete Cinder attachments %s", strings.Join(o.deleteAttachments, ", ")))
+	}
+	return actions
+}
+
+// attachmentsToDelete returns the ids of --delete-attachment, dangling is replaced by the ids of
+// the dangling attachment records of the volume
+func (o *VolumesFixOptions) attachmentsToDelete(osProvider *openstack.Client, volumeID string, serversMap map[string]servers.Server) ([]string, error) {
+	var ids []string
+	for _, id := range o.deleteAttachments {
+		if id != "dangling" {
+			ids = append(ids, id)
+			continue
+		}
+
+		attachments, err := openstack.GetAttachmentsCinder(osProvider, volumeID)
+		if err != nil {
+			return nil, err
+		}
+		novaAttachments := map[string]*openstack.NovaVolumeAttachments{}
+		for _, a := range attachments {
+			if _, ok := serversMap[a.Instance]; !ok || novaAttachments[a.Instance] != nil {
+				continue
+			}
+			novaAttachments[a.Instance], err = openstack.GetVolumeAttachmentsNova(osProvider, a.Instance)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, a := range attachments {
+			if isDanglingAttachment(a, novaAttachments) && !containsString(ids, a.ID) {
+				ids = append(ids, a.ID)
 			}
 		}
 	}
+	return ids, nil
+}
 
-	//fmt.Printf("%v\n", tenantID)
-	//fmt.Printf("%v\n", volumesMap)
-	//fmt.Printf("%v\n", serversMap)
+// isDanglingAttachment returns true if the server of the Cinder attachment record doesn't exist or
+// doesn't have the volume attached in Nova. novaAttachments are the attachments of the existing servers.
+func isDanglingAttachment(a openstack.CinderAttachment, novaAttachments map[string]*openstack.NovaVolumeAttachments) bool {
+	attachments, ok := novaAttachments[a.Instance]
+	if !ok {
+		return true
+	}
+	for _, n := range attachments.VolumeAttachments {
+		if n.VolumeID == a.VolumeID {
+			return false
+		}
+	}
+	return true
+}
 
+// printCinderAttachments prints the attachment records of the volumes in Cinder
+func (o *VolumesFixOptions) printCinderAttachments(osProvider *openstack.Client, vIDs []string, volumesMap map[string]volumes.Volume, serversMap map[string]servers.Server) error {
+	if output.IsStructured(o.output) {
+		var records []openstack.CinderAttachment
+		for _, vID := range vIDs {
+			attachments, err := openstack.GetAttachmentsCinder(osProvider, vID)
+			if err != nil {
+				return err
+			}
+			records = append(records, attachments...)
+		}
+		out, err := output.ConvertToStructured("CinderAttachmentList", records, o.output)
+		if err != nil {
+			return fmt.Errorf("error creating output: %v", err)
+		}
+		fmt.Fprint(o.Out, out)
+		return nil
+	}
+
+	var header []string
+	if !o.noHeader {
+		header = []string{"VOLUME", "VOLUME_ID", "ATTACHMENT_ID", "SERVER", "SERVER_ID", "STATUS", "ATTACH_MODE", "ATTACHED_AT"}
+	}
+	var lines [][]string
+	for _, vID := range vIDs {
+		attachments, err := openstack.GetAttachmentsCinder(osProvider, vID)
+		if err != nil {
+			return err
+		}
+		for _, a := range attachments {
+			server := "not found"
+			if srv, ok := serversMap[a.Instance]; ok {
+				server = srv.Name
+			}
+			lines = append(lines, []string{volumesMap[vID].Name, vID, a.ID, server, orDash(a.Instance), a.Status, orDash(a.AttachMode), orDash(a.AttachedAt)})
+		}
+	}
+	if len(lines) == 0 {
+		fmt.Fprintf(o.ErrOut, "No attachment records found in Cinder\n")
+		return nil
+	}
+	out, err := output.ConvertToTable(output.Table{Header: header, Lines: lines, SortIndices: []int{0, 1, 2}, Output: o.output})
+	if err != nil {
+		return fmt.Errorf("error creating output: %v", err)
+	}
+	fmt.Fprint(o.Out, out)
 	return nil
 }
 
+// describeVolume prints the Cinder, Nova and pod state of a volume, there is one record per pod
+func describeVolume(w io.Writer, volume volumes.Volume, records []VolumeRecord) {
+	fmt.Fprintf(w, "Volume %s (%s)\n", volume.Name, volume.ID)
+	if len(records) == 0 {
+		fmt.Fprintf(w, "  Cinder: %s\n", volume.Status)
+		return
+	}
+	r := records[0]
+	cinderServers, _ := r.cinderServers()
+	fmt.Fprintf(w, "  Cinder: %s, attached to %s\n", r.Cinder.Status, orDash(strings.Join(cinderServers, ", ")))
+	var novaServers []string
+	for _, a := range r.Nova {
+		novaServers = append(novaServers, fmt.Sprintf("%dx %s", a.Count, orDash(a.ServerName)))
+	}
+	fmt.Fprintf(w, "  Nova:   attached to %s\n", orDash(strings.Join(novaServers, ", ")))
+	for _, record := range records {
+		if record.Pod == "" {
+			fmt.Fprintf(w, "  Pod:    -\n")
+			continue
+		}
+		fmt.Fprintf(w, "  Pod:    %s on %s (%s)\n", record.Pod, orDash(record.PodNode), orDash(record.PodStatus))
+	}
+	var notes []string
+	for _, record := range records {
+		for _, note := range record.Notes {
+			if !containsString(notes, note) {
+				notes = append(notes, note)
+			}
+		}
+	}
+	if len(notes) > 0 {
+		fmt.Fprintf(w, "  Notes:  %s\n", strings.Join(notes, ", "))
+	}
+}
+
+// confirm asks the question and reads the answer from In, everything but y or yes is a no
+func (o *VolumesFixOptions) confirm(question string) (bool, error) {
+	if o.answers == nil {
+		o.answers = bufio.NewReader(o.In)
+	}
+	return confirm(o.answers, o.Out, question)
+}
+
+// confirm asks the question on out and reads the answer from answers, only y and yes confirm
+func confirm(answers *bufio.Reader, out io.Writer, question string) (bool, error) {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+	answer, err := answers.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("error reading answer: %v", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
 func resolveVolume(volumes map[string]volumes.Volume, idOrName string) (string, error) {
 	// volumeIDs have a length of 36
 	if len(idOrName) == 36 {
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestConfirm(t *testing.T) {
+	out := &bytes.Buffer{}
+	o := &VolumesFixOptions{IOStreams: genericclioptions.IOStreams{In: strings.NewReader("y\nno\n YES \n"), Out: out}}
+
+	// the last answer is missing, so it's a no
+	for i, expected := range []bool{true, false, true, false} {
+		ok, err := o.confirm("Volume vol: detach in Cinder?")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ok != expected {
+			t.Errorf("answer %d: expected %t, got %t", i, expected, ok)
+		}
+	}
+	if !strings.HasPrefix(out.String(), "Volume vol: detach in Cinder? [y/N]: ") {
+		t.Errorf("unexpected question: %q", out.String())
+	}
+}
+
+func TestExpectedState(t *testing.T) {
+	attached := volumes.Volume{ID: "v1", Status: "in-use", Attachments: []volumes.Attachment{{ServerID: "s1"}}}
+	detached := volumes.Volume{ID: "v1", Status: "available"}
+
+	tests := []struct {
+		name        string
+		action      string
+		checkCinder bool
+		state       openstack.VolumeState
+		diverged    string
+	}{
+		{name: "attached", action: actionAttachNova, state: openstack.VolumeState{Volume: attached, NovaAttached: true}},
+		{name: "attach pending in nova", action: actionAttachNova, state: openstack.VolumeState{Volume: attached}, diverged: "not attached to node-1 in Nova"},
+		{name: "attach pending in cinder", action: actionAttachNova, state: openstack.VolumeState{Volume: detached, NovaAttached: true}, diverged: "not attached to node-1 in Cinder"},
+		{name: "detached", action: actionDetachNova, checkCinder: true, state: openstack.VolumeState{Volume: detached}},
+		{name: "stale cinder attachment", action: actionDetachNova, checkCinder: true, state: openstack.VolumeState{Volume: attached}, diverged: "still attached to node-1 in Cinder"},
+		{name: "cinder not checked", action: actionDetachNova, state: openstack.VolumeState{Volume: attached}},
+		{name: "force-detached", action: actionForceDetachCinder, state: openstack.VolumeState{Volume: detached}},
+		{name: "force-detach pending", action: actionForceDetachCinder, state: openstack.VolumeState{Volume: attached}, diverged: "still attached to s1 in Cinder"},
+	}
+	for _, tt := range tests {
+		diverged := expectedState(tt.action, "s1", "node-1", tt.checkCinder)(tt.state)
+		if (tt.diverged == "") != (diverged == "") || !strings.Contains(diverged, tt.diverged) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.diverged, diverged)
+		}
+	}
+}
+
+func TestIsDanglingAttachment(t *testing.T) {
+	novaAttachments := map[string]*openstack.NovaVolumeAttachments{
+		"s1": {},
+		"s2": {},
+	}
+	if err := json.Unmarshal([]byte(`{"volumeAttachments": [{"volumeId": "v1", "serverId": "s1"}]}`), novaAttachments["s1"]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		instance string
+		dangling bool
+	}{
+		{instance: "s1", dangling: false},
+		{instance: "s2", dangling: true},
+		{instance: "deleted-server", dangling: true},
+	}
+	for _, tt := range tests {
+		if dangling := isDanglingAttachment(openstack.CinderAttachment{ID: "a1", VolumeID: "v1", Instance: tt.instance}, novaAttachments); dangling != tt.dangling {
+			t.Errorf("attachment to %s: expected dangling %t, got %t", tt.instance, tt.dangling, dangling)
+		}
+	}
+}
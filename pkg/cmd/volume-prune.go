@@ -0,0 +1,455 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/audit"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/cache"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubernetesVolumePrefixes are the name prefixes of the volumes provisioned by the in-tree Cinder
+// provisioner and by the Cinder CSI driver
+var kubernetesVolumePrefixes = []string{"kubernetes-dynamic-pvc-", "pvc-"}
+
+// isKubernetesVolume returns true if the volume has been provisioned dynamically by Kubernetes
+func isKubernetesVolume(name string) bool {
+	for _, prefix := range kubernetesVolumePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// csiClusterMetadata is the Cinder metadata the Cinder CSI driver sets to the id of its cluster
+	// (--cluster of the controller)
+	csiClusterMetadata = "cinder.csi.openstack.org/cluster"
+	// createdForMetadataPrefix is the prefix of the Cinder metadata the in-tree provisioner sets to the
+	// pvc and pv a volume has been provisioned for, it doesn't identify the cluster
+	createdForMetadataPrefix = "kubernetes.io/created-for/"
+)
+
+// hasKubernetesMetadata returns true if the Cinder metadata of the volume has been set by the
+// Cinder CSI driver or the in-tree provisioner
+func hasKubernetesMetadata(v volumes.Volume) bool {
+	if v.Metadata[csiClusterMetadata] != "" {
+		return true
+	}
+	for key := range v.Metadata {
+		if strings.HasPrefix(key, createdForMetadataPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// VolumesPruneOptions are the options of the volumes prune command
+type VolumesPruneOptions struct {
+	configFlags *genericclioptions.ConfigFlags
+
+	rawConfig api.Config
+
+	olderThan time.Duration
+	statuses  []string
+	backup    bool
+	timeout   time.Duration
+	dryRun    bool
+	yes       bool
+	output    string
+	noHeader  bool
+	// auditFile is the file the deletions and backups are recorded in
+	auditFile string
+	// answers reads the answers to the confirmations from In
+	answers *bufio.Reader
+
+	ContextOptions
+	genericclioptions.IOStreams
+}
+
+// VolumePruneRecord is a volume which has been provisioned by Kubernetes but isn't referenced by
+// a pv of any context of its cloud
+type VolumePruneRecord struct {
+	Cloud     string    `json:"cloud"`
+	Contexts  []string  `json:"contexts"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Size      int       `json:"size"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var (
+	volumesPruneExample = `
+	# list the orphaned volumes of all contexts, nothing is deleted
+	%[1]s volumes prune --context=prod-.* --dry-run
+
+	# delete the orphaned volumes which are available for more than 30 days after confirmation
+	%[1]s volumes prune --context=prod-.* --older-than 720h
+
+	# create a backup of every volume before it's deleted
+	%[1]s volumes prune --older-than 720h --backup
+`
+)
+
+// NewCmdVolumesPrune creates the volumes prune cmd
+func NewCmdVolumesPrune(streams genericclioptions.IOStreams) *cobra.Command {
+	o := &VolumesPruneOptions{
+		configFlags: genericclioptions.NewConfigFlags(true),
+		IOStreams:   streams,
+	}
+	cmd := &cobra.Command{
+		Use:          "prune",
+		Short:        "Delete the Cinder volumes provisioned by Kubernetes which are not used by a pv anymore",
+		Example:      fmt.Sprintf(volumesPruneExample, "kubectl openstack"),
+		SilenceUsage: true,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(c, args); err != nil {
+				return err
+			}
+			if err := o.Validate(); err != nil {
+				return err
+			}
+			if err := o.Run(); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&o.olderThan, "older-than", time.Hour, "only prune volumes which have been created before this duration, e.g. 720h, the default protects new volumes whose pv is not created yet")
+	cmd.Flags().StringSliceVar(&o.statuses, "status", []string{"available"}, "only prune volumes with one of these Cinder statuses")
+	cmd.Flags().BoolVar(&o.backup, "backup", false, "create a Cinder backup of every volume and wait until it's available before the volume is deleted")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", 30*time.Minute, "how long --backup waits for a backup")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", false, "print the requests (method, url and body) which would be sent to OpenStack instead of sending them")
+	cmd.Flags().BoolVarP(&o.yes, "yes", "y", false, "don't ask for confirmation before the volumes of a cloud are deleted")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "output of the volumes: markdown, raw, json or yaml")
+	cmd.Flags().BoolVarP(&o.noHeader, "no-headers", "", false, "hide table headers")
+	cmd.Flags().StringVar(&o.auditFile, "audit-file", audit.DefaultFile(), "file every request which deletes or backs up a volume is appended to as json line, an empty value disables the audit log")
+	o.ContextOptions.AddFlags(cmd.Flags())
+	o.configFlags.AddFlags(cmd.Flags())
+	return cmd
+}
+
+// Complete sets all necessary fields in VolumesPruneOptions
+func (o *VolumesPruneOptions) Complete(cmd *cobra.Command, args []string) error {
+	// volumes can only be pruned based on their current state
+	if getFromDump(cmd) != "" {
+		return fmt.Errorf("--from-dump is not supported by volumes prune")
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("volumes prune doesn't take arguments, got %v", args)
+	}
+
+	var err error
+	o.rawConfig, err = o.configFlags.ToRawKubeConfigLoader().RawConfig()
+	return err
+}
+
+// Validate ensures that all required arguments and flag values are provided
+func (o *VolumesPruneOptions) Validate() error {
+	if len(o.rawConfig.CurrentContext) == 0 {
+		return errNoContext
+	}
+	if o.olderThan < 0 {
+		return fmt.Errorf("--older-than can't be negative")
+	}
+	if len(o.statuses) == 0 {
+		return fmt.Errorf("--status has to contain at least one status")
+	}
+	for _, status := range o.statuses {
+		if status == "in-use" {
+			return fmt.Errorf("volumes which are in-use can't be pruned")
+		}
+	}
+	if o.backup && o.timeout <= 0 {
+		return fmt.Errorf("--timeout has to be positive")
+	}
+	switch o.output {
+	case "markdown", "raw", "json", "yaml":
+	default:
+		return fmt.Errorf("unsupported output %q, supported are markdown, raw, json and yaml", o.output)
+	}
+	return o.ContextOptions.Validate()
+}
+
+// Run lists the orphaned volumes of the clouds of the matching contexts and deletes them. A volume
+// is only orphaned if no context of its cloud has a pv referencing it, so the volumes of a cloud
+// are skipped if one of its contexts failed. Volumes which are not tagged with the cluster of a
+// matching context are only pruned if all contexts of their cloud match.
+func (o *VolumesPruneOptions) Run() error {
+	contexts := kubernetes.GetMatchingContexts(o.rawConfig, *o.configFlags.Context)
+
+	// volumes are pruned based on the current state, so responses are not cached
+	inventories := make([]*inventory.Inventory, len(contexts))
+	results := o.runContexts(contexts, func(i int, context string) (string, error) {
+		cloud, err := openstack.GetCloudName(context, o.rawConfig.Contexts[context])
+		if err != nil {
+			return "", err
+		}
+		inventories[i], err = fetchInventory(o.configFlags, o.rawConfig, nil, context, inventory.Resources{
+			Volumes:           true,
+			PersistentVolumes: true,
+		})
+		return cloud, err
+	})
+	if len(contexts) > 1 {
+		printSummary(o.ErrOut, results)
+	}
+
+	var records []VolumePruneRecord
+	contextsByCloud := map[string][]string{}
+	for _, cloud := range o.prunableClouds(results) {
+		var cloudInventories []*inventory.Inventory
+		for i, r := range results {
+			if r.tenantID == cloud {
+				cloudInventories = append(cloudInventories, inventories[i])
+				contextsByCloud[cloud] = append(contextsByCloud[cloud], r.context)
+			}
+		}
+		unmatched, err := o.unmatchedContexts(cloud, contextsByCloud[cloud])
+		if err != nil {
+			return err
+		}
+		records = append(records, o.orphanedVolumes(cloud, contextsByCloud[cloud], unmatched, cloudInventories, time.Now())...)
+	}
+
+	if err := o.printRecords(records); err != nil {
+		return err
+	}
+	if err := o.deleteVolumes(records, contextsByCloud); err != nil {
+		return err
+	}
+	return failedContexts(results)
+}
+
+// prunableClouds returns the clouds of the results which have no failed context. If the cloud of
+// a failed context is unknown, it could be any cloud, so no cloud is returned.
+func (o *VolumesPruneOptions) prunableClouds(results []contextResult) []string {
+	failed := map[string]bool{}
+	for _, r := range results {
+		if r.err != nil && r.tenantID == "" {
+			fmt.Fprintf(o.ErrOut, "Skipping all clouds because the cloud of the failed context %s is unknown\n", r.context)
+			return nil
+		}
+		if r.err != nil {
+			failed[r.tenantID] = true
+		}
+	}
+	var clouds []string
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		if failed[r.tenantID] {
+			if !containsString(clouds, r.tenantID) {
+				fmt.Fprintf(o.ErrOut, "Skipping cloud %s because context %s failed, its pvs are unknown\n", r.tenantID, r.context)
+			}
+			continue
+		}
+		if !containsString(clouds, r.tenantID) {
+			clouds = append(clouds, r.tenantID)
+		}
+	}
+	sort.Strings(clouds)
+	return clouds
+}
+
+// unmatchedContexts returns the contexts of the kubeconfig which belong to the cloud but are not
+// one of the matching contexts
+func (o *VolumesPruneOptions) unmatchedContexts(cloud string, contexts []string) ([]string, error) {
+	var unmatched []string
+	for context, kubeContext := range o.rawConfig.Contexts {
+		if containsString(contexts, context) {
+			continue
+		}
+		contextCloud, err := openstack.GetCloudName(context, kubeContext)
+		if err != nil {
+			return nil, err
+		}
+		if contextCloud == cloud {
+			unmatched = append(unmatched, context)
+		}
+	}
+	sort.Strings(unmatched)
+	return unmatched, nil
+}
+
+// orphanedVolumes returns the volumes of the cloud which have been provisioned by Kubernetes, are
+// not referenced by a pv of any of the inventories and match the status and age filters. Other
+// clusters can use the cloud, so a volume has to be tagged with the cluster of one of the
+// inventories. The clusters are the CSI cluster ids of the volumes referenced by their pvs. If
+// there are no unmatched contexts of the cloud, the volumes tagged by the in-tree provisioner or
+// with another CSI cluster are pruned too.
+func (o *VolumesPruneOptions) orphanedVolumes(cloud string, contexts, unmatched []string, inventories []*inventory.Inventory, now time.Time) []VolumePruneRecord {
+	referenced := map[string]bool{}
+	volumesMap := map[string]volumes.Volume{}
+	for _, inv := range inventories {
+		for id := range kubernetes.PersistentVolumesByVolumeID(inv.Kubernetes.PersistentVolumes) {
+			referenced[id] = true
+		}
+		// all contexts of a cloud see the same volumes
+		for id, v := range inv.OpenStack.Volumes {
+			volumesMap[id] = v
+		}
+	}
+	clusters := map[string]bool{}
+	for id := range referenced {
+		if cluster := volumesMap[id].Metadata[csiClusterMetadata]; cluster != "" {
+			clusters[cluster] = true
+		}
+	}
+
+	var records []VolumePruneRecord
+	var untagged int
+	for id, v := range volumesMap {
+		if referenced[id] || !isKubernetesVolume(v.Name) || !hasKubernetesMetadata(v) || !containsString(o.statuses, v.Status) {
+			continue
+		}
+		if o.olderThan > 0 && v.CreatedAt.After(now.Add(-o.olderThan)) {
+			continue
+		}
+		if !clusters[v.Metadata[csiClusterMetadata]] && len(unmatched) > 0 {
+			untagged++
+			continue
+		}
+		records = append(records, VolumePruneRecord{
+			Cloud:     cloud,
+			Contexts:  contexts,
+			ID:        v.ID,
+			Name:      v.Name,
+			Size:      v.Size,
+			Status:    v.Status,
+			CreatedAt: v.CreatedAt,
+		})
+	}
+	if untagged > 0 {
+		fmt.Fprintf(o.ErrOut, "Skipping %d volumes of cloud %s which are not tagged with the cluster of a matching context, they are only pruned if all contexts of the cloud match, missing: %s\n", untagged, cloud, strings.Join(unmatched, ", "))
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+	return records
+}
+
+// printRecords prints the volumes which are pruned
+func (o *VolumesPruneOptions) printRecords(records []VolumePruneRecord) error {
+	if len(records) == 0 && !output.IsStructured(o.output) {
+		fmt.Fprintf(o.ErrOut, "No orphaned volumes found\n")
+		return nil
+	}
+
+	var out string
+	var err error
+	if output.IsStructured(o.output) {
+		if records == nil {
+			records = []VolumePruneRecord{}
+		}
+		out, err = output.ConvertToStructured("VolumePruneList", records, o.output)
+	} else {
+		var header []string
+		if !o.noHeader {
+			header = []string{"CLOUD", "NAME", "ID", "SIZE", "STATUS", "CREATED"}
+		}
+		var lines [][]string
+		for _, r := range records {
+			lines = append(lines, []string{r.Cloud, r.Name, r.ID, strconv.Itoa(r.Size), r.Status, r.CreatedAt.Format("2006-01-02 15:04")})
+		}
+		out, err = output.ConvertToTable(output.Table{Header: header, Lines: lines, SortIndices: []int{0, 5, 1}, Output: o.output})
+	}
+	if err != nil {
+		return fmt.Errorf("error creating output: %v", err)
+	}
+	fmt.Fprint(o.Out, out)
+	return nil
+}
+
+// deleteVolumes deletes the volumes per cloud after confirmation, with --backup each volume is
+// backed up first
+func (o *VolumesPruneOptions) deleteVolumes(records []VolumePruneRecord, contextsByCloud map[string][]string) error {
+	var clouds []string
+	recordsByCloud := map[string][]VolumePruneRecord{}
+	for _, r := range records {
+		if _, ok := recordsByCloud[r.Cloud]; !ok {
+			clouds = append(clouds, r.Cloud)
+		}
+		recordsByCloud[r.Cloud] = append(recordsByCloud[r.Cloud], r)
+	}
+
+	for _, cloud := range clouds {
+		if !o.dryRun && !o.yes {
+			if o.answers == nil {
+				o.answers = bufio.NewReader(o.In)
+			}
+			question := fmt.Sprintf("Delete %d volumes of cloud %s?", len(recordsByCloud[cloud]), cloud)
+			if o.backup {
+				question = fmt.Sprintf("Back up and delete %d volumes of cloud %s?", len(recordsByCloud[cloud]), cloud)
+			}
+			ok, err := confirm(o.answers, o.Out, question)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Fprintf(o.Out, "Skipping cloud %s\n", cloud)
+				continue
+			}
+		}
+		if err := o.deleteVolumesOfCloud(contextsByCloud[cloud][0], recordsByCloud[cloud]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteVolumesOfCloud deletes the volumes via the OpenStack client of the context
+func (o *VolumesPruneOptions) deleteVolumesOfCloud(context string, records []VolumePruneRecord) error {
+	osProvider, cloudName, err := openstack.GetOpenStackClient(context, o.rawConfig.Contexts[context], nil)
+	if err != nil {
+		return fmt.Errorf("error creating client: %v", err)
+	}
+	if o.dryRun {
+		osProvider.DryRun = o.Out
+	} else {
+		if o.auditFile != "" {
+			osProvider.Audit = &audit.Log{File: o.auditFile, User: audit.CurrentUser(), Context: context, Cloud: cloudName, ErrOut: o.ErrOut}
+		}
+		// the cached responses of the cloud are outdated after deleting volumes
+		defer func() {
+			c := &cache.Cache{Dir: cache.DefaultDir()}
+			if err := c.Clear("clouds", cloudName, "responses"); err != nil {
+				fmt.Fprintf(o.ErrOut, "%v\n", err)
+			}
+		}()
+	}
+
+	for _, r := range records {
+		if o.backup {
+			backupID, err := openstack.BackupVolumeCinder(osProvider, r.ID, "prune-"+r.Name, fmt.Sprintf("backup of %s before it has been pruned by kubectl openstack volumes prune", r.Name))
+			if err != nil {
+				return err
+			}
+			if backupID != "" {
+				if err := openstack.WaitForBackup(osProvider, backupID, o.timeout, waitInterval); err != nil {
+					return fmt.Errorf("error backing up volume %s, it's not deleted: %v", r.ID, err)
+				}
+				fmt.Fprintf(o.Out, "Created backup %s of volume %s\n", backupID, r.Name)
+			}
+		}
+		if err := openstack.DeleteVolumeCinder(osProvider, r.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
+	"k8s.io/api/core/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestOrphanedVolumes(t *testing.T) {
+	now := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-60 * 24 * time.Hour)
+	csi := func(cluster string) map[string]string {
+		return map[string]string{"cinder.csi.openstack.org/cluster": cluster}
+	}
+	inTree := map[string]string{"kubernetes.io/created-for/pvc/namespace": "ns", "kubernetes.io/created-for/pvc/name": "data"}
+	volume := func(id, name, status string, created time.Time, metadata map[string]string) volumes.Volume {
+		return volumes.Volume{ID: id, Name: name, Status: status, CreatedAt: created, Metadata: metadata}
+	}
+	cinderPV := v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{Cinder: &v1.CinderPersistentVolumeSource{VolumeID: "in-tree-used"}}}}
+	csiPV := v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{CSI: &v1.CSIPersistentVolumeSource{VolumeHandle: "csi-used"}}}}
+
+	vs := map[string]volumes.Volume{
+		"in-tree-used":   volume("in-tree-used", "kubernetes-dynamic-pvc-1", "available", old, inTree),
+		"csi-used":       volume("csi-used", "pvc-2", "available", old, csi("a")),
+		"in-tree-orphan": volume("in-tree-orphan", "kubernetes-dynamic-pvc-3", "available", old, inTree),
+		"csi-orphan":     volume("csi-orphan", "pvc-4", "available", old.Add(time.Hour), csi("a")),
+		"csi-new":        volume("csi-new", "pvc-5", "available", now.Add(-30*time.Minute), csi("a")),
+		"csi-error":      volume("csi-error", "pvc-6", "error", old, csi("a")),
+		"csi-other":      volume("csi-other", "pvc-7", "available", old.Add(2*time.Hour), csi("b")),
+		"untagged":       volume("untagged", "pvc-8", "available", old, nil),
+		"manual":         volume("manual", "data", "available", old, nil),
+	}
+	// the pvs of the cloud are spread over two contexts
+	inventories := []*inventory.Inventory{
+		{OpenStack: inventory.OpenStack{Volumes: vs}, Kubernetes: inventory.Kubernetes{PersistentVolumes: []v1.PersistentVolume{cinderPV}}},
+		{OpenStack: inventory.OpenStack{Volumes: vs}, Kubernetes: inventory.Kubernetes{PersistentVolumes: []v1.PersistentVolume{csiPV}}},
+	}
+
+	tests := []struct {
+		name      string
+		olderThan time.Duration
+		statuses  []string
+		unmatched []string
+		expected  []string
+	}{
+		{name: "available", statuses: []string{"available"}, expected: []string{"in-tree-orphan", "csi-orphan", "csi-other", "csi-new"}},
+		{name: "older than 30 days", olderThan: 30 * 24 * time.Hour, statuses: []string{"available"}, expected: []string{"in-tree-orphan", "csi-orphan", "csi-other"}},
+		{name: "error", statuses: []string{"error"}, expected: []string{"csi-error"}},
+		// only the volumes of cluster a of the csi pv are tied to the matching contexts
+		{name: "unmatched contexts", olderThan: time.Hour, statuses: []string{"available"}, unmatched: []string{"c"}, expected: []string{"csi-orphan"}},
+	}
+	for _, tt := range tests {
+		o := &VolumesPruneOptions{olderThan: tt.olderThan, statuses: tt.statuses, IOStreams: genericclioptions.IOStreams{ErrOut: ioutil.Discard}}
+		var ids []string
+		for _, r := range o.orphanedVolumes("cloud", []string{"a", "b"}, tt.unmatched, inventories, now) {
+			ids = append(ids, r.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, ids)
+		}
+	}
+}
+
+func TestPrunableClouds(t *testing.T) {
+	o := &VolumesPruneOptions{IOStreams: genericclioptions.IOStreams{ErrOut: ioutil.Discard}}
+	results := []contextResult{
+		{context: "a-1", tenantID: "a"},
+		{context: "a-2", tenantID: "a", err: errNoContext},
+		{context: "b-1", tenantID: "b"},
+		{context: "b-2", tenantID: "b"},
+	}
+	if clouds := o.prunableClouds(results); !reflect.DeepEqual(clouds, []string{"b"}) {
+		t.Errorf("expected cloud b, got %v", clouds)
+	}
+
+	results = append(results, contextResult{context: "unknown", err: errNoContext})
+	if clouds := o.prunableClouds(results); len(clouds) != 0 {
+		t.Errorf("expected no clouds, got %v", clouds)
+	}
+}
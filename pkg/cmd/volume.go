@@ -3,20 +3,18 @@ package cmd
 import (
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/inventory"
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
 	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/rules"
 	"github.com/spf13/cobra"
 	"k8s.io/api/core/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/tools/clientcmd/api"
-	"os"
 
 	"fmt"
 	"strings"
-
-	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output/mattermost"
-	"k8s.io/client-go/rest"
 )
 
 //TODO
@@ -28,14 +26,20 @@ type VolumesOptions struct {
 	states     string
 	namespaces string
 
-	exporter   string
-	output     string
-	noHeader   bool
-	columns    string
+	output   string
+	noHeader bool
+	columns  string
+	// columnsSet is set if the columns have been chosen explicitly
+	columnsSet bool
 	args       []string
 	onlyBroken bool
 	debug      bool
 
+	ContextOptions
+	CacheOptions
+	FromDumpOptions
+	RuleOptions
+	ExporterOptions
 	genericclioptions.IOStreams
 }
 
@@ -46,6 +50,18 @@ var (
 	
 	# list volumes with debug columns
 	%[1]s volumes --debug
+
+	# list broken volumes as json
+	%[1]s volumes --only-broken -o json
+
+	# list volumes which are attached multiple times or orphaned
+	%[1]s volumes --only-broken --rules=multi-attach,orphan
+
+	# delete the volumes which are not used by a pv anymore
+	%[1]s volumes prune --older-than 720h
+
+	# list the availability zone of all volumes
+	%[1]s volumes -o jsonpath='{range .items[*]}{.cinder.name}{"\t"}{.objects.volume.availability_zone}{"\n"}{end}'
 `
 )
 
@@ -76,19 +92,23 @@ func NewCmdVolumes(streams genericclioptions.IOStreams) *cobra.Command {
 	}
 	cmd.Flags().StringVar(&o.states, "states", "", "filter by states, default list all")
 	cmd.Flags().StringVar(&o.namespaces, "namespaces", "", "filter by Kubernetes namespaces, default list all")
-	cmd.Flags().StringVarP(&o.exporter, "exporter", "e", "stdout", "stdout, mm or multiple (comma-separated)")
-	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "markdown or raw")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "markdown", "markdown, raw, json, yaml, go-template=..., go-template-file=... or jsonpath=...")
 	cmd.Flags().BoolVarP(&o.debug, "debug", "", false, "debug prints debug columns, equivalent to --columns=DEBUG")
 	cmd.Flags().BoolVarP(&o.onlyBroken, "only-broken", "", false, "only show disks which are broken/out of sync")
 	cmd.Flags().BoolVarP(&o.noHeader, "no-headers", "", false, "hide table headers")
 	cmd.Flags().StringVar(&o.columns, "columns", strings.Join(defaultHeaders, ","), fmt.Sprintf("column-separated list of headers to show, if set to DEBUG a special debug subset of columns is shown (%q). The following columns are available: %q", strings.Join(debugHeaders, ","), strings.Join(allHeaders, ",")))
+	o.ContextOptions.AddFlags(cmd.Flags())
+	o.CacheOptions.AddFlags(cmd.Flags())
+	o.RuleOptions.AddFlags(cmd.Flags())
+	o.ExporterOptions.AddFlags(cmd.Flags())
 	o.configFlags.AddFlags(cmd.Flags())
+	cmd.AddCommand(NewCmdVolumesPrune(streams))
 	return cmd
 }
 
 var defaultHeaders = []string{"PVC", "POD", "POD_NODE", "POD_STATUS", "CINDER_NAME", "SIZE", "CINDER_ID", "CINDER_SERVER", "CINDER_SERVER_ID", "CINDER_STATUS"}
 var debugHeaders = []string{"PVC", "PV", "POD", "POD_NODE", "POD_STATUS", "CINDER_NAME", "CINDER_ID", "CINDER_SERVER", "CINDER_STATUS", "NOVA_SERVER", "NOTE"}
-var allHeaders = []string{"CLUSTER", "PVC", "PV", "POD", "POD_NODE", "POD_STATUS", "CINDER_NAME", "SIZE", "CINDER_ID", "CINDER_SERVER", "CINDER_SERVER_ID", "CINDER_STATUS", "NOVA_SERVER", "NOVA_SERVER_ID", "NOTE"}
+var allHeaders = []string{"CLUSTER", "REGION", "PVC", "PV", "POD", "POD_NODE", "POD_STATUS", "CINDER_NAME", "SIZE", "CINDER_ID", "CINDER_SERVER", "CINDER_SERVER_ID", "CINDER_STATUS", "NOVA_SERVER", "NOVA_SERVER_ID", "NOTE"}
 
 // Complete sets als necessary fields in VolumeOptions
 func (o *VolumesOptions) Complete(cmd *cobra.Command, args []string) error {
@@ -99,6 +119,16 @@ func (o *VolumesOptions) Complete(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := o.ExporterOptions.Complete(o.Out); err != nil {
+		return err
+	}
+	if err := o.FromDumpOptions.Complete(cmd); err != nil {
+		return err
+	}
+	if err := o.RuleOptions.Complete(); err != nil {
+		return err
+	}
+	o.columnsSet = cmd.Flags().Changed("columns") && o.columns != "DEBUG"
 	if o.debug || o.columns == "DEBUG" {
 		o.columns = strings.Join(debugHeaders, ",")
 	}
@@ -107,134 +137,171 @@ func (o *VolumesOptions) Complete(cmd *cobra.Command, args []string) error {
 
 // Validate ensures that all required arguments and flag values are provided
 func (o *VolumesOptions) Validate() error {
-	if len(o.rawConfig.CurrentContext) == 0 {
+	if len(o.rawConfig.CurrentContext) == 0 && o.dump == nil {
 		return errNoContext
 	}
 
-	return nil
+	if err := o.ContextOptions.Validate(); err != nil {
+		return err
+	}
+	if err := o.RuleOptions.Validate(); err != nil {
+		return err
+	}
+	return o.CacheOptions.Validate()
 }
 
 // Run lists all volumes
 func (o *VolumesOptions) Run() error {
 	contexts := kubernetes.GetMatchingContexts(o.rawConfig, *o.configFlags.Context)
+	if o.dump != nil {
+		contexts = o.FromDumpOptions.contexts(*o.configFlags.Context)
+	}
 
 	if len(contexts) == 1 {
-		err := o.runWithConfig(contexts[0])
+		records, tenantID, err := o.getRecords(contexts[0])
 		if err != nil {
-			return fmt.Errorf("error listing volumes for %s: %v\n", o.rawConfig.CurrentContext, err)
+			return &ExitError{Code: contextExitCode(err), Err: fmt.Errorf("error listing volumes for %s: %v\n", contexts[0], err)}
 		}
-		return nil
+		if err := o.exportRecords([]string{contexts[0]}, []string{tenantID}, records); err != nil {
+			return err
+		}
+		return o.checkFailOn(volumeFindings(records))
 	}
 
 	// multiple tenants
-	// disable header here and print them once if required
-	if !o.noHeader {
-		output, err := output.ConvertToTable(output.Table{strings.Split(o.columns, ","), [][]string{}, []int{0, 1}, o.output})
-		if err != nil {
-			return fmt.Errorf("error creating output: %v", err)
-		}
-		fmt.Printf(output)
-	}
-	o.noHeader = true
-	for _, context := range contexts {
-		o.configFlags.Context = &context
-		err := o.runWithConfig(context)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error listing volumes for %s: %v\n", context, err)
-		}
+	// show cluster and region to distinguish volumes of different clusters and clouds
+	if !o.columnsSet {
+		o.columns = "CLUSTER,REGION," + o.columns
+	}
+	recordsPerContext := make([][]VolumeRecord, len(contexts))
+	results := o.runContexts(contexts, func(i int, context string) (string, error) {
+		records, tenantID, err := o.getRecords(context)
+		recordsPerContext[i] = records
+		return tenantID, err
+	})
+	var records []VolumeRecord
+	for _, r := range recordsPerContext {
+		records = append(records, r...)
+	}
+
+	succeededContexts, tenantIDs := succeeded(results)
+	err := o.exportRecords(succeededContexts, tenantIDs, records)
+	printSummary(o.ErrOut, results)
+	if err != nil {
+		return err
 	}
-	return nil
+	return mostSevere(failedContexts(results), o.checkFailOn(volumeFindings(records)))
 }
 
-func (o *VolumesOptions) runWithConfig(context string) error {
-	if context == "" {
-		return fmt.Errorf("no context set")
+// getRecords fetches the volumes of the context from Kubernetes and OpenStack
+func (o *VolumesOptions) getRecords(context string) ([]VolumeRecord, string, error) {
+	inv, err := o.getInventory(context, func() (*inventory.Inventory, error) {
+		return fetchInventory(o.configFlags, o.rawConfig, o.cache(), context, inventory.Resources{
+			Volumes:           true,
+			VolumeAttachments: true,
+			PersistentVolumes: true,
+			Pods:              true,
+		})
+	})
+	if err != nil {
+		return nil, "", err
 	}
 
-	contextStruct := o.rawConfig.Contexts[context]
-	cluster := o.rawConfig.Clusters[contextStruct.Cluster]
-	authInfo := o.rawConfig.AuthInfos[contextStruct.AuthInfo]
-	c := &rest.Config{
-		Host: cluster.Server,
-		TLSClientConfig: rest.TLSClientConfig{
-			CAData:   cluster.CertificateAuthorityData,
-			KeyData:  authInfo.ClientKeyData,
-			CertData: authInfo.ClientCertificateData,
-		},
+	records := o.getVolumeRecords(context, kubernetes.PersistentVolumesByVolumeID(inv.Kubernetes.PersistentVolumes), kubernetes.PodsByPVC(inv.Kubernetes.Pods), inv.OpenStack.Volumes, inv.OpenStack.Servers, inv.OpenStack.VolumeAttachments)
+	for i := range records {
+		records[i].Region = inv.Metadata.Region
 	}
 
-	kubeClient, err := kubernetes.GetKubeClient(c)
-	if err != nil {
-		return fmt.Errorf("error creating client: %v", err)
-	}
-	osProvider, tenantID, err := openstack.GetOpenStackClient(context)
-	if err != nil {
-		return fmt.Errorf("error creating client: %v", err)
-	}
+	return records, inv.Metadata.Cloud, nil
+}
 
-	pvMap, err := kubernetes.GetPersistentVolumes(kubeClient)
-	if err != nil {
-		return fmt.Errorf("error getting persistent volumes from Kubernetes: %v", err)
+// exportRecords renders the records of the contexts and exports them
+func (o *VolumesOptions) exportRecords(contexts, tenantIDs []string, records []VolumeRecord) error {
+	var out string
+	var err error
+	if output.IsStructured(o.output) {
+		if records == nil {
+			records = []VolumeRecord{}
+		}
+		out, err = output.ConvertToStructured("VolumeList", records, o.output)
+	} else {
+		out, err = o.getPrettyVolumeList(records)
 	}
-
-	podMap, err := kubernetes.GetPodsByPVC(kubeClient)
 	if err != nil {
-		return fmt.Errorf("error getting persistent volumes from Kubernetes: %v", err)
+		return fmt.Errorf("error creating output: %v", err)
 	}
 
-	volumesMap, err := openstack.GetVolumes(osProvider)
-	if err != nil {
-		return fmt.Errorf("error getting volumes from OpenStack: %v", err)
+	if out == "" {
+		return nil
 	}
+	return o.export(contexts, tenantIDs, records, out)
+}
 
-	serversMap, err := openstack.GetServer(osProvider)
-	if err != nil {
-		return fmt.Errorf("error getting servers from OpenStack: %v", err)
-	}
+func (o *VolumesOptions) export(contexts, tenantIDs []string, records []VolumeRecord, out string) error {
+	return o.Export(output.Message{
+		Command:   "volumes",
+		Title:     fmt.Sprintf("Volumes for %s", strings.Join(tenantIDs, ", ")),
+		Contexts:  contexts,
+		TenantIDs: tenantIDs,
+		Output:    o.output,
+		Content:   out,
+		Records:   records,
+		Notes:     volumeNotes(records),
+	})
+}
 
-	attachmentsMap, err := openstack.GetVolumeAttachmentsForServerNova(osProvider, serversMap)
-	if err != nil {
-		return fmt.Errorf("error getting attachments from OpenStack: %v", err)
-	}
+// VolumeRecord is the correlated view of a Cinder volume, its attachments in Nova and
+// the Kubernetes PV, PVC and pod using it. There is one record per pod using the volume.
+type VolumeRecord struct {
+	Cluster   string                 `json:"cluster"`
+	Region    string                 `json:"region,omitempty"`
+	PVC       string                 `json:"pvc,omitempty"`
+	PV        string                 `json:"pv,omitempty"`
+	Pod       string                 `json:"pod,omitempty"`
+	PodNode   string                 `json:"podNode,omitempty"`
+	PodStatus string                 `json:"podStatus,omitempty"`
+	Cinder    CinderVolumeRecord     `json:"cinder"`
+	Nova      []NovaAttachmentRecord `json:"nova,omitempty"`
+	Notes     []string               `json:"notes,omitempty"`
+	Findings  []rules.Finding        `json:"findings,omitempty"`
+	Objects   *VolumeObjects         `json:"objects,omitempty"`
+}
 
-	output, err := o.getPrettyVolumeList(context, pvMap, podMap, volumesMap, serversMap, attachmentsMap)
-	if err != nil {
-		return fmt.Errorf("error creating output: %v", err)
-	}
+// VolumeObjects are the raw OpenStack and Kubernetes objects a VolumeRecord is correlated from
+type VolumeObjects struct {
+	Volume           volumes.Volume       `json:"volume"`
+	PersistentVolume *v1.PersistentVolume `json:"persistentVolume,omitempty"`
+	Pod              *v1.Pod              `json:"pod,omitempty"`
+	// Servers are all servers the volume is attached to in Cinder or Nova
+	Servers []servers.Server `json:"servers,omitempty"`
+}
 
-	if output == "" {
-		return nil
-	}
-	for _, exporter := range strings.Split(o.exporter, ",") {
-		switch exporter {
-		case "stdout":
-			{
-				fmt.Printf(output)
-			}
-		case "mm":
-			{
-				var msg string
-				switch o.output {
-				case "raw":
-					msg = fmt.Sprintf("Volumes for %s:\n\n````\n%s````\n\n", tenantID, output)
-				case "markdown":
-					msg = fmt.Sprintf("Volumes for %s:\n\n%s\n\n", tenantID, output)
-				}
-				mattermost.New().SendMessage(msg)
-			}
-		}
-	}
-	return nil
+// CinderVolumeRecord is the volume and its attachments as seen by Cinder
+type CinderVolumeRecord struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Size        int               `json:"size"`
+	Status      string            `json:"status"`
+	Attachments []ServerReference `json:"attachments,omitempty"`
+}
+
+// ServerReference references an OpenStack server, Name is empty if the server was not found
+type ServerReference struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
 }
 
-func (o *VolumesOptions) getPrettyVolumeList(context string, pvs map[string]v1.PersistentVolume, podMap map[string][]v1.Pod, volumes map[string]volumes.Volume, server map[string]servers.Server, attachmentsMap map[string]*openstack.NovaVolumeAttachments) (string, error) {
+// NovaAttachmentRecord are the attachments of a volume to a server as seen by Nova
+type NovaAttachmentRecord struct {
+	ServerID   string   `json:"serverID"`
+	ServerName string   `json:"serverName"`
+	Count      int      `json:"count"`
+	Devices    []string `json:"devices,omitempty"`
+}
 
-	var header []string
-	if !o.noHeader {
-		header = strings.Split(o.columns, ",")
-	}
+func (o *VolumesOptions) getVolumeRecords(context string, pvs map[string]v1.PersistentVolume, podMap map[string][]v1.Pod, volumes map[string]volumes.Volume, server map[string]servers.Server, attachmentsMap map[string]*openstack.NovaVolumeAttachments) []VolumeRecord {
 
-	linesAllColumns := []map[string]string{}
+	var records []VolumeRecord
 	for _, v := range volumes {
 
 		// Skip disk if it's status doesn't match one of the states defined in the state flag
@@ -251,38 +318,43 @@ func (o *VolumesOptions) getPrettyVolumeList(context string, pvs map[string]v1.P
 			}
 		}
 
-		var cinderServers []string
-		var cinderServerIDs []string
-		var novaServers []string
-		var novaServerIDs []string
+		attachedServers := map[string]servers.Server{}
+		var cinderAttachments []ServerReference
 		for _, a := range v.Attachments {
-			cinderServerIDs = append(cinderServerIDs, a.ServerID)
+			cinderAttachments = append(cinderAttachments, ServerReference{ID: a.ServerID, Name: server[a.ServerID].Name})
 			if srv, ok := server[a.ServerID]; ok {
-				cinderServers = append(cinderServers, srv.Name)
-			} else {
-				cinderServers = append(cinderServers, "not found")
+				attachedServers[srv.ID] = srv
 			}
 		}
-		overallNovaAttachmentCount := 0
+		var novaAttachments []NovaAttachmentRecord
 		for _, srv := range server {
+			// attachments can be missing in dumps
+			attachments, ok := attachmentsMap[srv.ID]
+			if !ok || attachments == nil {
+				continue
+			}
 			count := 0
 			var devices []string
-			for _, attachedVolume := range attachmentsMap[srv.ID].VolumeAttachments {
+			for _, attachedVolume := range attachments.VolumeAttachments {
 				if attachedVolume.VolumeID == v.ID {
 					count++
 					devices = append(devices, attachedVolume.Device)
 				}
 			}
 			if count > 0 {
-				novaServers = append(novaServers, fmt.Sprintf(" %dx %s:%v", count, srv.Name, devices))
-				novaServerIDs = append(novaServerIDs, fmt.Sprintf(" %dx %s", count, srv.ID))
-				overallNovaAttachmentCount += count
+				novaAttachments = append(novaAttachments, NovaAttachmentRecord{ServerID: srv.ID, ServerName: srv.Name, Count: count, Devices: devices})
+				attachedServers[srv.ID] = srv
 			}
 		}
-		pvName := "-"
-		pvClaim := "-"
+		objects := VolumeObjects{Volume: v}
+		for _, srv := range attachedServers {
+			objects.Servers = append(objects.Servers, srv)
+		}
+		pvName := ""
+		pvClaim := ""
 		var pods []v1.Pod
 		if pv, ok := pvs[v.ID]; ok {
+			objects.PersistentVolume = &pv
 			pvName = pv.Name
 			pvClaim = fmt.Sprintf("%s/%s", pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name)
 			if allPods, ok := podMap[pvClaim]; ok {
@@ -302,90 +374,151 @@ func (o *VolumesOptions) getPrettyVolumeList(context string, pvs map[string]v1.P
 			}
 		}
 
+		var lines []VolumeRecord
 		if len(pods) == 0 {
-			linesAllColumns = append(linesAllColumns, createLine(v, context, pvClaim, pvName, nil, overallNovaAttachmentCount, cinderServers, cinderServerIDs, novaServers, novaServerIDs))
+			line := createLine(v, context, pvClaim, pvName, nil, cinderAttachments, novaAttachments)
+			line.Objects = &objects
+			lines = append(lines, line)
 		} else {
 			for _, pod := range pods {
-				linesAllColumns = append(linesAllColumns, createLine(v, context, pvClaim, pvName, &pod, overallNovaAttachmentCount, cinderServers, cinderServerIDs, novaServers, novaServerIDs))
+				pod := pod
+				line := createLine(v, context, pvClaim, pvName, &pod, cinderAttachments, novaAttachments)
+				podObjects := objects
+				podObjects.Pod = &pod
+				line.Objects = &podObjects
+				lines = append(lines, line)
+			}
+		}
+		for _, line := range lines {
+			line.Findings = o.checkVolume(line)
+			line.Notes = rules.Messages(line.Findings)
+			if !o.onlyBroken || len(line.Notes) > 0 {
+				records = append(records, line)
 			}
 		}
 	}
+	return records
+}
+
+func (o *VolumesOptions) getPrettyVolumeList(records []VolumeRecord) (string, error) {
+
+	var header []string
+	if !o.noHeader {
+		header = strings.Split(o.columns, ",")
+	}
 
 	var lines [][]string
-	for _, allColumns := range linesAllColumns {
-		_, containsNote := allColumns["NOTE"]
-		if !o.onlyBroken || containsNote {
-			var lineColumns []string
-			for _, column := range strings.Split(o.columns, ",") {
-				lineColumns = append(lineColumns, allColumns[column])
-			}
-			lines = append(lines, lineColumns)
+	for _, r := range records {
+		allColumns := r.columns()
+		var lineColumns []string
+		for _, column := range strings.Split(o.columns, ",") {
+			lineColumns = append(lineColumns, allColumns[column])
 		}
+		lines = append(lines, lineColumns)
 	}
 	if len(lines) > 0 {
-		return output.ConvertToTable(output.Table{header, lines, []int{0, 1, 2}, o.output})
+		return output.ConvertToTable(output.Table{Header: header, Lines: lines, SortIndices: []int{0, 1, 2}, Output: o.output})
 	}
 	return "", nil
 }
 
-func createLine(v volumes.Volume, context, pvClaim string, pvName string, pod *v1.Pod, overallNovaAttachmentCount int, cinderServers []string, cinderServerIDs []string, novaServers []string, novaServerIDs []string) map[string]string {
-
-	podName := "-"
-	podStatus := "-"
-	podNode := "-"
+func createLine(v volumes.Volume, context, pvClaim string, pvName string, pod *v1.Pod, cinderAttachments []ServerReference, novaAttachments []NovaAttachmentRecord) VolumeRecord {
+
+	r := VolumeRecord{
+		Cluster: context,
+		PVC:     pvClaim,
+		PV:      pvName,
+		Cinder: CinderVolumeRecord{
+			ID:          v.ID,
+			Name:        v.Name,
+			Size:        v.Size,
+			Status:      v.Status,
+			Attachments: cinderAttachments,
+		},
+		Nova: novaAttachments,
+	}
 	if pod != nil {
-		podName = pod.Name
-		podStatus = kubernetes.GetPodStatus(pod)
-		podNode = pod.Spec.NodeName
+		r.Pod = pod.Name
+		r.PodStatus = kubernetes.GetPodStatus(pod)
+		r.PodNode = pod.Spec.NodeName
 	}
+	return r
+}
 
-	var notes []string
-	// check error states
-	if overallNovaAttachmentCount >= 2 {
-		notes = append(notes, "multiple attachments")
-	}
-	if podNode != "-" && podStatus != "Completed" && !strings.Contains(strings.Join(cinderServers, " "), podNode) {
-		notes = append(notes, "pod != cinder server")
-	}
-	if podNode != "-" && podStatus != "Completed" && !strings.Contains(strings.Join(novaServers, " "), podNode) {
-		notes = append(notes, "pod != nova server")
-	}
-	if !strings.Contains(strings.Join(novaServers, " "), strings.Join(cinderServers, " ")) {
-		notes = append(notes, "nova != cinder server")
-	}
-	if v.Status == "available" && (len(novaServers) > 0 || len(cinderServers) > 0) {
-		notes = append(notes, "available but attached")
-	}
-	if v.Status == "available" && podName != "-" && podStatus != "Completed" {
-		notes = append(notes, fmt.Sprintf("available but pod %q", podStatus))
-	}
-	if v.Status == "in-use" && (len(novaServers) == 0 || len(cinderServers) == 0) {
-		notes = append(notes, "in-use but not attached")
-	}
-	if strings.Contains(strings.Join(cinderServers, " "), "not found") {
-		notes = append(notes, "attached server not found")
+// cinderServers returns the names and ids of the servers the volume is attached to in Cinder
+func (r VolumeRecord) cinderServers() ([]string, []string) {
+	var names, ids []string
+	for _, a := range r.Cinder.Attachments {
+		ids = append(ids, a.ID)
+		if a.Name != "" {
+			names = append(names, a.Name)
+		} else {
+			names = append(names, "not found")
+		}
 	}
-	if pvClaim == "-" && pvName == "-" && podName == "-" && strings.HasPrefix(v.Name, "kubernetes-dynamic-pvc") {
-		notes = append(notes, "kubernetes disk has no pv/pvc/pod")
+	return names, ids
+}
+
+// novaServers returns the names and ids of the servers the volume is attached to in Nova
+func (r VolumeRecord) novaServers() ([]string, []string) {
+	var names, ids []string
+	for _, a := range r.Nova {
+		names = append(names, fmt.Sprintf(" %dx %s:%v", a.Count, a.ServerName, a.Devices))
+		ids = append(ids, fmt.Sprintf(" %dx %s", a.Count, a.ServerID))
 	}
-	note := strings.Join(notes, ", ")
+	return names, ids
+}
+
+// columns returns the table columns of the record
+func (r VolumeRecord) columns() map[string]string {
+	cinderServers, cinderServerIDs := r.cinderServers()
+	novaServers, novaServerIDs := r.novaServers()
 
 	lineAllColumns := map[string]string{}
-	lineAllColumns["CLUSTER"] = context
-	lineAllColumns["PVC"] = pvClaim
-	lineAllColumns["PV"] = pvName
-	lineAllColumns["POD"] = podName
-	lineAllColumns["POD_NODE"] = podNode
-	lineAllColumns["POD_STATUS"] = podStatus
-	lineAllColumns["CINDER_NAME"] = v.Name
-	lineAllColumns["SIZE"] = fmt.Sprintf("%d", v.Size)
-	lineAllColumns["CINDER_ID"] = v.ID
+	lineAllColumns["CLUSTER"] = r.Cluster
+	lineAllColumns["REGION"] = orDash(r.Region)
+	lineAllColumns["PVC"] = orDash(r.PVC)
+	lineAllColumns["PV"] = orDash(r.PV)
+	lineAllColumns["POD"] = orDash(r.Pod)
+	lineAllColumns["POD_NODE"] = orDash(r.PodNode)
+	lineAllColumns["POD_STATUS"] = orDash(r.PodStatus)
+	lineAllColumns["CINDER_NAME"] = r.Cinder.Name
+	lineAllColumns["SIZE"] = fmt.Sprintf("%d", r.Cinder.Size)
+	lineAllColumns["CINDER_ID"] = r.Cinder.ID
 	lineAllColumns["CINDER_SERVER"] = strings.Join(cinderServers, " ")
 	lineAllColumns["CINDER_SERVER_ID"] = strings.Join(cinderServerIDs, " ")
-	lineAllColumns["CINDER_STATUS"] = v.Status
+	lineAllColumns["CINDER_STATUS"] = r.Cinder.Status
 	lineAllColumns["NOVA_SERVER"] = strings.Join(novaServers, " ")
 	lineAllColumns["NOVA_SERVER_ID"] = strings.Join(novaServerIDs, " ")
-	lineAllColumns["NOTE"] = note
+	lineAllColumns["NOTE"] = strings.Join(r.Notes, ", ")
 
 	return lineAllColumns
 }
+
+// orDash returns "-" for empty table cells
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// volumeFindings returns the findings of all records
+func volumeFindings(records []VolumeRecord) []rules.Finding {
+	var findings []rules.Finding
+	for _, r := range records {
+		findings = append(findings, r.Findings...)
+	}
+	return findings
+}
+
+// volumeNotes returns the notes of all records prefixed with cluster and volume name
+func volumeNotes(records []VolumeRecord) []string {
+	var notes []string
+	for _, r := range records {
+		if len(r.Notes) > 0 {
+			notes = append(notes, fmt.Sprintf("%s/%s: %s", r.Cluster, r.Cinder.Name, strings.Join(r.Notes, ", ")))
+		}
+	}
+	return notes
+}
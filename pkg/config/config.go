@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the configuration of the plugin, it is read from the file set via
+// KUBECTL_OS_CONFIG_FILE or from ~/.kube/kubectl-openstack.yaml
+type Config struct {
+	CloudMapping CloudMapping `yaml:"cloudMapping"`
+	Rules        Rules        `yaml:"rules"`
+}
+
+// CloudMapping configures how the OpenStack cloud of a kube context is determined
+type CloudMapping struct {
+	// Contexts maps kube contexts to clouds
+	Contexts map[string]string `yaml:"contexts"`
+	// Regexps are matched against the kube context in order, the first capture group of the
+	// first matching regexp is used as cloud
+	Regexps []string `yaml:"regexps"`
+}
+
+// Rules configures the consistency rules of volumes and server
+type Rules struct {
+	// Disabled are the ids of the rules which are not checked unless they are selected via --rules
+	Disabled []string `yaml:"disabled"`
+}
+
+// File returns the location of the config file
+func File() string {
+	if file := os.Getenv("KUBECTL_OS_CONFIG_FILE"); file != "" {
+		return file
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "kubectl-openstack.yaml")
+}
+
+// Load reads the config file, an empty config is returned if the file doesn't exist
+func Load() (*Config, error) {
+	config := &Config{}
+
+	file := File()
+	if file == "" {
+		return config, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %v", file, err)
+	}
+
+	err = yaml.Unmarshal(content, config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", file, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,233 @@
+package inventory
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const metadataFile = "metadata.json"
+
+// files returns the objects of the inventory by the file they are stored in
+func (inv *Inventory) files() map[string]interface{} {
+	return map[string]interface{}{
+		metadataFile:                        &inv.Metadata,
+		"openstack/volumes.json":            &inv.OpenStack.Volumes,
+		"openstack/servers.json":            &inv.OpenStack.Servers,
+		"openstack/volume_attachments.json": &inv.OpenStack.VolumeAttachments,
+		"openstack/loadbalancers.json":      &inv.OpenStack.LoadBalancers,
+		"openstack/listeners.json":          &inv.OpenStack.Listeners,
+		"openstack/pools.json":              &inv.OpenStack.Pools,
+		"openstack/members.json":            &inv.OpenStack.Members,
+		"openstack/monitors.json":           &inv.OpenStack.Monitors,
+		"openstack/floatingips.json":        &inv.OpenStack.FloatingIPs,
+		"kubernetes/persistentvolumes.json": &inv.Kubernetes.PersistentVolumes,
+		"kubernetes/pods.json":              &inv.Kubernetes.Pods,
+		"kubernetes/nodes.json":             &inv.Kubernetes.Nodes,
+		"kubernetes/services.json":          &inv.Kubernetes.Services,
+	}
+}
+
+// IsTarball returns true if the dump at file is a tarball instead of a directory
+func IsTarball(file string) bool {
+	return strings.HasSuffix(file, ".tar.gz") || strings.HasSuffix(file, ".tgz")
+}
+
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// contextDirs returns the directory of every context. Unsafe characters are replaced, contexts
+// which end up with the same directory get a numeric suffix.
+func contextDirs(inventories map[string]*Inventory) map[string]string {
+	var contexts []string
+	for context := range inventories {
+		contexts = append(contexts, context)
+	}
+	sort.Strings(contexts)
+
+	dirs := map[string]string{}
+	used := map[string]bool{}
+	for _, context := range contexts {
+		base := unsafeChars.ReplaceAllString(context, "_")
+		dir := base
+		for i := 2; used[dir]; i++ {
+			dir = fmt.Sprintf("%s_%d", base, i)
+		}
+		used[dir] = true
+		dirs[context] = dir
+	}
+	return dirs
+}
+
+// Save writes the dump to a directory with one directory per context or to a gzipped
+// tarball with the same layout if file ends with .tar.gz or .tgz. The dump contains pod specs
+// and thereby possibly secrets, so it's only readable by the user.
+func (d *Dump) Save(file string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	contents := map[string][]byte{}
+	dirs := contextDirs(d.inventories)
+	for context, inv := range d.inventories {
+		dir := dirs[context]
+		for name, obj := range inv.files() {
+			content, err := json.MarshalIndent(obj, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error marshalling %s of context %s: %v", name, context, err)
+			}
+			contents[path.Join(dir, name)] = content
+		}
+	}
+
+	if IsTarball(file) {
+		return writeTarball(file, contents)
+	}
+	for name, content := range contents {
+		f := filepath.Join(file, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+			return fmt.Errorf("error creating dump dir %s: %v", filepath.Dir(f), err)
+		}
+		if err := ioutil.WriteFile(f, content, 0600); err != nil {
+			return fmt.Errorf("error writing dump file %s: %v", f, err)
+		}
+	}
+	return nil
+}
+
+// Load reads a dump written by Save
+func Load(file string) (*Dump, error) {
+	var contents map[string][]byte
+	var err error
+	if IsTarball(file) {
+		contents, err = readTarball(file)
+	} else {
+		contents, err = readDir(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d := NewDump()
+	for name := range contents {
+		dir, base := path.Split(name)
+		if base != metadataFile || strings.Count(dir, "/") != 1 {
+			continue
+		}
+		inv := &Inventory{}
+		// files which are missing in the dump stay empty
+		for name, obj := range inv.files() {
+			content, ok := contents[dir+name]
+			if !ok {
+				continue
+			}
+			if err := json.Unmarshal(content, obj); err != nil {
+				return nil, fmt.Errorf("error parsing dump file %s: %v", dir+name, err)
+			}
+		}
+		if inv.Metadata.Context == "" {
+			return nil, fmt.Errorf("error parsing dump file %s: context is not set", name)
+		}
+		d.inventories[inv.Metadata.Context] = inv
+	}
+	if len(d.inventories) == 0 {
+		return nil, fmt.Errorf("no contexts found in dump %s", file)
+	}
+	return d, nil
+}
+
+func writeTarball(file string, contents map[string][]byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating dump file %s: %v", file, err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	var names []string
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(contents[name])), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("error writing dump file %s: %v", file, err)
+		}
+		if _, err := tw.Write(contents[name]); err != nil {
+			return fmt.Errorf("error writing dump file %s: %v", file, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error writing dump file %s: %v", file, err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("error writing dump file %s: %v", file, err)
+	}
+	return f.Close()
+}
+
+func readTarball(file string) (map[string][]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error opening dump file %s: %v", file, err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dump file %s: %v", file, err)
+	}
+	tr := tar.NewReader(gr)
+
+	contents := map[string][]byte{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading dump file %s: %v", file, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s from dump file %s: %v", header.Name, file, err)
+		}
+		contents[path.Clean(header.Name)] = content
+	}
+	return contents, nil
+}
+
+func readDir(dir string) (map[string][]byte, error) {
+	contents := map[string][]byte{}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		contents[filepath.ToSlash(name)] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading dump dir %s: %v", dir, err)
+	}
+	return contents, nil
+}
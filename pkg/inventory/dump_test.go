@@ -0,0 +1,86 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/pools"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	inventories := []*Inventory{
+		{
+			Metadata: Metadata{Context: "cloud-a-prod", Cloud: "cloud-a", Region: "region-a", Time: time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)},
+			OpenStack: OpenStack{
+				Volumes:           map[string]volumes.Volume{"v1": {ID: "v1", Name: "volume", Status: "in-use", Attachments: []volumes.Attachment{{ServerID: "s1", Device: "/dev/vdb"}}}},
+				Servers:           map[string]servers.Server{"s1": {ID: "s1", Name: "node-1", Status: "ACTIVE"}},
+				VolumeAttachments: map[string]*openstack.NovaVolumeAttachments{"s1": {}},
+				Members:           map[string]pools.Member{"m1": {ID: "m1", PoolID: "p1", ProtocolPort: 30000}},
+			},
+			Kubernetes: Kubernetes{
+				Pods:     []v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default"}}},
+				Services: []v1.Service{{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "default"}}},
+			},
+		},
+		{
+			Metadata: Metadata{Context: "arn:aws:eks/cluster", Cloud: "cloud-b", Time: time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)},
+		},
+		// the directory of this context collides with the one of the previous context
+		{
+			Metadata: Metadata{Context: "arn_aws_eks_cluster", Cloud: "cloud-b", Time: time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, file := range []string{filepath.Join(dir, "dump"), filepath.Join(dir, "dump.tar.gz")} {
+		d := NewDump()
+		for _, inv := range inventories {
+			d.Add(inv)
+		}
+		if err := d.Save(file); err != nil {
+			t.Fatalf("%s: unexpected error: %v", file, err)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", file, err)
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			t.Errorf("%s: expected dump to be only accessible by the user, got %s", file, info.Mode().Perm())
+		}
+
+		loaded, err := Load(file)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", file, err)
+		}
+		if len(loaded.Contexts()) != len(inventories) {
+			t.Errorf("%s: unexpected contexts %v", file, loaded.Contexts())
+		}
+		for _, want := range inventories {
+			got, err := loaded.Get(want.Metadata.Context)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", file, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got %+v, want %+v", file, got, want)
+			}
+		}
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected error for missing dump")
+	}
+}
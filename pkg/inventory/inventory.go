@@ -0,0 +1,216 @@
+package inventory
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/listeners"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/loadbalancers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/monitors"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/pools"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/kubernetes"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/openstack"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/parallel"
+	"k8s.io/api/core/v1"
+	kubeclient "k8s.io/client-go/kubernetes"
+)
+
+// Inventory contains the raw OpenStack and Kubernetes objects of a context which the
+// commands correlate
+type Inventory struct {
+	Metadata   Metadata
+	OpenStack  OpenStack
+	Kubernetes Kubernetes
+}
+
+// Metadata describes where and when an inventory has been fetched
+type Metadata struct {
+	Context string    `json:"context"`
+	Cloud   string    `json:"cloud"`
+	Region  string    `json:"region,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// OpenStack are the OpenStack objects by their id
+type OpenStack struct {
+	Volumes map[string]volumes.Volume
+	Servers map[string]servers.Server
+	// VolumeAttachments are the Nova volume attachments by server id
+	VolumeAttachments map[string]*openstack.NovaVolumeAttachments
+	LoadBalancers     map[string]loadbalancers.LoadBalancer
+	Listeners         map[string]listeners.Listener
+	Pools             map[string]pools.Pool
+	Members           map[string]pools.Member
+	Monitors          map[string]monitors.Monitor
+	FloatingIPs       map[string]floatingips.FloatingIP
+}
+
+// Kubernetes are the Kubernetes objects
+type Kubernetes struct {
+	PersistentVolumes []v1.PersistentVolume
+	Pods              []v1.Pod
+	Nodes             []v1.Node
+	Services          []v1.Service
+}
+
+// Resources selects the resources which are fetched
+type Resources struct {
+	Volumes bool
+	// Servers are always fetched with VolumeAttachments
+	Servers           bool
+	VolumeAttachments bool
+	// LoadBalancers are fetched with their listeners, pools, members, monitors and floating ips
+	LoadBalancers     bool
+	PersistentVolumes bool
+	Pods              bool
+	Nodes             bool
+	Services          bool
+}
+
+// AllResources selects all resources
+var AllResources = Resources{
+	Volumes:           true,
+	Servers:           true,
+	VolumeAttachments: true,
+	LoadBalancers:     true,
+	PersistentVolumes: true,
+	Pods:              true,
+	Nodes:             true,
+	Services:          true,
+}
+
+// Fetch fetches the selected resources concurrently from Kubernetes and OpenStack
+func Fetch(kubeClient *kubeclient.Clientset, osProvider *openstack.Client, resources Resources) (*Inventory, error) {
+	inv := &Inventory{
+		Metadata: Metadata{Region: osProvider.Region, Time: time.Now()},
+	}
+
+	var fns []func() error
+	if resources.PersistentVolumes {
+		fns = append(fns, func() error {
+			var err error
+			inv.Kubernetes.PersistentVolumes, err = kubernetes.ListPersistentVolumes(kubeClient)
+			if err != nil {
+				return fmt.Errorf("error getting persistent volumes from Kubernetes: %w", err)
+			}
+			return nil
+		})
+	}
+	if resources.Pods {
+		fns = append(fns, func() error {
+			var err error
+			inv.Kubernetes.Pods, err = kubernetes.ListPods(kubeClient)
+			if err != nil {
+				return fmt.Errorf("error getting pods from Kubernetes: %w", err)
+			}
+			return nil
+		})
+	}
+	if resources.Nodes {
+		fns = append(fns, func() error {
+			var err error
+			inv.Kubernetes.Nodes, err = kubernetes.ListNodes(kubeClient)
+			if err != nil {
+				return fmt.Errorf("error getting nodes from Kubernetes: %w", err)
+			}
+			return nil
+		})
+	}
+	if resources.Services {
+		fns = append(fns, func() error {
+			var err error
+			inv.Kubernetes.Services, err = kubernetes.ListServices(kubeClient)
+			if err != nil {
+				return fmt.Errorf("error getting services from Kubernetes: %w", err)
+			}
+			return nil
+		})
+	}
+	if resources.Volumes {
+		fns = append(fns, func() error {
+			var err error
+			inv.OpenStack.Volumes, err = openstack.GetVolumes(osProvider)
+			if err != nil {
+				return fmt.Errorf("error getting volumes from OpenStack: %w", err)
+			}
+			return nil
+		})
+	}
+	if resources.Servers || resources.VolumeAttachments {
+		fns = append(fns, func() error {
+			var err error
+			inv.OpenStack.Servers, err = openstack.GetServer(osProvider)
+			if err != nil {
+				return fmt.Errorf("error getting servers from OpenStack: %w", err)
+			}
+			if !resources.VolumeAttachments {
+				return nil
+			}
+			inv.OpenStack.VolumeAttachments, err = openstack.GetVolumeAttachmentsForServerNova(osProvider, inv.OpenStack.Servers)
+			if err != nil {
+				return fmt.Errorf("error getting attachments from OpenStack: %w", err)
+			}
+			return nil
+		})
+	}
+	if resources.LoadBalancers {
+		fns = append(fns, func() error {
+			var err error
+			openStack := &inv.OpenStack
+			openStack.LoadBalancers, openStack.Listeners, openStack.Pools, openStack.Members, openStack.Monitors, openStack.FloatingIPs, err = openstack.GetLB(osProvider)
+			if err != nil {
+				return fmt.Errorf("error getting loadbalancers from OpenStack: %w", err)
+			}
+			return nil
+		})
+	}
+
+	if err := parallel.Run(len(fns), fns...); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Dump is a set of inventories, e.g. written by the dump command
+type Dump struct {
+	inventories map[string]*Inventory
+	lock        sync.Mutex
+}
+
+// NewDump returns an empty dump
+func NewDump() *Dump {
+	return &Dump{inventories: map[string]*Inventory{}}
+}
+
+// Add adds the inventory of a context, it is safe to call Add concurrently
+func (d *Dump) Add(inv *Inventory) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.inventories[inv.Metadata.Context] = inv
+}
+
+// Get returns the inventory of the context
+func (d *Dump) Get(context string) (*Inventory, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	inv, ok := d.inventories[context]
+	if !ok {
+		return nil, fmt.Errorf("context %s not found in dump", context)
+	}
+	return inv, nil
+}
+
+// Contexts returns the contexts of the dump
+func (d *Dump) Contexts() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var contexts []string
+	for context := range d.inventories {
+		contexts = append(contexts, context)
+	}
+	return contexts
+}
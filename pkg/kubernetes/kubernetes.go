@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd/api"
@@ -12,6 +13,37 @@ import (
 	"strings"
 )
 
+// GetRestConfig returns the rest config of the context via the kubeconfig loader, so all auth mechanisms
+// of the kubeconfig (tokens, exec and auth provider plugins, cert files, proxies, ...) are supported. All
+// other config flags (e.g. --token or --insecure-skip-tls-verify) still override the kubeconfig.
+func GetRestConfig(configFlags *genericclioptions.ConfigFlags, context string) (*rest.Config, error) {
+	// the context flag is a list of regexps, so a copy of the flags with the context is used
+	contextFlags := genericclioptions.NewConfigFlags(false)
+	contextFlags.CacheDir = configFlags.CacheDir
+	contextFlags.KubeConfig = configFlags.KubeConfig
+	contextFlags.ClusterName = configFlags.ClusterName
+	contextFlags.AuthInfoName = configFlags.AuthInfoName
+	contextFlags.Context = &context
+	contextFlags.Namespace = configFlags.Namespace
+	contextFlags.APIServer = configFlags.APIServer
+	contextFlags.Insecure = configFlags.Insecure
+	contextFlags.CertFile = configFlags.CertFile
+	contextFlags.KeyFile = configFlags.KeyFile
+	contextFlags.CAFile = configFlags.CAFile
+	contextFlags.BearerToken = configFlags.BearerToken
+	contextFlags.Impersonate = configFlags.Impersonate
+	contextFlags.ImpersonateGroup = configFlags.ImpersonateGroup
+	contextFlags.Username = configFlags.Username
+	contextFlags.Password = configFlags.Password
+	contextFlags.Timeout = configFlags.Timeout
+
+	config, err := contextFlags.ToRESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig for context %s: %v", context, err)
+	}
+	return config, nil
+}
+
 func GetKubeClient(config *rest.Config) (*kubernetes.Clientset, error) {
 	clientSet, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -21,42 +53,60 @@ func GetKubeClient(config *rest.Config) (*kubernetes.Clientset, error) {
 	return clientSet, nil
 }
 
-func GetNodes(kubeClient *kubernetes.Clientset) (map[string]v1.Node, error) {
+// ListNodes lists all nodes
+func ListNodes(kubeClient *kubernetes.Clientset) ([]v1.Node, error) {
 	nodes, err := kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("error getting persistent volumes: %v", err)
+		return nil, fmt.Errorf("error getting nodes: %w", err)
 	}
+	return nodes.Items, nil
+}
+
+// NodesByServerID returns the nodes by the id of their OpenStack server
+func NodesByServerID(nodes []v1.Node) map[string]v1.Node {
 	nodesMap := map[string]v1.Node{}
-	for _, node := range nodes.Items {
+	for _, node := range nodes {
 		osID := strings.TrimPrefix(node.Spec.ProviderID, "openstack:///")
 		nodesMap[osID] = node
 	}
-	return nodesMap, nil
+	return nodesMap
 }
 
-func GetServices(kubeClient *kubernetes.Clientset) (map[int32]v1.Service, error) {
+// ListServices lists the services of all namespaces
+func ListServices(kubeClient *kubernetes.Clientset) ([]v1.Service, error) {
 	services, err := kubeClient.CoreV1().Services("").List(metav1.ListOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("error getting persistent volumes: %v", err)
+		return nil, fmt.Errorf("error getting services: %w", err)
 	}
+	return services.Items, nil
+}
+
+// ServicesByNodePort returns the services by their node ports
+func ServicesByNodePort(services []v1.Service) map[int32]v1.Service {
 	servicesMap := map[int32]v1.Service{}
-	for _, svc := range services.Items {
+	for _, svc := range services {
 		for _, port := range svc.Spec.Ports {
 			if port.NodePort != 0 {
 				servicesMap[int32(port.NodePort)] = svc
 			}
 		}
 	}
-	return servicesMap, nil
+	return servicesMap
 }
 
-func GetPersistentVolumes(kubeClient *kubernetes.Clientset) (map[string]v1.PersistentVolume, error) {
+// ListPersistentVolumes lists all persistent volumes
+func ListPersistentVolumes(kubeClient *kubernetes.Clientset) ([]v1.PersistentVolume, error) {
 	pvs, err := kubeClient.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("error getting persistent volumes: %v", err)
+		return nil, fmt.Errorf("error getting persistent volumes: %w", err)
 	}
+	return pvs.Items, nil
+}
+
+// PersistentVolumesByVolumeID returns the Cinder and CSI persistent volumes by the id of their Cinder volume
+func PersistentVolumesByVolumeID(pvs []v1.PersistentVolume) map[string]v1.PersistentVolume {
 	pvMap := map[string]v1.PersistentVolume{}
-	for _, pv := range pvs.Items {
+	for _, pv := range pvs {
 		if pv.Spec.Cinder != nil {
 			// TODO log(skipping pv because it is no cinder volume)
 			pvMap[pv.Spec.Cinder.VolumeID] = pv
@@ -68,16 +118,22 @@ func GetPersistentVolumes(kubeClient *kubernetes.Clientset) (map[string]v1.Persi
 			continue
 		}
 	}
-	return pvMap, nil
+	return pvMap
 }
 
-func GetPodsByPVC(kubeClient *kubernetes.Clientset) (map[string][]v1.Pod, error) {
+// ListPods lists the pods of all namespaces
+func ListPods(kubeClient *kubernetes.Clientset) ([]v1.Pod, error) {
 	pods, err := kubeClient.CoreV1().Pods("").List(metav1.ListOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("error getting pods: %v", err)
+		return nil, fmt.Errorf("error getting pods: %w", err)
 	}
+	return pods.Items, nil
+}
+
+// PodsByPVC returns the pods by the <namespace>/<name> of the persistent volume claims they use
+func PodsByPVC(pods []v1.Pod) map[string][]v1.Pod {
 	podMap := map[string][]v1.Pod{}
-	for _, pod := range pods.Items {
+	for _, pod := range pods {
 		for _, volume := range pod.Spec.Volumes {
 			if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName != "" {
 				pvcName := fmt.Sprintf("%s/%s", pod.Namespace, volume.PersistentVolumeClaim.ClaimName)
@@ -90,7 +146,7 @@ func GetPodsByPVC(kubeClient *kubernetes.Clientset) (map[string][]v1.Pod, error)
 			}
 		}
 	}
-	return podMap, nil
+	return podMap
 }
 
 func GetMatchingContexts(config api.Config, context string) []string {
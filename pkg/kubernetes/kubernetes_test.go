@@ -0,0 +1,79 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestGetRestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubernetes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kubeconfig := filepath.Join(dir, "config")
+	content := `
+apiVersion: v1
+kind: Config
+current-context: token
+clusters:
+- name: a
+  cluster:
+    server: https://a:6443
+    insecure-skip-tls-verify: true
+- name: b
+  cluster:
+    server: https://b:6443
+users:
+- name: token
+  user:
+    token: secret
+- name: exec
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: get-token
+contexts:
+- name: token
+  context:
+    cluster: a
+    user: token
+- name: exec
+  context:
+    cluster: b
+    user: exec
+`
+	if err := ioutil.WriteFile(kubeconfig, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	configFlags.KubeConfig = &kubeconfig
+	contexts := "token,exec"
+	configFlags.Context = &contexts
+
+	config, err := GetRestConfig(configFlags, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Host != "https://a:6443" || config.BearerToken != "secret" || !config.Insecure {
+		t.Errorf("unexpected config for context token: %+v", config)
+	}
+
+	config, err = GetRestConfig(configFlags, "exec")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Host != "https://b:6443" || config.ExecProvider == nil || config.ExecProvider.Command != "get-token" {
+		t.Errorf("unexpected config for context exec: %+v", config)
+	}
+
+	if _, err := GetRestConfig(configFlags, "missing"); err == nil {
+		t.Errorf("expected error for missing context")
+	}
+}
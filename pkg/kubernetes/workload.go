@@ -0,0 +1,158 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Workload is a StatefulSet or Deployment which owns pods
+type Workload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Replicas are the replicas of the spec
+	Replicas int32 `json:"replicas"`
+}
+
+func (w Workload) String() string {
+	return fmt.Sprintf("%s %s/%s", w.Kind, w.Namespace, w.Name)
+}
+
+// GetWorkload returns the StatefulSet or Deployment which owns the pod. The Deployment is found via
+// the ReplicaSet of the pod. nil is returned if the pod isn't owned by one of them.
+func GetWorkload(kubeClient kubernetes.Interface, pod v1.Pod) (*Workload, error) {
+	owner := metav1.GetControllerOf(&pod)
+	if owner == nil {
+		return nil, nil
+	}
+
+	switch owner.Kind {
+	case "StatefulSet":
+		sts, err := kubeClient.AppsV1().StatefulSets(pod.Namespace).Get(owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting statefulset %s/%s: %w", pod.Namespace, owner.Name, err)
+		}
+		return &Workload{Kind: "StatefulSet", Namespace: sts.Namespace, Name: sts.Name, Replicas: replicas(sts.Spec.Replicas)}, nil
+	case "ReplicaSet":
+		rs, err := kubeClient.AppsV1().ReplicaSets(pod.Namespace).Get(owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting replicaset %s/%s: %w", pod.Namespace, owner.Name, err)
+		}
+		rsOwner := metav1.GetControllerOf(rs)
+		if rsOwner == nil || rsOwner.Kind != "Deployment" {
+			return nil, nil
+		}
+		deployment, err := kubeClient.AppsV1().Deployments(pod.Namespace).Get(rsOwner.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error getting deployment %s/%s: %w", pod.Namespace, rsOwner.Name, err)
+		}
+		return &Workload{Kind: "Deployment", Namespace: deployment.Namespace, Name: deployment.Name, Replicas: replicas(deployment.Spec.Replicas)}, nil
+	}
+	return nil, nil
+}
+
+// replicas defaults the replicas of a spec to 1 like the API server
+func replicas(r *int32) int32 {
+	if r == nil {
+		return 1
+	}
+	return *r
+}
+
+// ScaleWorkload sets the replicas of the StatefulSet or Deployment
+func ScaleWorkload(kubeClient kubernetes.Interface, w Workload, replicas int32) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	var err error
+	switch w.Kind {
+	case "StatefulSet":
+		_, err = kubeClient.AppsV1().StatefulSets(w.Namespace).Patch(w.Name, types.MergePatchType, patch)
+	case "Deployment":
+		_, err = kubeClient.AppsV1().Deployments(w.Namespace).Patch(w.Name, types.MergePatchType, patch)
+	default:
+		return fmt.Errorf("error scaling %s: unsupported kind", w)
+	}
+	if err != nil {
+		return fmt.Errorf("error scaling %s to %d replicas: %w", w, replicas, err)
+	}
+	return nil
+}
+
+// SetUnschedulable cordons or uncordons the node
+func SetUnschedulable(kubeClient kubernetes.Interface, node string, unschedulable bool) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable))
+	if _, err := kubeClient.CoreV1().Nodes().Patch(node, types.MergePatchType, patch); err != nil {
+		return fmt.Errorf("error setting node %s unschedulable to %t: %w", node, unschedulable, err)
+	}
+	return nil
+}
+
+// IsUnschedulable returns true if the node is cordoned
+func IsUnschedulable(kubeClient kubernetes.Interface, node string) (bool, error) {
+	n, err := kubeClient.CoreV1().Nodes().Get(node, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("error getting node %s: %w", node, err)
+	}
+	return n.Spec.Unschedulable, nil
+}
+
+// EvictPod evicts the pod via the eviction API, so pod disruption budgets are respected. A pod
+// which doesn't exist anymore is not an error.
+func EvictPod(kubeClient kubernetes.Interface, pod v1.Pod) error {
+	eviction := &policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+	}
+	if err := kubeClient.CoreV1().Pods(pod.Namespace).Evict(eviction); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error evicting pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
+
+// ListPodsOfPVC lists the pods of the namespace which use the pvc and are not terminated
+func ListPodsOfPVC(kubeClient kubernetes.Interface, namespace, claim string) ([]v1.Pod, error) {
+	list, err := kubeClient.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods of namespace %s: %w", namespace, err)
+	}
+	var pods []v1.Pod
+	for _, pod := range PodsByPVC(list.Items)[fmt.Sprintf("%s/%s", namespace, claim)] {
+		if pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// WaitForPodsDeleted polls the pods until none of them exists anymore. A pod with the same name
+// but a different uid, e.g. re-created by a StatefulSet, counts as deleted.
+func WaitForPodsDeleted(kubeClient kubernetes.Interface, pods []v1.Pod, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var remaining []string
+		for _, pod := range pods {
+			current, err := kubeClient.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("error getting pod %s/%s: %w", pod.Namespace, pod.Name, err)
+			}
+			if current.UID == pod.UID {
+				remaining = append(remaining, fmt.Sprintf("%s/%s", pod.Namespace, pod.Name))
+			}
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("pods %v are not terminated after %s", remaining, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
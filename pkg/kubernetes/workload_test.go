@@ -0,0 +1,80 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func controlledBy(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func TestGetWorkload(t *testing.T) {
+	three := int32(3)
+	kubeClient := fake.NewSimpleClientset(
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db"}, Spec: appsv1.StatefulSetSpec{Replicas: &three}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app"}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app-123", OwnerReferences: controlledBy("Deployment", "app")}},
+	)
+
+	tests := []struct {
+		name     string
+		pod      v1.Pod
+		workload *Workload
+	}{
+		{
+			name:     "statefulset",
+			pod:      v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db-0", OwnerReferences: controlledBy("StatefulSet", "db")}},
+			workload: &Workload{Kind: "StatefulSet", Namespace: "ns", Name: "db", Replicas: 3},
+		},
+		{
+			name:     "deployment",
+			pod:      v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app-123-abc", OwnerReferences: controlledBy("ReplicaSet", "app-123")}},
+			workload: &Workload{Kind: "Deployment", Namespace: "ns", Name: "app", Replicas: 1},
+		},
+		{
+			name: "bare pod",
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "debug"}},
+		},
+	}
+	for _, tt := range tests {
+		workload, err := GetWorkload(kubeClient, tt.pod)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if (workload == nil) != (tt.workload == nil) || workload != nil && *workload != *tt.workload {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.workload, workload)
+		}
+	}
+
+	if err := ScaleWorkload(kubeClient, Workload{Kind: "StatefulSet", Namespace: "ns", Name: "db"}, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sts, err := kubeClient.AppsV1().StatefulSets("ns").Get("db", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *sts.Spec.Replicas != 0 {
+		t.Errorf("expected statefulset to be scaled to 0, got %d", *sts.Spec.Replicas)
+	}
+}
+
+func TestWaitForPodsDeleted(t *testing.T) {
+	running := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db-0", UID: "1"}}
+	kubeClient := fake.NewSimpleClientset(&running)
+
+	deleted := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db-1", UID: "2"}}
+	recreated := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "db-0", UID: "0"}}
+	if err := WaitForPodsDeleted(kubeClient, []v1.Pod{deleted, recreated}, time.Second, time.Millisecond); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := WaitForPodsDeleted(kubeClient, []v1.Pod{running}, 5*time.Millisecond, time.Millisecond); err == nil {
+		t.Errorf("expected error for running pod")
+	}
+}
@@ -0,0 +1,347 @@
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/utils"
+	"k8s.io/klog"
+)
+
+// attachmentsMicroversion is the Cinder microversion which introduced the attachments API
+const attachmentsMicroversion = "3.27"
+
+// CinderAttachment is an attachment record of the Cinder attachments API
+type CinderAttachment struct {
+	ID         string `json:"id"`
+	VolumeID   string `json:"volume_id"`
+	Instance   string `json:"instance"`
+	Status     string `json:"status"`
+	AttachMode string `json:"attach_mode,omitempty"`
+	AttachedAt string `json:"attached_at,omitempty"`
+}
+
+type cinderAttachments struct {
+	Attachments []CinderAttachment `json:"attachments"`
+}
+
+type cinderResetStatusVolume struct {
+	OsResetStatus *cinderResetStatus `json:"os-reset_status"`
+}
+
+type cinderResetStatus struct {
+	Status       string `json:"status,omitempty"`
+	AttachStatus string `json:"attach_status,omitempty"`
+}
+
+// ResetVolumeStatus resets the status and/or the attach status of the volume in the Cinder
+// database via os-reset_status, nothing is changed on the servers
+func ResetVolumeStatus(osProvider *Client, volumeID, status, attachStatus string) error {
+
+	blockStorageClient, err := osProvider.blockStorageV3()
+	if err != nil {
+		return fmt.Errorf("error creating volume client: %v", err)
+	}
+
+	url := blockStorageClient.ServiceURL("volumes", volumeID, "action")
+
+	reset := &cinderResetStatusVolume{
+		OsResetStatus: &cinderResetStatus{
+			Status:       status,
+			AttachStatus: attachStatus,
+		},
+	}
+	if osProvider.DryRun != nil {
+		return printRequest(osProvider.DryRun, http.MethodPost, url, reset)
+	}
+
+	fmt.Printf("Resetting status of volume %s in cinder (status: %s, attach status: %s)\n", volumeID, status, attachStatus)
+
+	_, err = osProvider.changeVolume(blockStorageClient, volumeChange{
+		action:   "reset-status",
+		volumeID: volumeID,
+		method:   http.MethodPost,
+		url:      url,
+		body:     reset,
+		okCodes:  []int{202},
+	})
+	if err != nil {
+		return fmt.Errorf("error resetting status of volume: %v", err)
+	}
+	return nil
+}
+
+// GetAttachmentsCinder lists the attachment records of the volume via the Cinder attachments API
+func GetAttachmentsCinder(osProvider *Client, volumeID string) ([]CinderAttachment, error) {
+
+	blockStorageClient, err := osProvider.blockStorageV3()
+	if err != nil {
+		return nil, fmt.Errorf("error creating volume client: %v", err)
+	}
+	microversion, err := negotiateVolumeMicroversion(blockStorageClient, attachmentsMicroversion)
+	if err != nil {
+		return nil, err
+	}
+
+	url := blockStorageClient.ServiceURL("attachments", "detail") + "?volume_id=" + volumeID
+
+	attachments := &cinderAttachments{}
+	_, err = blockStorageClient.Get(url, attachments, &gophercloud.RequestOpts{OkCodes: []int{200}, MoreHeaders: volumeMicroversionHeaders(microversion)})
+	if err != nil {
+		return nil, fmt.Errorf("error getting attachments of volume %s: %v", volumeID, err)
+	}
+	return attachments.Attachments, nil
+}
+
+// DeleteAttachmentCinder deletes an attachment record of the volume via the Cinder attachments API
+func DeleteAttachmentCinder(osProvider *Client, volumeID, attachmentID string) error {
+
+	blockStorageClient, err := osProvider.blockStorageV3()
+	if err != nil {
+		return fmt.Errorf("error creating volume client: %v", err)
+	}
+	microversion, err := negotiateVolumeMicroversion(blockStorageClient, attachmentsMicroversion)
+	if err != nil {
+		return err
+	}
+
+	url := blockStorageClient.ServiceURL("attachments", attachmentID)
+	if osProvider.DryRun != nil {
+		return printRequest(osProvider.DryRun, http.MethodDelete, url, nil)
+	}
+
+	fmt.Printf("Deleting attachment %s of volume %s in cinder\n", attachmentID, volumeID)
+
+	_, err = osProvider.changeVolume(blockStorageClient, volumeChange{
+		action:   "delete-attachment",
+		volumeID: volumeID,
+		method:   http.MethodDelete,
+		url:      url,
+		okCodes:  []int{200},
+		headers:  volumeMicroversionHeaders(microversion),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting attachment %s: %v", attachmentID, err)
+	}
+	return nil
+}
+
+// DeleteVolumeCinder deletes the volume in Cinder
+func DeleteVolumeCinder(osProvider *Client, volumeID string) error {
+
+	blockStorageClient, err := osProvider.blockStorageV3()
+	if err != nil {
+		return fmt.Errorf("error creating volume client: %v", err)
+	}
+
+	url := blockStorageClient.ServiceURL("volumes", volumeID)
+	if osProvider.DryRun != nil {
+		return printRequest(osProvider.DryRun, http.MethodDelete, url, nil)
+	}
+
+	fmt.Printf("Deleting volume %s in cinder\n", volumeID)
+
+	_, err = osProvider.changeVolume(blockStorageClient, volumeChange{
+		action:   "delete-volume",
+		volumeID: volumeID,
+		method:   http.MethodDelete,
+		url:      url,
+		okCodes:  []int{202},
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting volume %s: %v", volumeID, err)
+	}
+	return nil
+}
+
+// CinderBackup is a backup of a volume in Cinder
+type CinderBackup struct {
+	ID       string `json:"id"`
+	VolumeID string `json:"volume_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+type cinderBackupResponse struct {
+	Backup *CinderBackup `json:"backup"`
+}
+
+type cinderCreateBackup struct {
+	Backup *cinderBackupOpts `json:"backup"`
+}
+
+type cinderBackupOpts struct {
+	VolumeID    string `json:"volume_id"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// BackupVolumeCinder creates a backup of the volume and returns its id. Contrary to a snapshot
+// the backup doesn't depend on the volume, so the volume can be deleted afterwards. The id is
+// empty in dry-run mode.
+func BackupVolumeCinder(osProvider *Client, volumeID, name, description string) (string, error) {
+
+	blockStorageClient, err := osProvider.blockStorageV3()
+	if err != nil {
+		return "", fmt.Errorf("error creating volume client: %v", err)
+	}
+
+	url := blockStorageClient.ServiceURL("backups")
+
+	backup := &cinderCreateBackup{
+		Backup: &cinderBackupOpts{
+			VolumeID:    volumeID,
+			Name:        name,
+			Description: description,
+		},
+	}
+	if osProvider.DryRun != nil {
+		return "", printRequest(osProvider.DryRun, http.MethodPost, url, backup)
+	}
+
+	fmt.Printf("Creating backup %s of volume %s in cinder\n", name, volumeID)
+
+	body, err := osProvider.changeVolume(blockStorageClient, volumeChange{
+		action:   "backup-volume",
+		volumeID: volumeID,
+		method:   http.MethodPost,
+		url:      url,
+		body:     backup,
+		okCodes:  []int{202},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating backup of volume %s: %v", volumeID, err)
+	}
+	created := &cinderBackupResponse{}
+	if err := json.Unmarshal(body, created); err != nil || created.Backup == nil {
+		return "", fmt.Errorf("error parsing backup of volume %s: %s", volumeID, string(body))
+	}
+	return created.Backup.ID, nil
+}
+
+// WaitForBackup polls the backup until it's available. It fails if the backup is in error or
+// not available within timeout.
+func WaitForBackup(osProvider *Client, backupID string, timeout, interval time.Duration) error {
+
+	blockStorageClient, err := osProvider.blockStorageV3()
+	if err != nil {
+		return fmt.Errorf("error creating volume client: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		backup := &cinderBackupResponse{}
+		_, err := blockStorageClient.Get(blockStorageClient.ServiceURL("backups", backupID), backup, &gophercloud.RequestOpts{OkCodes: []int{200}})
+		if err != nil {
+			return fmt.Errorf("error getting backup %s: %v", backupID, err)
+		}
+		status := ""
+		if backup.Backup != nil {
+			status = backup.Backup.Status
+		}
+		switch status {
+		case "available":
+			return nil
+		case "error":
+			return fmt.Errorf("backup %s failed", backupID)
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("backup %s isn't available within %s, status is %s", backupID, timeout, status)
+		}
+		klog.V(1).Infof("Waiting for backup %s: status is %s", backupID, status)
+		time.Sleep(interval)
+	}
+}
+
+// volumeMicroversionHeaders are the headers which request the microversion from Cinder. The
+// Microversion field of the service client isn't used as it's shared and gophercloud sets the
+// header only for the volume service type, not for volumev3.
+func volumeMicroversionHeaders(microversion string) map[string]string {
+	return map[string]string{
+		"OpenStack-API-Version": "volume " + microversion,
+	}
+}
+
+// negotiateVolumeMicroversion returns the microversion if the Cinder endpoint supports it. The
+// supported microversions are read from the versions document of the endpoint.
+func negotiateVolumeMicroversion(sc *gophercloud.ServiceClient, microversion string) (string, error) {
+	base, err := utils.BaseEndpoint(sc.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("error negotiating microversion: %v", err)
+	}
+
+	var versions struct {
+		Versions []struct {
+			ID         string `json:"id"`
+			Version    string `json:"version"`
+			MinVersion string `json:"min_version"`
+		} `json:"versions"`
+	}
+	// the versions document is returned with 300 Multiple Choices
+	_, err = sc.Get(base, &versions, &gophercloud.RequestOpts{OkCodes: []int{200, 300}})
+	if err != nil {
+		return "", fmt.Errorf("error negotiating microversion: %v", err)
+	}
+
+	for _, v := range versions.Versions {
+		if !strings.HasPrefix(v.ID, "v3") {
+			continue
+		}
+		if v.Version == "" {
+			break
+		}
+		min, err := compareMicroversions(v.MinVersion, microversion)
+		if err != nil {
+			return "", fmt.Errorf("error negotiating microversion: %v", err)
+		}
+		max, err := compareMicroversions(microversion, v.Version)
+		if err != nil {
+			return "", fmt.Errorf("error negotiating microversion: %v", err)
+		}
+		if min > 0 || max > 0 {
+			return "", fmt.Errorf("error negotiating microversion: Cinder supports %s to %s, %s is required", v.MinVersion, v.Version, microversion)
+		}
+		return microversion, nil
+	}
+	return "", fmt.Errorf("error negotiating microversion: Cinder at %s doesn't support microversions, %s is required", base, microversion)
+}
+
+// compareMicroversions returns -1, 0 or 1 if a is lower, equal or greater than b
+func compareMicroversions(a, b string) (int, error) {
+	aMajor, aMinor, err := parseMicroversion(a)
+	if err != nil {
+		return 0, err
+	}
+	bMajor, bMinor, err := parseMicroversion(b)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case aMajor < bMajor, aMajor == bMajor && aMinor < bMinor:
+		return -1, nil
+	case aMajor == bMajor && aMinor == bMinor:
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func parseMicroversion(v string) (int, int, error) {
+	parts := strings.Split(v, ".")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid microversion %q", v)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid microversion %q", v)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid microversion %q", v)
+	}
+	return major, minor, nil
+}
@@ -0,0 +1,130 @@
+package openstack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestAttachmentsCinder(t *testing.T) {
+	maxVersion := "3.59"
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/volume/":
+			w.WriteHeader(http.StatusMultipleChoices)
+			fmt.Fprintf(w, `{"versions": [{"id": "v2.0", "version": ""}, {"id": "v3.0", "version": %q, "min_version": "3.0"}]}`, maxVersion)
+		case r.Header.Get("OpenStack-API-Version") != "volume 3.27":
+			w.WriteHeader(http.StatusBadRequest)
+		case r.Method == http.MethodGet && r.URL.Path == "/volume/v3/project/attachments/detail" && r.URL.Query().Get("volume_id") == "v1":
+			fmt.Fprint(w, `{"attachments": [{"id": "a1", "volume_id": "v1", "instance": "s1", "status": "attached"}]}`)
+		case r.Method == http.MethodDelete && r.URL.Path == "/volume/v3/project/attachments/a1":
+			deleted = append(deleted, "a1")
+			fmt.Fprint(w, `{"attachments": []}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newClient(&gophercloud.ProviderClient{HTTPClient: *server.Client()}, "", "", map[string]string{
+		serviceBlockStorage: server.URL + "/volume/v3/project",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	attachments, err := GetAttachmentsCinder(client, "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].ID != "a1" || attachments[0].Instance != "s1" {
+		t.Errorf("unexpected attachments: %+v", attachments)
+	}
+	if err := DeleteAttachmentCinder(client, "v1", "a1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("expected attachment to be deleted, got %v", deleted)
+	}
+
+	maxVersion = "3.12"
+	if _, err := GetAttachmentsCinder(client, "v1"); err == nil {
+		t.Errorf("expected error for unsupported microversion")
+	}
+}
+
+func TestBackupAndDeleteVolume(t *testing.T) {
+	status := "creating"
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/volume/v3/project/backups":
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"backup": {"id": "b1", "name": "backup-v1"}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/volume/v3/project/backups/b1":
+			fmt.Fprintf(w, `{"backup": {"id": "b1", "volume_id": "v1", "status": %q}}`, status)
+			status = "available"
+		case r.Method == http.MethodDelete && r.URL.Path == "/volume/v3/project/volumes/v1":
+			deleted = append(deleted, "v1")
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newClient(&gophercloud.ProviderClient{HTTPClient: *server.Client()}, "", "", map[string]string{
+		serviceBlockStorage: server.URL + "/volume/v3/project",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	backupID, err := BackupVolumeCinder(client, "v1", "backup-v1", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if backupID != "b1" {
+		t.Errorf("expected backup b1, got %q", backupID)
+	}
+	if err := WaitForBackup(client, backupID, time.Second, time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := DeleteVolumeCinder(client, "v1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("expected volume to be deleted, got %v", deleted)
+	}
+}
+
+func TestCompareMicroversions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "3.27", b: "3.27", expected: 0},
+		{a: "3.9", b: "3.27", expected: -1},
+		{a: "3.60", b: "3.27", expected: 1},
+		{a: "2.99", b: "3.0", expected: -1},
+	}
+	for _, tt := range tests {
+		got, err := compareMicroversions(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.expected {
+			t.Errorf("compareMicroversions(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+	if _, err := compareMicroversions("3", "3.27"); err == nil {
+		t.Errorf("expected error for invalid microversion")
+	}
+}
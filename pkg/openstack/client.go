@@ -0,0 +1,142 @@
+package openstack
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/audit"
+	"k8s.io/klog"
+)
+
+// service names as used in the <service>_endpoint_override keys of clouds.yaml
+const (
+	serviceBlockStorage = "block_storage"
+	serviceCompute      = "compute"
+	serviceNetwork      = "network"
+)
+
+// defaultConcurrency is the default number of concurrent requests of a client
+const defaultConcurrency = 10
+
+// Client is an authenticated OpenStack client together with the endpoint configuration of its cloud
+type Client struct {
+	*gophercloud.ProviderClient
+
+	// Region is the configured region, if empty the first endpoint of the catalog is used
+	Region string
+	// Concurrency is the maximum number of concurrent requests, e.g. when listing the attachments of all servers
+	Concurrency int
+	// DryRun is set to print the requests which change volumes instead of sending them
+	DryRun io.Writer
+	// Audit records the requests which change volumes
+	Audit *audit.Log
+
+	endpointOpts      gophercloud.EndpointOpts
+	endpointOverrides map[string]string
+
+	// serviceClients are created once per service and reused
+	serviceClients     map[string]*gophercloud.ServiceClient
+	serviceClientsLock sync.Mutex
+}
+
+func newClient(providerClient *gophercloud.ProviderClient, region, endpointInterface string, endpointOverrides map[string]string) (*Client, error) {
+	availability, err := getAvailability(endpointInterface)
+	if err != nil {
+		return nil, err
+	}
+	overrides := map[string]string{}
+	for service, endpoint := range endpointOverrides {
+		if endpoint != "" {
+			overrides[service] = endpoint
+		}
+	}
+	return &Client{
+		ProviderClient: providerClient,
+		Region:         region,
+		Concurrency:    defaultConcurrency,
+		endpointOpts: gophercloud.EndpointOpts{
+			Region:       region,
+			Availability: availability,
+		},
+		endpointOverrides: overrides,
+		serviceClients:    map[string]*gophercloud.ServiceClient{},
+	}, nil
+}
+
+// getAvailability maps the interface to the availability of the endpoints, the interface
+// can be set with or without the URL suffix, e.g. internal or internalURL
+func getAvailability(endpointInterface string) (gophercloud.Availability, error) {
+	switch strings.TrimSuffix(endpointInterface, "URL") {
+	case "", "public":
+		return gophercloud.AvailabilityPublic, nil
+	case "internal":
+		return gophercloud.AvailabilityInternal, nil
+	case "admin":
+		return gophercloud.AvailabilityAdmin, nil
+	}
+	return "", fmt.Errorf("unsupported interface %q", endpointInterface)
+}
+
+func (c *Client) blockStorageV3() (*gophercloud.ServiceClient, error) {
+	return c.serviceClient(serviceBlockStorage, func() (*gophercloud.ServiceClient, error) {
+		if endpoint, ok := c.endpointOverrides[serviceBlockStorage]; ok {
+			return c.serviceClientForEndpoint(endpoint, "volumev3"), nil
+		}
+		return openstack.NewBlockStorageV3(c.ProviderClient, c.endpointOpts)
+	})
+}
+
+func (c *Client) computeV2() (*gophercloud.ServiceClient, error) {
+	return c.serviceClient(serviceCompute, func() (*gophercloud.ServiceClient, error) {
+		if endpoint, ok := c.endpointOverrides[serviceCompute]; ok {
+			return c.serviceClientForEndpoint(endpoint, "compute"), nil
+		}
+		return openstack.NewComputeV2(c.ProviderClient, c.endpointOpts)
+	})
+}
+
+func (c *Client) networkV2() (*gophercloud.ServiceClient, error) {
+	return c.serviceClient(serviceNetwork, func() (*gophercloud.ServiceClient, error) {
+		if endpoint, ok := c.endpointOverrides[serviceNetwork]; ok {
+			sc := c.serviceClientForEndpoint(endpoint, "network")
+			// like openstack.NewNetworkV2 the endpoint is expected without the version
+			sc.ResourceBase = sc.Endpoint + "v2.0/"
+			return sc, nil
+		}
+		return openstack.NewNetworkV2(c.ProviderClient, c.endpointOpts)
+	})
+}
+
+// serviceClient returns the cached service client of the service or creates it
+func (c *Client) serviceClient(service string, create func() (*gophercloud.ServiceClient, error)) (*gophercloud.ServiceClient, error) {
+	c.serviceClientsLock.Lock()
+	defer c.serviceClientsLock.Unlock()
+
+	if sc, ok := c.serviceClients[service]; ok {
+		return sc, nil
+	}
+	sc, err := create()
+	if err != nil {
+		return nil, err
+	}
+	c.serviceClients[service] = sc
+	return sc, nil
+}
+
+func (c *Client) serviceClientForEndpoint(endpoint, serviceType string) *gophercloud.ServiceClient {
+	return &gophercloud.ServiceClient{
+		ProviderClient: c.ProviderClient,
+		Endpoint:       gophercloud.NormalizeURL(endpoint),
+		Type:           serviceType,
+	}
+}
+
+// logDuration logs how long listing a resource took, it's shown with -v=1 or higher
+func logDuration(resource string, start time.Time) {
+	klog.V(1).Infof("Listed %s in %s", resource, time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,270 @@
+package openstack
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/audit"
+)
+
+func TestGetAvailability(t *testing.T) {
+	tests := map[string]gophercloud.Availability{
+		"":            gophercloud.AvailabilityPublic,
+		"public":      gophercloud.AvailabilityPublic,
+		"internalURL": gophercloud.AvailabilityInternal,
+		"admin":       gophercloud.AvailabilityAdmin,
+	}
+	for endpointInterface, want := range tests {
+		got, err := getAvailability(endpointInterface)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", endpointInterface, err)
+		}
+		if got != want {
+			t.Errorf("getAvailability(%q) = %v, want %v", endpointInterface, got, want)
+		}
+	}
+	if _, err := getAvailability("private"); err == nil {
+		t.Errorf("expected error for unsupported interface")
+	}
+}
+
+func TestEndpointOverride(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"volumes": [{"id": "1", "name": "volume"}]}`)
+	}))
+	defer server.Close()
+
+	client, err := newClient(&gophercloud.ProviderClient{HTTPClient: *server.Client()}, "region-b", "internal", map[string]string{
+		serviceBlockStorage: server.URL + "/volume/v3/project",
+		serviceNetwork:      server.URL + "/network",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.endpointOpts.Region != "region-b" || client.endpointOpts.Availability != gophercloud.AvailabilityInternal {
+		t.Errorf("unexpected endpoint options: %+v", client.endpointOpts)
+	}
+
+	volumes, err := GetVolumes(client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(volumes) != 1 || volumes["1"].Name != "volume" {
+		t.Errorf("unexpected volumes: %+v", volumes)
+	}
+	if len(paths) != 1 || paths[0] != "/volume/v3/project/volumes/detail" {
+		t.Errorf("unexpected requests: %v", paths)
+	}
+
+	networkClient, err := client.networkV2()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if url := networkClient.ServiceURL("lbaas", "loadbalancers"); url != server.URL+"/network/v2.0/lbaas/loadbalancers" {
+		t.Errorf("unexpected network url: %s", url)
+	}
+}
+
+func TestServiceClientReuse(t *testing.T) {
+	client, err := newClient(&gophercloud.ProviderClient{}, "", "", map[string]string{serviceCompute: "https://nova/v2.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first, err := client.computeV2()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := client.computeV2()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second {
+		t.Errorf("expected compute client to be reused")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	client, err := newClient(&gophercloud.ProviderClient{HTTPClient: *server.Client()}, "", "", map[string]string{
+		serviceBlockStorage: server.URL + "/volume/v3/project",
+		serviceCompute:      server.URL + "/compute/v2.1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := &bytes.Buffer{}
+	client.DryRun = out
+
+	if err := DetachVolumeNova(client, "v1", "s1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := DetachVolumeCinder(client, "v1", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("expected no requests, got %d", requests)
+	}
+	expected := "DELETE " + server.URL + "/compute/v2.1/servers/s1/os-volume_attachments/v1\n" +
+		"POST " + server.URL + "/volume/v3/project/volumes/v1/action\n" +
+		"{\n  \"os-force_detach\": {\n    \"attachment_id\": \"v1\"\n  }\n}\n"
+	if out.String() != expected {
+		t.Errorf("unexpected requests:\n%s", out.String())
+	}
+}
+
+func TestAudit(t *testing.T) {
+	status := "in-use"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"volume": {"id": "v1", "status": %q}}`, status)
+			return
+		}
+		status = "available"
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client, err := newClient(&gophercloud.ProviderClient{HTTPClient: *server.Client()}, "", "", map[string]string{
+		serviceBlockStorage: server.URL + "/volume/v3/project",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var entries []audit.Entry
+	client.Audit = &audit.Log{
+		File: filepath.Join(dir, "audit.jsonl"),
+		Forward: func(e audit.Entry) error {
+			entries = append(entries, e)
+			return nil
+		},
+	}
+
+	if err := DetachVolumeCinder(client, "v1", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Action != "force-detach-cinder" || e.Method != http.MethodPost || e.ResponseCode != http.StatusAccepted || e.StatusBefore != "in-use" || e.StatusAfterRequest != "available" {
+		t.Errorf("unexpected audit entry: %+v", e)
+	}
+	if string(e.Body) != `{"os-force_detach":{"attachment_id":"v1"}}` {
+		t.Errorf("unexpected request body: %s", e.Body)
+	}
+}
+
+func TestWaitForVolume(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/volume/v3/project/volumes/v1":
+			polls++
+			status := "attaching"
+			if polls > 2 {
+				status = "in-use"
+			}
+			fmt.Fprintf(w, `{"volume": {"id": "v1", "status": %q}}`, status)
+		case "/compute/v2.1/servers/s1/os-volume_attachments":
+			fmt.Fprint(w, `{"volumeAttachments": [{"volumeId": "v1", "serverId": "s1"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newClient(&gophercloud.ProviderClient{HTTPClient: *server.Client()}, "", "", map[string]string{
+		serviceBlockStorage: server.URL + "/volume/v3/project",
+		serviceCompute:      server.URL + "/compute/v2.1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inUse := func(state VolumeState) string {
+		if !state.NovaAttached {
+			return "not attached in Nova"
+		}
+		if state.Volume.Status != "in-use" {
+			return "status in Cinder is " + state.Volume.Status
+		}
+		return ""
+	}
+
+	if err := WaitForVolume(client, "v1", "s1", time.Second, time.Millisecond, inUse); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if polls != 3 {
+		t.Errorf("expected 3 polls, got %d", polls)
+	}
+
+	err = WaitForVolume(client, "v1", "", 5*time.Millisecond, time.Millisecond, func(state VolumeState) string {
+		return "still attached in Cinder"
+	})
+	if err == nil || !strings.Contains(err.Error(), "still attached in Cinder") {
+		t.Errorf("expected timeout with the divergence, got %v", err)
+	}
+}
+
+func TestGetLB(t *testing.T) {
+	responses := map[string]string{
+		"/v2.0/lbaas/loadbalancers":    `{"loadbalancers": [{"id": "lb1", "vip_port_id": "port1"}]}`,
+		"/v2.0/lbaas/listeners":        `{"listeners": [{"id": "l1", "loadbalancers": [{"id": "lb1"}]}]}`,
+		"/v2.0/lbaas/pools":            `{"pools": [{"id": "p1"}, {"id": "p2"}]}`,
+		"/v2.0/lbaas/healthmonitors":   `{"healthmonitors": [{"id": "m1"}]}`,
+		"/v2.0/floatingips":            `{"floatingips": [{"id": "f1", "port_id": "port1"}]}`,
+		"/v2.0/lbaas/pools/p1/members": `{"members": [{"id": "m1", "address": "10.0.0.1"}]}`,
+		"/v2.0/lbaas/pools/p2/members": `{"members": [{"id": "m2", "address": "10.0.0.2"}, {"id": "m3", "address": "10.0.0.3"}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, response)
+	}))
+	defer server.Close()
+
+	client, err := newClient(&gophercloud.ProviderClient{HTTPClient: *server.Client()}, "", "", map[string]string{serviceNetwork: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client.Concurrency = 2
+
+	lbs, ls, ps, members, monitors, fips, err := GetLB(client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lbs) != 1 || len(ls) != 1 || len(ps) != 2 || len(monitors) != 1 || len(fips) != 1 {
+		t.Errorf("unexpected number of objects: %d loadbalancers, %d listeners, %d pools, %d monitors, %d floating ips", len(lbs), len(ls), len(ps), len(monitors), len(fips))
+	}
+	if len(members) != 3 || members["m1"].PoolID != "p1" || members["m3"].PoolID != "p2" {
+		t.Errorf("unexpected members: %+v", members)
+	}
+}
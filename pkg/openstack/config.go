@@ -0,0 +1,123 @@
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/klog"
+)
+
+// configDirs returns the directories in which clouds.yaml and secure.yaml are searched,
+// in the same order as openstacksdk does.
+// See https://docs.openstack.org/openstacksdk/latest/user/config/configuration.html#config-files
+func configDirs() []string {
+	dirs := []string{"."}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "openstack"))
+	}
+	return append(dirs, "/etc/openstack")
+}
+
+// findConfigFile returns the file set via the first set env var or the first
+// file with fileName found in the config dirs. It returns "" if no file is found.
+func findConfigFile(envVars []string, fileName string) string {
+	for _, envVar := range envVars {
+		if file := os.Getenv(envVar); file != "" {
+			return file
+		}
+	}
+	for _, dir := range configDirs() {
+		file := filepath.Join(dir, fileName)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
+
+// findCloudsFile returns the location of the clouds.yaml, OPENSTACK_CONFIG_FILE takes precedence
+// over the openstacksdk env var OS_CLIENT_CONFIG_FILE
+func findCloudsFile() string {
+	return findConfigFile([]string{"OPENSTACK_CONFIG_FILE", "OS_CLIENT_CONFIG_FILE"}, "clouds.yaml")
+}
+
+// cloudsFileFor returns the clouds.yaml which configures the cloud or "" if the env variables are
+// used. A clouds.yaml which has only been discovered in the config dirs, e.g. one of the openstack
+// CLI, is skipped if it doesn't contain the cloud and OS_AUTH_URL is set.
+func cloudsFileFor(cloudName string) string {
+	file := findCloudsFile()
+	if file == "" || os.Getenv("OPENSTACK_CONFIG_FILE") != "" || os.Getenv("OS_CLIENT_CONFIG_FILE") != "" || os.Getenv("OS_AUTH_URL") == "" {
+		return file
+	}
+	config, err := readConfig(file)
+	if err != nil {
+		// the error is reported when the file is used
+		return file
+	}
+	if _, ok := config.Clouds[cloudName]; ok {
+		return file
+	}
+	klog.V(1).Infof("Cloud %s not found in %s, using the env variables", cloudName, file)
+	return ""
+}
+
+// findSecureFile returns the location of the secure.yaml
+func findSecureFile() string {
+	return findConfigFile([]string{"OS_CLIENT_SECURE_FILE"}, "secure.yaml")
+}
+
+// readConfig reads the clouds.yaml and merges the secure.yaml into it if one is found
+func readConfig(configFile string) (*clouds, error) {
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %v", configFile, err)
+	}
+
+	secureFile := findSecureFile()
+	if secureFile != "" {
+		secureContent, err := ioutil.ReadFile(secureFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading secure file %s: %v", secureFile, err)
+		}
+		content, err = mergeConfig(content, secureContent)
+		if err != nil {
+			return nil, fmt.Errorf("error merging secure file %s into config file %s: %v", secureFile, configFile, err)
+		}
+	}
+
+	var config clouds
+	err = yaml.Unmarshal(content, &config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", configFile, err)
+	}
+	return &config, nil
+}
+
+// mergeConfig merges the secure config into the config, values of the secure config take precedence
+func mergeConfig(config, secureConfig []byte) ([]byte, error) {
+	configMap := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(config, &configMap); err != nil {
+		return nil, err
+	}
+	secureConfigMap := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(secureConfig, &secureConfigMap); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(mergeMaps(configMap, secureConfigMap))
+}
+
+func mergeMaps(dst, src map[interface{}]interface{}) map[interface{}]interface{} {
+	for key, srcValue := range src {
+		srcMap, srcIsMap := srcValue.(map[interface{}]interface{})
+		dstMap, dstIsMap := dst[key].(map[interface{}]interface{})
+		if srcIsMap && dstIsMap {
+			dst[key] = mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[key] = srcValue
+	}
+	return dst
+}
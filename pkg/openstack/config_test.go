@@ -0,0 +1,125 @@
+package openstack
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetCloudFromConfigWithSecureFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "clouds.yaml")
+	config := `
+clouds:
+  i01p015:
+    auth:
+      auth_url: https://keystone
+      project_name: i01p015
+      username: demo
+    cacert: /etc/ssl/ca.pem
+`
+	secureFile := filepath.Join(dir, "secure.yaml")
+	secure := `
+clouds:
+  i01p015:
+    auth:
+      password: secret
+`
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(secureFile, []byte(secure), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("OS_CLIENT_SECURE_FILE", secureFile)
+	defer os.Unsetenv("OS_CLIENT_SECURE_FILE")
+
+	cloud, err := getCloudFromConfig(configFile, "i01p015")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cloud.Auth.Username != "demo" || cloud.Auth.Password != "secret" || cloud.Auth.AuthUrl != "https://keystone" || cloud.CaCert != "/etc/ssl/ca.pem" {
+		t.Errorf("unexpected cloud: %+v", cloud)
+	}
+
+	if _, err := getCloudFromConfig(configFile, "i01p016"); err == nil {
+		t.Errorf("expected error for unknown cloud")
+	}
+}
+
+func TestFindCloudsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("clouds.yaml", []byte("clouds: {}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("OPENSTACK_CONFIG_FILE", os.Getenv("OPENSTACK_CONFIG_FILE"))
+	os.Unsetenv("OPENSTACK_CONFIG_FILE")
+
+	if file := findCloudsFile(); file != "clouds.yaml" {
+		t.Errorf("expected clouds.yaml in current dir, got %q", file)
+	}
+
+	os.Setenv("OS_CLIENT_CONFIG_FILE", "/tmp/other.yaml")
+	defer os.Unsetenv("OS_CLIENT_CONFIG_FILE")
+	if file := findCloudsFile(); file != "/tmp/other.yaml" {
+		t.Errorf("expected file from OS_CLIENT_CONFIG_FILE, got %q", file)
+	}
+}
+
+func TestCloudsFileFor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("clouds.yaml", []byte("clouds:\n  i01p015:\n    auth:\n      auth_url: http://keystone\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, envVar := range []string{"OPENSTACK_CONFIG_FILE", "OS_CLIENT_CONFIG_FILE", "OS_CLIENT_SECURE_FILE", "OS_AUTH_URL"} {
+		defer os.Setenv(envVar, os.Getenv(envVar))
+		os.Unsetenv(envVar)
+	}
+
+	if file := cloudsFileFor("other"); file != "clouds.yaml" {
+		t.Errorf("expected clouds.yaml without OS_AUTH_URL, got %q", file)
+	}
+	os.Setenv("OS_AUTH_URL", "http://keystone")
+	if file := cloudsFileFor("i01p015"); file != "clouds.yaml" {
+		t.Errorf("expected clouds.yaml for cloud in the file, got %q", file)
+	}
+	if file := cloudsFileFor("other"); file != "" {
+		t.Errorf("expected env variables for cloud not in the discovered file, got %q", file)
+	}
+	os.Setenv("OS_CLIENT_CONFIG_FILE", "clouds.yaml")
+	if file := cloudsFileFor("other"); file != "clouds.yaml" {
+		t.Errorf("expected explicitly set clouds.yaml, got %q", file)
+	}
+}
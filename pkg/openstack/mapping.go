@@ -0,0 +1,85 @@
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/config"
+)
+
+// cloudExtension is the name of the kubeconfig context extension which sets the cloud of a context
+const cloudExtension = "openstack-cloud"
+
+// GetCloudName returns the OpenStack cloud of the kube context. The cloud is determined by (in order):
+// the openstack-cloud extension of the kube context, the explicit mapping and the regexps of the
+// plugin config, OS_CLOUD and finally the part of the context name before the first "-". OS_CLOUD
+// is only a fallback, so contexts of different clouds can be listed together.
+func GetCloudName(context string, kubeContext *api.Context) (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	return getCloudName(context, kubeContext, cfg.CloudMapping, os.Getenv("OS_CLOUD"))
+}
+
+func getCloudName(context string, kubeContext *api.Context, mapping config.CloudMapping, osCloud string) (string, error) {
+	if kubeContext != nil {
+		if ext, ok := kubeContext.Extensions[cloudExtension]; ok {
+			cloud, err := getCloudFromExtension(ext)
+			if err != nil {
+				return "", fmt.Errorf("error parsing extension %s of context %s: %v", cloudExtension, context, err)
+			}
+			if cloud != "" {
+				return cloud, nil
+			}
+		}
+	}
+
+	if cloud, ok := mapping.Contexts[context]; ok {
+		return cloud, nil
+	}
+
+	for _, expr := range mapping.Regexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return "", fmt.Errorf("error compiling cloud mapping regexp %s: %v", expr, err)
+		}
+		if re.NumSubexp() < 1 {
+			return "", fmt.Errorf("cloud mapping regexp %s has no capture group", expr)
+		}
+		if matches := re.FindStringSubmatch(context); matches != nil && matches[1] != "" {
+			return matches[1], nil
+		}
+	}
+
+	if osCloud != "" {
+		return osCloud, nil
+	}
+	return strings.Split(context, "-")[0], nil
+}
+
+// getCloudFromExtension supports the cloud as plain string or as object with a name field
+func getCloudFromExtension(ext runtime.Object) (string, error) {
+	unknown, ok := ext.(*runtime.Unknown)
+	if !ok {
+		return "", fmt.Errorf("unexpected type %T", ext)
+	}
+
+	var name string
+	if err := json.Unmarshal(unknown.Raw, &name); err == nil {
+		return name, nil
+	}
+	var obj struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(unknown.Raw, &obj); err != nil {
+		return "", err
+	}
+	return obj.Name, nil
+}
@@ -0,0 +1,57 @@
+package openstack
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/config"
+)
+
+func TestGetCloudName(t *testing.T) {
+	mapping := config.CloudMapping{
+		Contexts: map[string]string{
+			"prod-eu-admin@cluster": "explicit",
+		},
+		Regexps: []string{
+			"^(.*)-admin@.*$",
+		},
+	}
+	withExtension := func(raw string) *api.Context {
+		return &api.Context{Extensions: map[string]runtime.Object{
+			cloudExtension: &runtime.Unknown{Raw: []byte(raw)},
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		context     string
+		kubeContext *api.Context
+		mapping     config.CloudMapping
+		osCloud     string
+		want        string
+		wantErr     bool
+	}{
+		{name: "extension string", context: "prod-eu-admin@cluster", kubeContext: withExtension(`"ext"`), mapping: mapping, want: "ext"},
+		{name: "extension object", context: "prod-eu-admin@cluster", kubeContext: withExtension(`{"name":"ext"}`), mapping: mapping, want: "ext"},
+		{name: "invalid extension", context: "prod-eu-admin@cluster", kubeContext: withExtension(`[]`), mapping: mapping, wantErr: true},
+		{name: "explicit mapping", context: "prod-eu-admin@cluster", kubeContext: &api.Context{}, mapping: mapping, want: "explicit"},
+		{name: "regexp", context: "prod-us-admin@cluster", mapping: mapping, want: "prod-us"},
+		{name: "regexp without capture group", context: "prod-us-admin@cluster", mapping: config.CloudMapping{Regexps: []string{"^prod"}}, wantErr: true},
+		{name: "fallback", context: "i01p015-cluster-admin", mapping: mapping, want: "i01p015"},
+		{name: "OS_CLOUD fallback", context: "i01p015-cluster-admin", mapping: mapping, osCloud: "env", want: "env"},
+		{name: "OS_CLOUD doesn't override mapping", context: "prod-us-admin@cluster", mapping: mapping, osCloud: "env", want: "prod-us"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getCloudName(tt.context, tt.kubeContext, tt.mapping, tt.osCloud)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getCloudName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getCloudName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
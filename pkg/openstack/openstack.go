@@ -1,10 +1,17 @@
 package openstack
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
-	"strings"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
@@ -15,14 +22,19 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/loadbalancers"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/monitors"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/lbaas_v2/pools"
-	"gopkg.in/yaml.v2"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/audit"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/cache"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/parallel"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog"
 )
 
-func GetVolumes(osProvider *gophercloud.ProviderClient) (map[string]volumes.Volume, error) {
-	blockStorageClient, err := openstack.NewBlockStorageV3(osProvider, gophercloud.EndpointOpts{})
+func GetVolumes(osProvider *Client) (map[string]volumes.Volume, error) {
+	blockStorageClient, err := osProvider.blockStorageV3()
 	if err != nil {
 		return nil, fmt.Errorf("error creating volume client: %v", err)
 	}
+	defer logDuration("volumes", time.Now())
 	pager, err := volumes.List(blockStorageClient, volumes.ListOpts{}).AllPages()
 	if err != nil {
 		return nil, fmt.Errorf("error pageing volumes: %v", err)
@@ -38,11 +50,25 @@ func GetVolumes(osProvider *gophercloud.ProviderClient) (map[string]volumes.Volu
 	return volumeMap, nil
 }
 
-func GetServer(osProvider *gophercloud.ProviderClient) (map[string]servers.Server, error) {
-	computeClient, err := openstack.NewComputeV2(osProvider, gophercloud.EndpointOpts{})
+// GetVolume gets a single volume from Cinder
+func GetVolume(osProvider *Client, volumeID string) (*volumes.Volume, error) {
+	blockStorageClient, err := osProvider.blockStorageV3()
+	if err != nil {
+		return nil, fmt.Errorf("error creating volume client: %v", err)
+	}
+	v, err := volumes.Get(blockStorageClient, volumeID).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("error getting volume %s: %v", volumeID, err)
+	}
+	return v, nil
+}
+
+func GetServer(osProvider *Client) (map[string]servers.Server, error) {
+	computeClient, err := osProvider.computeV2()
 	if err != nil {
 		return nil, fmt.Errorf("error creating compute client: %v", err)
 	}
+	defer logDuration("server", time.Now())
 	pager, err := servers.List(computeClient, servers.ListOpts{}).AllPages()
 	if err != nil {
 		return nil, fmt.Errorf("error pageing server: %v", err)
@@ -58,138 +84,361 @@ func GetServer(osProvider *gophercloud.ProviderClient) (map[string]servers.Serve
 	return serverMap, nil
 }
 
-func GetLB(osProvider *gophercloud.ProviderClient) (map[string]loadbalancers.LoadBalancer, map[string]listeners.Listener, map[string]pools.Pool, map[string]pools.Member, map[string]monitors.Monitor, map[string]floatingips.FloatingIP, error) {
-	networkClient, err := openstack.NewNetworkV2(osProvider, gophercloud.EndpointOpts{})
+// GetLB lists the loadbalancers, listeners, pools, monitors and floating ips concurrently and
+// afterwards the members of all pools
+func GetLB(osProvider *Client) (map[string]loadbalancers.LoadBalancer, map[string]listeners.Listener, map[string]pools.Pool, map[string]pools.Member, map[string]monitors.Monitor, map[string]floatingips.FloatingIP, error) {
+	networkClient, err := osProvider.networkV2()
 	if err != nil {
 		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error creating network client: %v", err)
 	}
 
-	pager, err := loadbalancers.List(networkClient, loadbalancers.ListOpts{}).AllPages()
-	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error pageing loadbalancers: %v", err)
-	}
-	lbs, err := loadbalancers.ExtractLoadBalancers(pager)
-	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error extracting loadbalancers: %v", err)
-	}
 	loadBalancersMap := map[string]loadbalancers.LoadBalancer{}
-	for _, lb := range lbs {
-		loadBalancersMap[lb.ID] = lb
-	}
+	listenersMap := map[string]listeners.Listener{}
+	poolsMap := map[string]pools.Pool{}
+	monitorsMap := map[string]monitors.Monitor{}
+	floatingipsMap := map[string]floatingips.FloatingIP{}
 
-	pager, err = listeners.List(networkClient, listeners.ListOpts{}).AllPages()
-	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error pageing listeners: %v", err)
-	}
-	ls, err := listeners.ExtractListeners(pager)
+	var poolss []pools.Pool
+	err = parallel.Run(osProvider.Concurrency,
+		func() error {
+			defer logDuration("loadbalancers", time.Now())
+			pager, err := loadbalancers.List(networkClient, loadbalancers.ListOpts{}).AllPages()
+			if err != nil {
+				return fmt.Errorf("error pageing loadbalancers: %v", err)
+			}
+			lbs, err := loadbalancers.ExtractLoadBalancers(pager)
+			if err != nil {
+				return fmt.Errorf("error extracting loadbalancers: %v", err)
+			}
+			for _, lb := range lbs {
+				loadBalancersMap[lb.ID] = lb
+			}
+			return nil
+		},
+		func() error {
+			defer logDuration("listeners", time.Now())
+			pager, err := listeners.List(networkClient, listeners.ListOpts{}).AllPages()
+			if err != nil {
+				return fmt.Errorf("error pageing listeners: %v", err)
+			}
+			ls, err := listeners.ExtractListeners(pager)
+			if err != nil {
+				return fmt.Errorf("error extracting listeners: %v", err)
+			}
+			for _, l := range ls {
+				listenersMap[l.ID] = l
+			}
+			return nil
+		},
+		func() error {
+			defer logDuration("pools", time.Now())
+			pager, err := pools.List(networkClient, pools.ListOpts{}).AllPages()
+			if err != nil {
+				return fmt.Errorf("error pageing pools: %v", err)
+			}
+			poolss, err = pools.ExtractPools(pager)
+			if err != nil {
+				return fmt.Errorf("error extracting pools: %v", err)
+			}
+			for _, p := range poolss {
+				poolsMap[p.ID] = p
+			}
+			return nil
+		},
+		func() error {
+			defer logDuration("monitors", time.Now())
+			pager, err := monitors.List(networkClient, monitors.ListOpts{}).AllPages()
+			if err != nil {
+				return fmt.Errorf("error pageing monitors: %v", err)
+			}
+			monitorss, err := monitors.ExtractMonitors(pager)
+			if err != nil {
+				return fmt.Errorf("error extracting monitors: %v", err)
+			}
+			for _, m := range monitorss {
+				monitorsMap[m.ID] = m
+			}
+			return nil
+		},
+		func() error {
+			defer logDuration("floatingips", time.Now())
+			pager, err := floatingips.List(networkClient, floatingips.ListOpts{}).AllPages()
+			if err != nil {
+				return fmt.Errorf("error pageing floatingips: %v", err)
+			}
+			fips, err := floatingips.ExtractFloatingIPs(pager)
+			if err != nil {
+				return fmt.Errorf("error extracting floatingips: %v", err)
+			}
+			for _, f := range fips {
+				floatingipsMap[f.ID] = f
+			}
+			return nil
+		},
+	)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error extracting listeners: %v", err)
-	}
-	listenersMap := map[string]listeners.Listener{}
-	for _, l := range ls {
-		listenersMap[l.ID] = l
+		return nil, nil, nil, nil, nil, nil, err
 	}
 
-	pager, err = pools.List(networkClient, pools.ListOpts{}).AllPages()
+	membersMap := map[string]pools.Member{}
+	var membersLock sync.Mutex
+	var fns []func() error
+	for _, pool := range poolss {
+		pool := pool
+		fns = append(fns, func() error {
+			pager, err := pools.ListMembers(networkClient, pool.ID, pools.ListMembersOpts{}).AllPages()
+			if err != nil {
+				return fmt.Errorf("error pageing lbmembers: %v", err)
+			}
+			members, err := pools.ExtractMembers(pager)
+			if err != nil {
+				return fmt.Errorf("error extracting lbmembers: %v", err)
+			}
+			membersLock.Lock()
+			defer membersLock.Unlock()
+			for _, m := range members {
+				m.PoolID = pool.ID
+				membersMap[m.ID] = m
+			}
+			return nil
+		})
+	}
+	start := time.Now()
+	if err := parallel.Run(osProvider.Concurrency, fns...); err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+	logDuration(fmt.Sprintf("lbmembers of %d pools", len(poolss)), start)
+
+	return loadBalancersMap, listenersMap, poolsMap, membersMap, monitorsMap, floatingipsMap, nil
+}
+
+// GetOpenStackClient returns the client for the cloud of the context and the name of the cloud, see
+// GetCloudName. The Keystone token and the responses of GET requests are cached in c, c can be nil
+// to disable caching.
+func GetOpenStackClient(context string, kubeContext *api.Context, c *cache.Cache) (*Client, string, error) {
+	tenantID, err := GetCloudName(context, kubeContext)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error pageing pools: %v", err)
+		return nil, tenantID, fmt.Errorf("error getting cloud for context %s: %v", context, err)
 	}
-	poolss, err := pools.ExtractPools(pager)
+
+	client, err := createOpenStackClient(tenantID, c)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error extracting pools: %v", err)
-	}
-	poolsMap := map[string]pools.Pool{}
-	for _, p := range poolss {
-		poolsMap[p.ID] = p
+		return nil, tenantID, fmt.Errorf("error creating openstack client: %w", err)
 	}
 
-	membersMap := map[string]pools.Member{}
-	for _, pool := range poolss {
-		pager, err = pools.ListMembers(networkClient, pool.ID, pools.ListMembersOpts{}).AllPages()
+	return client, tenantID, nil
+}
+
+func createOpenStackClient(tenantID string, c *cache.Cache) (*Client, error) {
+
+	openstackConfigFile := cloudsFileFor(tenantID)
+	if openstackConfigFile != "" {
+		cloud, err := getCloudFromConfig(openstackConfigFile, tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting cloud from config file %s: %v", openstackConfigFile, err)
+		}
+		authOptions, err := getAuthOptionsFromCloud(cloud, openstackConfigFile, tenantID)
 		if err != nil {
-			return nil, nil, nil, nil, nil, nil, fmt.Errorf("error pageing lbmembers: %v", err)
+			return nil, fmt.Errorf("error getting auth options from config file %s: %v", openstackConfigFile, err)
 		}
-		members, err := pools.ExtractMembers(pager)
+		verify := verifyCloud(cloud, tenantID)
+		tlsConfig, err := getTLSConfig(verify, cloud.CaCert, cloud.Cert, cloud.Key)
 		if err != nil {
-			return nil, nil, nil, nil, nil, nil, fmt.Errorf("error extracting lbmembers: %v", err)
+			return nil, fmt.Errorf("error getting tls config from config file %s: %v", openstackConfigFile, err)
 		}
-		for _, m := range members {
-			m.PoolID = pool.ID
-			membersMap[m.ID] = m
+		osProvider, err := newAuthenticatedClient(*authOptions, tlsConfig, c, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newClient(osProvider, cloud.RegionName, cloud.Interface, map[string]string{
+			serviceBlockStorage: cloud.BlockStorageEndpointOverride,
+			serviceCompute:      cloud.ComputeEndpointOverride,
+			serviceNetwork:      cloud.NetworkEndpointOverride,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting endpoint options from config file %s: %v", openstackConfigFile, err)
 		}
+		return client, nil
 	}
 
-	pager, err = monitors.List(networkClient, monitors.ListOpts{}).AllPages()
+	authOptions, err := getAuthOptionsFromEnv()
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error pageing monitors: %v", err)
+		return nil, fmt.Errorf("error getting auth options from env variables: %v", err)
 	}
-	monitorss, err := monitors.ExtractMonitors(pager)
+	insecure, _ := strconv.ParseBool(os.Getenv("OS_INSECURE"))
+	tlsConfig, err := getTLSConfig(!insecure, os.Getenv("OS_CACERT"), os.Getenv("OS_CERT"), os.Getenv("OS_KEY"))
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error extracting monitors: %v", err)
+		return nil, fmt.Errorf("error getting tls config from env variables: %v", err)
 	}
-	monitorsMap := map[string]monitors.Monitor{}
-	for _, m := range monitorss {
-		monitorsMap[m.ID] = m
-	}
-
-	pager, err = floatingips.List(networkClient, floatingips.ListOpts{}).AllPages()
+	osProvider, err := newAuthenticatedClient(*authOptions, tlsConfig, c, tenantID)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error pageing floatingips: %v", err)
+		return nil, err
 	}
-	floatingipss, err := floatingips.ExtractFloatingIPs(pager)
+	client, err := newClient(osProvider, os.Getenv("OS_REGION_NAME"), os.Getenv("OS_INTERFACE"), map[string]string{
+		serviceBlockStorage: os.Getenv("OS_BLOCK_STORAGE_ENDPOINT_OVERRIDE"),
+		serviceCompute:      os.Getenv("OS_COMPUTE_ENDPOINT_OVERRIDE"),
+		serviceNetwork:      os.Getenv("OS_NETWORK_ENDPOINT_OVERRIDE"),
+	})
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, fmt.Errorf("error extracting floatingips: %v", err)
-	}
-	floatingipsMap := map[string]floatingips.FloatingIP{}
-	for _, f := range floatingipss {
-		floatingipsMap[f.ID] = f
+		return nil, fmt.Errorf("error getting endpoint options from env variables: %v", err)
 	}
+	return client, nil
+}
 
-	return loadBalancersMap, listenersMap, poolsMap, membersMap, monitorsMap, floatingipsMap, nil
+// insecureEnvVar has to be set to true to skip the verification of the server certificates of a
+// cloud with verify: false. Previous versions of import-config wrote verify: false for every cloud
+// without cacert while the value was ignored, so it isn't honoured without the opt-in.
+const insecureEnvVar = "KUBECTL_OS_INSECURE"
+
+// verifyCloud returns false if the server certificates of the cloud must not be verified
+func verifyCloud(cloud *cloud, cloudName string) bool {
+	if cloud.Verify == nil || *cloud.Verify {
+		return true
+	}
+	if insecure, _ := strconv.ParseBool(os.Getenv(insecureEnvVar)); insecure {
+		return false
+	}
+	klog.Warningf("Ignoring verify: false of cloud %s, set %s=true to skip the verification of the server certificates or remove it from the clouds.yaml", cloudName, insecureEnvVar)
+	return true
 }
 
-func GetOpenStackClient(context string) (*gophercloud.ProviderClient, string, error) {
-	providerClient, tenantID, err := createOpenStackProviderClient(context)
+// newAuthenticatedClient is like openstack.AuthenticatedClient, but uses a custom tls config if set
+// and caches the token and the responses of the cloud in c
+func newAuthenticatedClient(authOptions gophercloud.AuthOptions, tlsConfig *tls.Config, c *cache.Cache, cloudName string) (*gophercloud.ProviderClient, error) {
+	osProvider, err := openstack.NewClient(authOptions.IdentityEndpoint)
 	if err != nil {
-		return nil, tenantID, fmt.Errorf("error creating openstack client: %v", err)
+		return nil, err
 	}
-
-	return providerClient, tenantID, nil
+	transport := http.DefaultTransport
+	if tlsConfig != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = tlsConfig
+		transport = t
+	}
+	osProvider.HTTPClient.Transport = c.Transport(transport, "clouds", cloudName, "responses")
+	err = authenticate(osProvider, authOptions, c, cloudName)
+	if err != nil {
+		return nil, err
+	}
+	return osProvider, nil
 }
 
-func createOpenStackProviderClient(context string) (*gophercloud.ProviderClient, string, error) {
-
-	tenantID := strings.Split(context, "-")[0]
+// getTLSConfig returns the tls config for the given CA and client certificate files,
+// it returns nil if the default tls config can be used
+func getTLSConfig(verify bool, caCertFile, certFile, keyFile string) (*tls.Config, error) {
+	if verify && caCertFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
 
-	openstackConfigFile := os.Getenv("OPENSTACK_CONFIG_FILE")
-	if openstackConfigFile != "" {
-		authOptions, err := getAuthOptionsFromConfig(openstackConfigFile, tenantID)
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !verify,
+	}
+	if caCertFile != "" {
+		caCert, err := ioutil.ReadFile(caCertFile)
 		if err != nil {
-			return nil, tenantID, fmt.Errorf("error getting auth options from config file %s: %v", openstackConfigFile, err)
+			return nil, fmt.Errorf("error reading cacert %s: %v", caCertFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("error parsing cacert %s: no certificates found", caCertFile)
 		}
-		osProvider, err := openstack.AuthenticatedClient(*authOptions)
-		return osProvider, tenantID, err
+		tlsConfig.RootCAs = pool
 	}
-
-	authOptions, err := getAuthOptionsFromEnv()
-	if err != nil {
-		return nil, tenantID, fmt.Errorf("error getting auth options from env variables: %v", err)
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("cert and key must be set both")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate %s and key %s: %v", certFile, keyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
-	osProvider, err := openstack.AuthenticatedClient(*authOptions)
-	return osProvider, tenantID, err
+	return tlsConfig, nil
+}
+
+// Supported auth types, see https://docs.openstack.org/keystoneauth/latest/plugin-options.html
+const (
+	authTypePassword              = "password"
+	authTypeApplicationCredential = "v3applicationcredential"
+	authTypeToken                 = "token"
+)
+
+// normalizeAuthType maps the auth type aliases to the supported auth types. If no auth type is set it is
+// derived from the configured credentials.
+func normalizeAuthType(authType, applicationCredentialID, applicationCredentialName, token string) (string, error) {
+	switch authType {
+	case "":
+		if applicationCredentialID != "" || applicationCredentialName != "" {
+			return authTypeApplicationCredential, nil
+		}
+		if token != "" {
+			return authTypeToken, nil
+		}
+		return authTypePassword, nil
+	case "password", "v3password", "v2password":
+		return authTypePassword, nil
+	case "v3applicationcredential", "applicationcredential":
+		return authTypeApplicationCredential, nil
+	case "token", "v3token", "v2token":
+		return authTypeToken, nil
+	}
+	return "", fmt.Errorf("unsupported auth type %q", authType)
 }
 
 func getAuthOptionsFromEnv() (*gophercloud.AuthOptions, error) {
 	authOptions := &gophercloud.AuthOptions{}
 
-	authOptions.Username = os.Getenv("OS_USERNAME")
-	if authOptions.Username == "" {
-		return nil, fmt.Errorf("could not get username from env var OS_USERNAME")
+	authOptions.IdentityEndpoint = os.Getenv("OS_AUTH_URL")
+	if authOptions.IdentityEndpoint == "" {
+		return nil, fmt.Errorf("could not get authUrl from env var OS_AUTH_URL")
 	}
-	authOptions.Password = os.Getenv("OS_PASSWORD")
-	if authOptions.Password == "" {
-		return nil, fmt.Errorf("could not get password from env var OS_PASSWORD")
+
+	authType, err := normalizeAuthType(os.Getenv("OS_AUTH_TYPE"), os.Getenv("OS_APPLICATION_CREDENTIAL_ID"), os.Getenv("OS_APPLICATION_CREDENTIAL_NAME"), os.Getenv("OS_TOKEN"))
+	if err != nil {
+		return nil, fmt.Errorf("error getting auth type from env var OS_AUTH_TYPE: %v", err)
 	}
+
+	// application credentials are already scoped to a project
+	if authType == authTypeApplicationCredential {
+		authOptions.ApplicationCredentialID = os.Getenv("OS_APPLICATION_CREDENTIAL_ID")
+		authOptions.ApplicationCredentialName = os.Getenv("OS_APPLICATION_CREDENTIAL_NAME")
+		if authOptions.ApplicationCredentialID == "" && authOptions.ApplicationCredentialName == "" {
+			return nil, fmt.Errorf("could not get application credential from env vars OS_APPLICATION_CREDENTIAL_ID or OS_APPLICATION_CREDENTIAL_NAME")
+		}
+		authOptions.ApplicationCredentialSecret = os.Getenv("OS_APPLICATION_CREDENTIAL_SECRET")
+		if authOptions.ApplicationCredentialSecret == "" {
+			return nil, fmt.Errorf("could not get application credential secret from env var OS_APPLICATION_CREDENTIAL_SECRET")
+		}
+		// the name of an application credential is only unique per user
+		if authOptions.ApplicationCredentialID == "" {
+			authOptions.UserID = os.Getenv("OS_USER_ID")
+			authOptions.Username = os.Getenv("OS_USERNAME")
+			authOptions.DomainName = os.Getenv("OS_USER_DOMAIN_NAME")
+			if authOptions.UserID == "" && (authOptions.Username == "" || authOptions.DomainName == "") {
+				return nil, fmt.Errorf("could not get user from env vars OS_USER_ID or OS_USERNAME and OS_USER_DOMAIN_NAME")
+			}
+		}
+		return authOptions, nil
+	}
+
+	switch authType {
+	case authTypeToken:
+		authOptions.TokenID = os.Getenv("OS_TOKEN")
+		if authOptions.TokenID == "" {
+			return nil, fmt.Errorf("could not get token from env var OS_TOKEN")
+		}
+	case authTypePassword:
+		authOptions.Username = os.Getenv("OS_USERNAME")
+		if authOptions.Username == "" {
+			return nil, fmt.Errorf("could not get username from env var OS_USERNAME")
+		}
+		authOptions.Password = os.Getenv("OS_PASSWORD")
+		if authOptions.Password == "" {
+			return nil, fmt.Errorf("could not get password from env var OS_PASSWORD")
+		}
+	}
+
 	authOptions.TenantName = os.Getenv("OS_PROJECT_NAME")
 	if authOptions.TenantName == "" {
 		authOptions.TenantName = os.Getenv("OS_TENANT_NAME")
@@ -199,13 +448,9 @@ func getAuthOptionsFromEnv() (*gophercloud.AuthOptions, error) {
 		authOptions.TenantID = os.Getenv("OS_TENANT_ID")
 	}
 
-	if authOptions.TenantName == "" || authOptions.TenantID == "" {
+	if authOptions.TenantName == "" && authOptions.TenantID == "" {
 		return nil, fmt.Errorf("could not get projectName or projectID from env vars OS_PROJECT_NAME, OS_TENANT_NAME, OS_PROJECT_ID or OS_TENANT_ID")
 	}
-	authOptions.IdentityEndpoint = os.Getenv("OS_AUTH_URL")
-	if authOptions.IdentityEndpoint == "" {
-		return nil, fmt.Errorf("could not get authUrl from env var OS_AUTH_URL")
-	}
 	return authOptions, nil
 }
 
@@ -213,9 +458,20 @@ type clouds struct {
 	Clouds map[string]cloud `yaml:"clouds"`
 }
 type cloud struct {
-	Auth   cloudAuth `yaml:"auth"`
-	Verify bool      `yaml:"verify"`
-	CaCert string    `yaml:"cacert,omitempty"`
+	AuthType string    `yaml:"auth_type,omitempty"`
+	Auth     cloudAuth `yaml:"auth"`
+	// Verify defaults to true if not set
+	Verify *bool  `yaml:"verify,omitempty"`
+	CaCert string `yaml:"cacert,omitempty"`
+	Cert   string `yaml:"cert,omitempty"`
+	Key    string `yaml:"key,omitempty"`
+
+	RegionName string `yaml:"region_name,omitempty"`
+	Interface  string `yaml:"interface,omitempty"`
+
+	BlockStorageEndpointOverride string `yaml:"block_storage_endpoint_override,omitempty"`
+	ComputeEndpointOverride      string `yaml:"compute_endpoint_override,omitempty"`
+	NetworkEndpointOverride      string `yaml:"network_endpoint_override,omitempty"`
 }
 
 type cloudAuth struct {
@@ -225,6 +481,15 @@ type cloudAuth struct {
 	AuthUrl     string `yaml:"auth_url"`
 	ProjectName string `yaml:"project_name"`
 	ProjectID   string `yaml:"project_id"`
+
+	UserID         string `yaml:"user_id,omitempty"`
+	UserDomainName string `yaml:"user_domain_name,omitempty"`
+
+	ApplicationCredentialID     string `yaml:"application_credential_id,omitempty"`
+	ApplicationCredentialName   string `yaml:"application_credential_name,omitempty"`
+	ApplicationCredentialSecret string `yaml:"application_credential_secret,omitempty"`
+
+	Token string `yaml:"token,omitempty"`
 }
 
 //clouds:
@@ -235,26 +500,55 @@ type cloudAuth struct {
 //			username: demo
 //			password: 0penstack
 // See https://docs.openstack.org/python-openstackclient/pike/configuration/index.html
-func getAuthOptionsFromConfig(configFile, context string) (*gophercloud.AuthOptions, error) {
-	content, err := ioutil.ReadFile(configFile)
+func getCloudFromConfig(configFile, context string) (*cloud, error) {
+	config, err := readConfig(configFile)
 	if err != nil {
-		return nil, fmt.Errorf("error reading config file %s: %v", configFile, err)
-	}
-
-	var config clouds
-	err = yaml.Unmarshal(content, &config)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing config file %s: %v", configFile, err)
+		return nil, err
 	}
 
 	cloud, ok := config.Clouds[context]
 	if !ok {
 		return nil, fmt.Errorf("could not find cloud %s in config file %s", context, configFile)
 	}
+	return &cloud, nil
+}
 
+func getAuthOptionsFromCloud(cloud *cloud, configFile, context string) (*gophercloud.AuthOptions, error) {
 	if cloud.Auth.AuthUrl == "" {
 		return nil, fmt.Errorf("could not find auth_url in cloud %s in config file %s", context, configFile)
 	}
+	options := gophercloud.AuthOptions{IdentityEndpoint: cloud.Auth.AuthUrl}
+
+	authType, err := normalizeAuthType(cloud.AuthType, cloud.Auth.ApplicationCredentialID, cloud.Auth.ApplicationCredentialName, cloud.Auth.Token)
+	if err != nil {
+		return nil, fmt.Errorf("error getting auth_type in cloud %s in config file %s: %v", context, configFile, err)
+	}
+
+	// application credentials are already scoped to a project
+	if authType == authTypeApplicationCredential {
+		if cloud.Auth.ApplicationCredentialID == "" && cloud.Auth.ApplicationCredentialName == "" {
+			return nil, fmt.Errorf("could not find application_credential_id or application_credential_name in cloud %s in config file %s", context, configFile)
+		}
+		if cloud.Auth.ApplicationCredentialSecret == "" {
+			return nil, fmt.Errorf("could not find application_credential_secret in cloud %s in config file %s", context, configFile)
+		}
+		options.ApplicationCredentialID = cloud.Auth.ApplicationCredentialID
+		options.ApplicationCredentialName = cloud.Auth.ApplicationCredentialName
+		options.ApplicationCredentialSecret = cloud.Auth.ApplicationCredentialSecret
+		// the name of an application credential is only unique per user
+		if options.ApplicationCredentialID == "" {
+			options.UserID = cloud.Auth.UserID
+			options.Username = cloud.Auth.Username
+			options.DomainName = cloud.Auth.UserDomainName
+			if options.DomainName == "" {
+				options.DomainName = cloud.Auth.DomainName
+			}
+			if options.UserID == "" && (options.Username == "" || options.DomainName == "") {
+				return nil, fmt.Errorf("could not find user_id or username and user_domain_name in cloud %s in config file %s", context, configFile)
+			}
+		}
+		return &options, nil
+	}
 
 	projectName := cloud.Auth.ProjectName
 	projectID := cloud.Auth.ProjectID
@@ -262,13 +556,22 @@ func getAuthOptionsFromConfig(configFile, context string) (*gophercloud.AuthOpti
 		return nil, fmt.Errorf("could not find project_name or project_id in cloud %s in config file %s", context, configFile)
 	}
 
-	if cloud.Auth.Username == "" {
-		return nil, fmt.Errorf("could not find username in cloud %s in config file %s", context, configFile)
-	}
-	if cloud.Auth.Password == "" {
-		return nil, fmt.Errorf("could not find password in cloud %s in config file %s", context, configFile)
+	switch authType {
+	case authTypeToken:
+		if cloud.Auth.Token == "" {
+			return nil, fmt.Errorf("could not find token in cloud %s in config file %s", context, configFile)
+		}
+		options.TokenID = cloud.Auth.Token
+	case authTypePassword:
+		if cloud.Auth.Username == "" {
+			return nil, fmt.Errorf("could not find username in cloud %s in config file %s", context, configFile)
+		}
+		if cloud.Auth.Password == "" {
+			return nil, fmt.Errorf("could not find password in cloud %s in config file %s", context, configFile)
+		}
+		options.Username = cloud.Auth.Username
+		options.Password = cloud.Auth.Password
 	}
-	options := gophercloud.AuthOptions{IdentityEndpoint: cloud.Auth.AuthUrl, Username: cloud.Auth.Username, Password: cloud.Auth.Password}
 	if projectName != "" {
 		options.TenantName = projectName
 	}
@@ -279,43 +582,58 @@ func getAuthOptionsFromConfig(configFile, context string) (*gophercloud.AuthOpti
 	return &options, nil
 }
 
-func GetVolumeAttachmentsForServerNova(osProvider *gophercloud.ProviderClient, servers map[string]servers.Server) (map[string]*NovaVolumeAttachments, error) {
+// GetVolumeAttachmentsForServerNova gets the attachments of all servers concurrently
+func GetVolumeAttachmentsForServerNova(osProvider *Client, servers map[string]servers.Server) (map[string]*NovaVolumeAttachments, error) {
 	attachments := map[string]*NovaVolumeAttachments{}
+	var lock sync.Mutex
 
+	var fns []func() error
 	for server := range servers {
-		volumeAttachments, err := GetVolumeAttachmentsNova(osProvider, server)
-		if err != nil {
-			return nil, err
-		}
-		attachments[server] = volumeAttachments
+		server := server
+		fns = append(fns, func() error {
+			volumeAttachments, err := GetVolumeAttachmentsNova(osProvider, server)
+			if err != nil {
+				return err
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			attachments[server] = volumeAttachments
+			return nil
+		})
+	}
+
+	start := time.Now()
+	if err := parallel.Run(osProvider.Concurrency, fns...); err != nil {
+		return nil, err
 	}
+	logDuration(fmt.Sprintf("volume attachments of %d server", len(servers)), start)
 
 	return attachments, nil
 }
 
-func GetVolumeAttachmentsNova(osProvider *gophercloud.ProviderClient, serverID string) (*NovaVolumeAttachments, error) {
+func GetVolumeAttachmentsNova(osProvider *Client, serverID string) (*NovaVolumeAttachments, error) {
 
-	computeClient, err := openstack.NewComputeV2(osProvider, gophercloud.EndpointOpts{})
+	computeClient, err := osProvider.computeV2()
 	if err != nil {
 		return nil, fmt.Errorf("error creating compute client: %v", err)
 	}
 
 	url := computeClient.ServiceURL("servers", serverID, "os-volume_attachments")
 
+	start := time.Now()
 	attachments := &NovaVolumeAttachments{}
 	_, err = computeClient.Get(url, attachments, &gophercloud.RequestOpts{OkCodes: []int{200}})
 	if err != nil {
-		return nil, fmt.Errorf("error attaching volume: %v", err)
+		return nil, fmt.Errorf("error getting volume attachments of server %s: %v", serverID, err)
 	}
+	klog.V(2).Infof("Got volume attachments of server %s in %s", serverID, time.Since(start).Round(time.Millisecond))
 
 	return attachments, nil
 }
 
-func AttachVolumeNova(osProvider *gophercloud.ProviderClient, volumeID, serverID string) error {
+func AttachVolumeNova(osProvider *Client, volumeID, serverID string) error {
 
-	fmt.Printf("Attaching volume %s to server %s via nova\n", volumeID, serverID)
-
-	computeClient, err := openstack.NewComputeV2(osProvider, gophercloud.EndpointOpts{})
+	computeClient, err := osProvider.computeV2()
 	if err != nil {
 		return fmt.Errorf("error creating compute client: %v", err)
 	}
@@ -327,15 +645,23 @@ func AttachVolumeNova(osProvider *gophercloud.ProviderClient, volumeID, serverID
 			VolumeID: volumeID,
 		},
 	}
-
-	resp, err := computeClient.Post(url, attach, nil, &gophercloud.RequestOpts{OkCodes: []int{200}})
-	if err != nil {
-		return fmt.Errorf("error attaching volume: %v", err)
+	if osProvider.DryRun != nil {
+		return printRequest(osProvider.DryRun, http.MethodPost, url, attach)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	fmt.Printf("Attaching volume %s to server %s via nova\n", volumeID, serverID)
+
+	body, err := osProvider.changeVolume(computeClient, volumeChange{
+		action:   "attach-nova",
+		volumeID: volumeID,
+		serverID: serverID,
+		method:   http.MethodPost,
+		url:      url,
+		body:     attach,
+		okCodes:  []int{200},
+	})
 	if err != nil {
-		return fmt.Errorf("error reading response from attach volume: %v", err)
+		return fmt.Errorf("error attaching volume: %v", err)
 	}
 
 	fmt.Printf("Response from attach volume from nova: %s\n", string(body))
@@ -343,25 +669,30 @@ func AttachVolumeNova(osProvider *gophercloud.ProviderClient, volumeID, serverID
 	return nil
 }
 
-func DetachVolumeNova(osProvider *gophercloud.ProviderClient, volumeID, serverID string) error {
-
-	fmt.Printf("Detaching volume %s from server %s via nova\n", volumeID, serverID)
+func DetachVolumeNova(osProvider *Client, volumeID, serverID string) error {
 
-	computeClient, err := openstack.NewComputeV2(osProvider, gophercloud.EndpointOpts{})
+	computeClient, err := osProvider.computeV2()
 	if err != nil {
 		return fmt.Errorf("error creating compute client: %v", err)
 	}
 
 	url := computeClient.ServiceURL("servers", serverID, "os-volume_attachments", volumeID)
-
-	resp, err := computeClient.Delete(url, &gophercloud.RequestOpts{OkCodes: []int{202}})
-	if err != nil {
-		return fmt.Errorf("error deleting volume from nova: %v", err)
+	if osProvider.DryRun != nil {
+		return printRequest(osProvider.DryRun, http.MethodDelete, url, nil)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	fmt.Printf("Detaching volume %s from server %s via nova\n", volumeID, serverID)
+
+	body, err := osProvider.changeVolume(computeClient, volumeChange{
+		action:   "detach-nova",
+		volumeID: volumeID,
+		serverID: serverID,
+		method:   http.MethodDelete,
+		url:      url,
+		okCodes:  []int{202},
+	})
 	if err != nil {
-		return fmt.Errorf("error reading response from detach volume: %v", err)
+		return fmt.Errorf("error deleting volume from nova: %v", err)
 	}
 
 	fmt.Printf("Response from detach volume from nova: %s\n", string(body))
@@ -369,6 +700,48 @@ func DetachVolumeNova(osProvider *gophercloud.ProviderClient, volumeID, serverID
 	return nil
 }
 
+// VolumeState is a volume as seen by Cinder and whether it is attached to a server in Nova
+type VolumeState struct {
+	Volume volumes.Volume
+	// NovaAttached is set if the volume is listed in the os-volume_attachments of the server
+	NovaAttached bool
+}
+
+// WaitForVolume polls the volume in Cinder and, if serverID is set, the volume attachments of the
+// server in Nova until check returns an empty string. check describes how the state diverges from
+// the expected state, the last description is returned if the state isn't reached within timeout.
+func WaitForVolume(osProvider *Client, volumeID, serverID string, timeout, interval time.Duration, check func(state VolumeState) string) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		v, err := GetVolume(osProvider, volumeID)
+		if err != nil {
+			return err
+		}
+		state := VolumeState{Volume: *v}
+		if serverID != "" {
+			attachments, err := GetVolumeAttachmentsNova(osProvider, serverID)
+			if err != nil {
+				return err
+			}
+			for _, a := range attachments.VolumeAttachments {
+				if a.VolumeID == volumeID {
+					state.NovaAttached = true
+				}
+			}
+		}
+
+		diverged := check(state)
+		if diverged == "" {
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("volume %s didn't reach the expected state within %s: %s", volumeID, timeout, diverged)
+		}
+		klog.V(1).Infof("Waiting for volume %s: %s", volumeID, diverged)
+		time.Sleep(interval)
+	}
+}
+
 type NovaVolumeAttachments struct {
 	VolumeAttachments []*novaAttachment `json:"volumeAttachments"`
 }
@@ -384,19 +757,19 @@ type novaAttachment struct {
 	VolumeID string ` json:"volumeId,omitempty"`
 }
 
-func DetachVolumeCinder(osProvider *gophercloud.ProviderClient, volumeID string, force bool) error {
+func DetachVolumeCinder(osProvider *Client, volumeID string, force bool) error {
 
-	fmt.Printf("Detaching volume %s from cinder (force: %t)\n", volumeID, force)
-
-	blockStorageClient, err := openstack.NewBlockStorageV3(osProvider, gophercloud.EndpointOpts{})
+	blockStorageClient, err := osProvider.blockStorageV3()
 	if err != nil {
 		return fmt.Errorf("error creating volume client: %v", err)
 	}
 
 	url := blockStorageClient.ServiceURL("volumes", volumeID, "action")
 
+	action := "detach-cinder"
 	var detach interface{}
 	if force {
+		action = "force-detach-cinder"
 		detach = &cinderForceDetachVolume{
 			OsDetach: &cinderDetachment{AttachmentID: volumeID},
 		}
@@ -405,14 +778,22 @@ func DetachVolumeCinder(osProvider *gophercloud.ProviderClient, volumeID string,
 			OsDetach: &cinderDetachment{AttachmentID: volumeID},
 		}
 	}
-	resp, err := blockStorageClient.Post(url, detach, nil, &gophercloud.RequestOpts{OkCodes: []int{202}})
-	if err != nil {
-		return fmt.Errorf("error deleting volume from cinder: %v", err)
+	if osProvider.DryRun != nil {
+		return printRequest(osProvider.DryRun, http.MethodPost, url, detach)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	fmt.Printf("Detaching volume %s from cinder (force: %t)\n", volumeID, force)
+
+	body, err := osProvider.changeVolume(blockStorageClient, volumeChange{
+		action:   action,
+		volumeID: volumeID,
+		method:   http.MethodPost,
+		url:      url,
+		body:     detach,
+		okCodes:  []int{202},
+	})
 	if err != nil {
-		return fmt.Errorf("error reading response from detach volume: %v", err)
+		return fmt.Errorf("error deleting volume from cinder: %v", err)
 	}
 
 	fmt.Printf("Response from detach volume from cinder: %s\n", string(body))
@@ -420,11 +801,9 @@ func DetachVolumeCinder(osProvider *gophercloud.ProviderClient, volumeID string,
 	return nil
 }
 
-func AttachVolumeCinder(osProvider *gophercloud.ProviderClient, volumeID, serverID, mountpoint string) error {
-
-	fmt.Printf("Attaching volume %s to server %s via cinder\n", volumeID, serverID)
+func AttachVolumeCinder(osProvider *Client, volumeID, serverID, mountpoint string) error {
 
-	blockStorageClient, err := openstack.NewBlockStorageV3(osProvider, gophercloud.EndpointOpts{})
+	blockStorageClient, err := osProvider.blockStorageV3()
 	if err != nil {
 		return fmt.Errorf("error creating volume client: %v", err)
 	}
@@ -437,19 +816,125 @@ func AttachVolumeCinder(osProvider *gophercloud.ProviderClient, volumeID, server
 			Mountpoint:   mountpoint,
 		},
 	}
+	if osProvider.DryRun != nil {
+		return printRequest(osProvider.DryRun, http.MethodPost, url, attach)
+	}
+
+	fmt.Printf("Attaching volume %s to server %s via cinder\n", volumeID, serverID)
 
-	resp, err := blockStorageClient.Post(url, attach, nil, &gophercloud.RequestOpts{OkCodes: []int{202}})
+	body, err := osProvider.changeVolume(blockStorageClient, volumeChange{
+		action:   "attach-cinder",
+		volumeID: volumeID,
+		serverID: serverID,
+		method:   http.MethodPost,
+		url:      url,
+		body:     attach,
+		okCodes:  []int{202},
+	})
 	if err != nil {
 		return fmt.Errorf("error attaching volume: %v", err)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	fmt.Printf("Response from attach volume from cinder: %s\n", string(body))
+
+	return nil
+}
+
+// volumeChange is a request which changes a volume, e.g. attaches or detaches it
+type volumeChange struct {
+	action   string
+	volumeID string
+	serverID string
+	method   string
+	url      string
+	body     interface{}
+	okCodes  []int
+	// headers are additional headers, e.g. the microversion
+	headers map[string]string
+}
+
+// changeVolume sends the request and returns the body of the response. If the client has an
+// audit log, the request and the response are recorded together with the Cinder status of the
+// volume before and after the request.
+func (c *Client) changeVolume(sc *gophercloud.ServiceClient, change volumeChange) ([]byte, error) {
+	entry := audit.Entry{
+		Time:     time.Now(),
+		Action:   change.action,
+		VolumeID: change.volumeID,
+		ServerID: change.serverID,
+		Method:   change.method,
+		URL:      change.url,
+	}
+	if c.Audit != nil {
+		if change.body != nil {
+			body, err := json.Marshal(change.body)
+			if err != nil {
+				return nil, fmt.Errorf("error marshalling request: %v", err)
+			}
+			entry.Body = body
+		}
+		entry.StatusBefore = c.volumeStatus(change.volumeID)
+	}
+
+	opts := &gophercloud.RequestOpts{OkCodes: change.okCodes, MoreHeaders: change.headers}
+	var resp *http.Response
+	var err error
+	if change.method == http.MethodDelete {
+		resp, err = sc.Delete(change.url, opts)
+	} else {
+		resp, err = sc.Post(change.url, change.body, nil, opts)
+	}
+	var body []byte
+	if err == nil {
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			err = fmt.Errorf("error reading response: %v", err)
+		}
+	}
+	if c.Audit == nil {
+		return body, err
+	}
+
+	if resp != nil {
+		entry.ResponseCode = resp.StatusCode
+	}
+	entry.ResponseBody = string(body)
 	if err != nil {
-		return fmt.Errorf("error reading response from attach volume: %v", err)
+		entry.Error = err.Error()
 	}
+	entry.StatusAfterRequest = c.volumeStatus(change.volumeID)
+	if auditErr := c.Audit.Record(entry); auditErr != nil {
+		if err != nil {
+			return body, fmt.Errorf("%v, %v", err, auditErr)
+		}
+		return body, auditErr
+	}
+	return body, err
+}
 
-	fmt.Printf("Response from attach volume from cinder: %s\n", string(body))
+// volumeStatus returns the Cinder status of the volume for the audit log, it's unknown if the
+// volume can't be retrieved
+func (c *Client) volumeStatus(volumeID string) string {
+	v, err := GetVolume(c, volumeID)
+	if err != nil {
+		klog.V(2).Infof("Error getting status of volume %s: %v", volumeID, err)
+		return "unknown"
+	}
+	return v.Status
+}
 
+// printRequest prints the method, url and json body of a request instead of sending it
+func printRequest(w io.Writer, method, url string, body interface{}) error {
+	fmt.Fprintf(w, "%s %s\n", method, url)
+	if body == nil {
+		return nil
+	}
+	content, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling request: %v", err)
+	}
+	fmt.Fprintf(w, "%s\n", content)
 	return nil
 }
 
@@ -0,0 +1,142 @@
+package openstack
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestGetTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "openstack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caCertFile := filepath.Join(dir, "ca.pem")
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caCertFile, caCert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfig, err := getTLSConfig(true, "", "", "")
+	if err != nil || tlsConfig != nil {
+		t.Errorf("expected default tls config, got %v, %v", tlsConfig, err)
+	}
+
+	for name, verify := range map[string]bool{"cacert": true, "insecure": false} {
+		file := caCertFile
+		if !verify {
+			file = ""
+		}
+		tlsConfig, err := getTLSConfig(verify, file, "", "")
+		if err != nil {
+			t.Fatalf("%s: error creating tls config: %v", name, err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Errorf("%s: error calling server: %v", name, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+
+	if _, err := getTLSConfig(true, "", filepath.Join(dir, "cert.pem"), ""); err == nil {
+		t.Errorf("expected error if key is missing")
+	}
+}
+
+func TestGetAuthOptionsFromCloud(t *testing.T) {
+	tests := []struct {
+		name    string
+		cloud   cloud
+		check   func(options *gophercloud.AuthOptions) bool
+		wantErr bool
+	}{
+		{
+			name:  "password",
+			cloud: cloud{Auth: cloudAuth{AuthUrl: "https://keystone", Username: "user", Password: "password", ProjectID: "project"}},
+			check: func(o *gophercloud.AuthOptions) bool {
+				return o.Username == "user" && o.Password == "password" && o.TenantID == "project"
+			},
+		},
+		{
+			name:    "password without password",
+			cloud:   cloud{Auth: cloudAuth{AuthUrl: "https://keystone", Username: "user", ProjectID: "project"}},
+			wantErr: true,
+		},
+		{
+			name:  "application credential by id",
+			cloud: cloud{AuthType: "v3applicationcredential", Auth: cloudAuth{AuthUrl: "https://keystone", ApplicationCredentialID: "id", ApplicationCredentialSecret: "secret"}},
+			check: func(o *gophercloud.AuthOptions) bool {
+				return o.ApplicationCredentialID == "id" && o.ApplicationCredentialSecret == "secret" && o.TenantID == "" && o.TenantName == ""
+			},
+		},
+		{
+			name:  "application credential by name",
+			cloud: cloud{Auth: cloudAuth{AuthUrl: "https://keystone", ApplicationCredentialName: "name", ApplicationCredentialSecret: "secret", Username: "user", UserDomainName: "domain"}},
+			check: func(o *gophercloud.AuthOptions) bool {
+				return o.ApplicationCredentialName == "name" && o.Username == "user" && o.DomainName == "domain"
+			},
+		},
+		{
+			name:    "application credential by name without user",
+			cloud:   cloud{Auth: cloudAuth{AuthUrl: "https://keystone", ApplicationCredentialName: "name", ApplicationCredentialSecret: "secret"}},
+			wantErr: true,
+		},
+		{
+			name:  "token",
+			cloud: cloud{AuthType: "token", Auth: cloudAuth{AuthUrl: "https://keystone", Token: "token", ProjectName: "project", DomainName: "domain"}},
+			check: func(o *gophercloud.AuthOptions) bool {
+				return o.TokenID == "token" && o.TenantName == "project" && o.Password == ""
+			},
+		},
+		{
+			name:    "unknown auth type",
+			cloud:   cloud{AuthType: "oidc", Auth: cloudAuth{AuthUrl: "https://keystone", ProjectID: "project"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		options, err := getAuthOptionsFromCloud(&tt.cloud, "clouds.yaml", "test")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %t, got %v", tt.name, tt.wantErr, err)
+			continue
+		}
+		if err == nil && !tt.check(options) {
+			t.Errorf("%s: unexpected auth options %+v", tt.name, options)
+		}
+	}
+}
+
+func TestVerifyCloud(t *testing.T) {
+	verify, noVerify := true, false
+	tests := []struct {
+		name     string
+		verify   *bool
+		insecure string
+		expected bool
+	}{
+		{name: "default", expected: true},
+		{name: "verify", verify: &verify, insecure: "true", expected: true},
+		{name: "legacy verify false", verify: &noVerify, expected: true},
+		{name: "verify false with opt-in", verify: &noVerify, insecure: "true", expected: false},
+	}
+	defer os.Unsetenv(insecureEnvVar)
+	for _, tt := range tests {
+		os.Setenv(insecureEnvVar, tt.insecure)
+		if got := verifyCloud(&cloud{Verify: tt.verify}, "cloud"); got != tt.expected {
+			t.Errorf("%s: expected verify %t, got %t", tt.name, tt.expected, got)
+		}
+	}
+}
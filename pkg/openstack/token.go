@@ -0,0 +1,152 @@
+package openstack
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/cache"
+	"k8s.io/klog"
+)
+
+const (
+	// tokenCacheFile is the file the Keystone token is cached in per cloud
+	tokenCacheFile = "token.json"
+	// tokenExpiryMargin is the minimum remaining lifetime of a cached token to be reused
+	tokenExpiryMargin = 5 * time.Minute
+)
+
+// cachedToken is a cached Keystone v3 token with the response body which contains the service catalog
+type cachedToken struct {
+	// Fingerprint identifies the auth options the token has been created with
+	Fingerprint string      `json:"fingerprint"`
+	ID          string      `json:"id"`
+	ExpiresAt   time.Time   `json:"expiresAt"`
+	Body        interface{} `json:"body"`
+}
+
+// authenticate authenticates the provider client. A valid Keystone v3 token cached for the cloud is
+// reused, new tokens are cached.
+func authenticate(osProvider *gophercloud.ProviderClient, authOptions gophercloud.AuthOptions, c *cache.Cache, cloudName string) error {
+	fingerprint := authFingerprint(authOptions)
+
+	var token cachedToken
+	found, err := c.Load(&token, tokenCacheFile, "clouds", cloudName)
+	if err != nil {
+		klog.Warningf("Error loading cached token of cloud %s: %v", cloudName, err)
+	}
+	if found && token.Fingerprint == fingerprint && time.Until(token.ExpiresAt) > tokenExpiryMargin {
+		if err := useCachedToken(osProvider, token); err == nil {
+			klog.V(1).Infof("Using cached token of cloud %s valid until %s", cloudName, token.ExpiresAt)
+			osProvider.ReauthFunc = func() error {
+				return reauthenticate(osProvider, authOptions, c, cloudName)
+			}
+			return nil
+		}
+		klog.Warningf("Error using cached token of cloud %s: %v", cloudName, err)
+	}
+
+	if err := openstack.Authenticate(osProvider, authOptions); err != nil {
+		return authError(cloudName, err)
+	}
+	storeToken(osProvider, c, cloudName, fingerprint)
+	return nil
+}
+
+// AuthError is returned if Keystone rejected the credentials of a cloud
+type AuthError struct {
+	Cloud string
+	Err   error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("error authenticating against cloud %s: %v", e.Cloud, e.Err)
+}
+
+// Unwrap returns the error of Keystone
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// authError returns an AuthError if err is a 401 or 403 response of Keystone
+func authError(cloudName string, err error) error {
+	switch err.(type) {
+	case gophercloud.ErrDefault401, gophercloud.ErrDefault403:
+		return &AuthError{Cloud: cloudName, Err: err}
+	}
+	return err
+}
+
+// reauthenticate gets a new token if a cached token has been revoked before it expired
+func reauthenticate(osProvider *gophercloud.ProviderClient, authOptions gophercloud.AuthOptions, c *cache.Cache, cloudName string) error {
+	tmpProvider, err := openstack.NewClient(authOptions.IdentityEndpoint)
+	if err != nil {
+		return err
+	}
+	tmpProvider.HTTPClient = osProvider.HTTPClient
+	if err := openstack.Authenticate(tmpProvider, authOptions); err != nil {
+		return err
+	}
+	osProvider.CopyTokenFrom(tmpProvider)
+	storeToken(tmpProvider, c, cloudName, authFingerprint(authOptions))
+	return nil
+}
+
+// useCachedToken sets the token and the endpoint locator of the provider client like
+// openstack.Authenticate does for a new token
+func useCachedToken(osProvider *gophercloud.ProviderClient, token cachedToken) error {
+	result := tokens3.CreateResult{}
+	result.Body = token.Body
+	result.Header = http.Header{}
+	result.Header.Set("X-Subject-Token", token.ID)
+
+	catalog, err := result.ExtractServiceCatalog()
+	if err != nil {
+		return fmt.Errorf("error extracting service catalog: %v", err)
+	}
+	if err := osProvider.SetTokenAndAuthResult(result); err != nil {
+		return err
+	}
+	osProvider.EndpointLocator = func(opts gophercloud.EndpointOpts) (string, error) {
+		return openstack.V3EndpointURL(catalog, opts)
+	}
+	return nil
+}
+
+// storeToken caches the token of the provider client, caching is best effort so errors are only logged
+func storeToken(osProvider *gophercloud.ProviderClient, c *cache.Cache, cloudName, fingerprint string) {
+	// Keystone v2 tokens are not cached
+	result, ok := osProvider.GetAuthResult().(tokens3.CreateResult)
+	if !ok || c == nil {
+		return
+	}
+	t, err := result.ExtractToken()
+	if err != nil {
+		klog.Warningf("Error extracting token of cloud %s: %v", cloudName, err)
+		return
+	}
+	token := cachedToken{
+		Fingerprint: fingerprint,
+		ID:          osProvider.Token(),
+		ExpiresAt:   t.ExpiresAt,
+		Body:        result.Body,
+	}
+	if err := c.Store(token, tokenCacheFile, "clouds", cloudName); err != nil {
+		klog.Warningf("Error caching token of cloud %s: %v", cloudName, err)
+	}
+}
+
+// authFingerprint is a hash of the auth options, so a cached token is not used anymore after
+// e.g. the user or the password of a cloud changed
+func authFingerprint(authOptions gophercloud.AuthOptions) string {
+	var scope gophercloud.AuthScope
+	if authOptions.Scope != nil {
+		scope = *authOptions.Scope
+	}
+	authOptions.Scope = nil
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%+v %+v", authOptions, scope))))
+}
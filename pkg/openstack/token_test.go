@@ -0,0 +1,90 @@
+package openstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/cache"
+)
+
+func TestAuthenticateCachedToken(t *testing.T) {
+	var server *httptest.Server
+	tokens := 0
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/auth/tokens" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		tokens++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%d", tokens))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"expires_at": %q, "catalog": [{"type": "compute", "endpoints": [{"interface": "public", "region": "region-a", "url": "%s/compute/v2.1"}]}]}}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339), server.URL)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	c := &cache.Cache{Dir: dir, TTL: time.Minute}
+
+	authOptions := gophercloud.AuthOptions{IdentityEndpoint: server.URL + "/v3", Username: "user", Password: "password", DomainName: "default"}
+	tests := []struct {
+		name        string
+		cache       *cache.Cache
+		authOptions gophercloud.AuthOptions
+		wantToken   string
+	}{
+		{name: "new token", cache: c, authOptions: authOptions, wantToken: "token-1"},
+		{name: "cached token", cache: c, authOptions: authOptions, wantToken: "token-1"},
+		{name: "refresh", cache: &cache.Cache{Dir: dir, Refresh: true}, authOptions: authOptions, wantToken: "token-2"},
+		{name: "refreshed token", cache: c, authOptions: authOptions, wantToken: "token-2"},
+		{name: "changed password", cache: c, authOptions: gophercloud.AuthOptions{IdentityEndpoint: server.URL + "/v3", Username: "user", Password: "new", DomainName: "default"}, wantToken: "token-3"},
+		{name: "no cache", cache: nil, authOptions: authOptions, wantToken: "token-4"},
+	}
+	for _, tt := range tests {
+		osProvider, err := openstack.NewClient(tt.authOptions.IdentityEndpoint)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := authenticate(osProvider, tt.authOptions, tt.cache, "cloud-a"); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if osProvider.Token() != tt.wantToken {
+			t.Errorf("%s: got token %s, want %s", tt.name, osProvider.Token(), tt.wantToken)
+		}
+		url, err := osProvider.EndpointLocator(gophercloud.EndpointOpts{Type: "compute", Region: "region-a", Availability: gophercloud.AvailabilityPublic})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if url != server.URL+"/compute/v2.1/" {
+			t.Errorf("%s: unexpected compute endpoint %s", tt.name, url)
+		}
+	}
+}
+
+func TestAuthenticateRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	authOptions := gophercloud.AuthOptions{IdentityEndpoint: server.URL + "/v3", Username: "user", Password: "wrong", DomainName: "default"}
+	osProvider, err := openstack.NewClient(authOptions.IdentityEndpoint)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = authenticate(osProvider, authOptions, nil, "cloud-a")
+	if _, ok := err.(*AuthError); !ok {
+		t.Errorf("expected AuthError, got %T: %v", err, err)
+	}
+}
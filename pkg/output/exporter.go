@@ -0,0 +1,152 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Message is the output of a command for one or more contexts which is handed to the exporters
+type Message struct {
+	// Command is the command which created the message, e.g. volumes
+	Command string
+	// Title frames the content, e.g. "Volumes for <tenant>"
+	Title string
+	// Contexts are the kube contexts the content was created for
+	Contexts []string
+	// TenantIDs are the OpenStack tenants the content was created for
+	TenantIDs []string
+	// Output is the output format of the content
+	Output string
+	// Content is the rendered output
+	Content string
+	// Records are the records the content was rendered from
+	Records interface{}
+	// Notes are the problems found in the records
+	Notes []string
+}
+
+// Text returns the content framed by the title. Everything except markdown is put in a code block.
+func (m Message) Text() string {
+	if m.Output == "markdown" {
+		return fmt.Sprintf("%s:\n\n%s\n\n", m.Title, m.Content)
+	}
+	return fmt.Sprintf("%s:\n\n````\n%s````\n\n", m.Title, m.Content)
+}
+
+// Exporter sends messages to a sink
+type Exporter interface {
+	Export(msg Message) error
+}
+
+// ExporterConfig is the configuration of an exporter, set via --exporter-config <exporter>.<key>=<value>
+type ExporterConfig map[string]string
+
+// Get returns the value of key or, if it is not set, of the env var
+func (c ExporterConfig) Get(key, envVar string) string {
+	if value, ok := c[key]; ok {
+		return value
+	}
+	return os.Getenv(envVar)
+}
+
+// ExporterFactory creates an exporter from its configuration
+type ExporterFactory func(config ExporterConfig) (Exporter, error)
+
+var exporterFactories = map[string]ExporterFactory{}
+
+// RegisterExporter makes an exporter available under the given name. It is
+// usually called in the init function of the package implementing the exporter.
+func RegisterExporter(name string, factory ExporterFactory) {
+	if _, ok := exporterFactories[name]; ok {
+		panic(fmt.Errorf("exporter %s already registered", name))
+	}
+	exporterFactories[name] = factory
+}
+
+// ExporterNames returns the names of all registered exporters
+func ExporterNames() []string {
+	var names []string
+	for name := range exporterFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewExporters creates the exporters with the given comma-separated names. config contains
+// the configuration of all exporters with keys of the form <exporter>.<key>, the stdout exporter
+// writes to out.
+func NewExporters(names string, config map[string]string, out io.Writer) ([]Exporter, error) {
+	var exporters []Exporter
+	for _, name := range strings.Split(names, ",") {
+		factory, ok := exporterFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown exporter %q, available exporters are: %s", name, strings.Join(ExporterNames(), ", "))
+		}
+
+		exporterConfig := ExporterConfig{}
+		for key, value := range config {
+			if strings.HasPrefix(key, name+".") {
+				exporterConfig[strings.TrimPrefix(key, name+".")] = value
+			}
+		}
+
+		exporter, err := factory(exporterConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating exporter %s: %v", name, err)
+		}
+		if stdout, ok := exporter.(*stdoutExporter); ok && out != nil {
+			stdout.out = out
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters, nil
+}
+
+// ExportError is returned if a message could not be delivered by at least one exporter
+type ExportError struct {
+	Command string
+	Errors  []error
+}
+
+func (e *ExportError) Error() string {
+	var errs []string
+	for _, err := range e.Errors {
+		errs = append(errs, err.Error())
+	}
+	return fmt.Sprintf("error exporting %s: %s", e.Command, strings.Join(errs, ", "))
+}
+
+// Export sends the message to all exporters. Every exporter is called even if a
+// previous one failed, the errors are returned combined as ExportError.
+func Export(exporters []Exporter, msg Message) error {
+	var errs []error
+	for _, exporter := range exporters {
+		if err := exporter.Export(msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return &ExportError{Command: msg.Command, Errors: errs}
+	}
+	return nil
+}
+
+func init() {
+	RegisterExporter("stdout", func(config ExporterConfig) (Exporter, error) {
+		return &stdoutExporter{out: os.Stdout}, nil
+	})
+}
+
+// stdoutExporter prints the content without framing to the output of the command
+type stdoutExporter struct {
+	out io.Writer
+}
+
+func (e *stdoutExporter) Export(msg Message) error {
+	_, err := fmt.Fprint(e.out, msg.Content)
+	return err
+}
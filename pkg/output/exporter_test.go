@@ -0,0 +1,20 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStdoutExporter(t *testing.T) {
+	out := &bytes.Buffer{}
+	exporters, err := NewExporters("stdout", map[string]string{}, out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := Export(exporters, Message{Command: "volumes", Title: "Volumes", Content: "content\n"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "content\n" {
+		t.Errorf("expected the content without framing, got %q", out.String())
+	}
+}
@@ -20,20 +20,23 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
-	"time"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
 )
 
+func init() {
+	output.RegisterExporter("mm", New)
+}
+
 var mattermostColors = map[string]string{
 	"Normal":  "#00FF00",
 	"Warning": "#FFFF00",
 	"Danger":  "#FF0000",
 }
 
-// Mattermost handler implements handler.Handler interface,
-// Notify event to Mattermost channel
+// Mattermost implements the output.Exporter interface,
+// it sends messages to a Mattermost channel
 type Mattermost struct {
 	Channel  string
 	Url      string
@@ -54,35 +57,36 @@ type MattermostMessageAttachement struct {
 	Color string `json:"color"`
 }
 
-// Init prepares Mattermost configuration
-func New() *Mattermost {
-	channel := os.Getenv("KUBECTL_OS_MATTERMOST_CHANNEL")
-	url := os.Getenv("KUBECTL_OS_MATTERMOST_URL")
-	username := os.Getenv("KUBECTL_OS_MATTERMOST_USERNAME")
-
+// New prepares Mattermost configuration, the config keys channel, url and username
+// default to the env vars KUBECTL_OS_MATTERMOST_CHANNEL, KUBECTL_OS_MATTERMOST_URL and KUBECTL_OS_MATTERMOST_USERNAME
+func New(config output.ExporterConfig) (output.Exporter, error) {
 	m := &Mattermost{
-		Channel:  channel,
-		Url:      url,
-		Username: username,
+		Channel:  config.Get("channel", "KUBECTL_OS_MATTERMOST_CHANNEL"),
+		Url:      config.Get("url", "KUBECTL_OS_MATTERMOST_URL"),
+		Username: config.Get("username", "KUBECTL_OS_MATTERMOST_USERNAME"),
 	}
 
 	err := checkMissingMattermostVars(m)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return m
+	return m, nil
 }
 
-func (m *Mattermost) SendMessage(text string) {
+// Export sends the message framed by its title to the channel
+func (m *Mattermost) Export(msg output.Message) error {
+	return m.SendMessage(msg.Text())
+}
+
+// SendMessage sends text to the channel
+func (m *Mattermost) SendMessage(text string) error {
 	mattermostMessage := prepareMattermostMessage(m, text)
 
 	err := postMessage(m.Url, mattermostMessage)
 	if err != nil {
-		log.Printf("%s\n", err)
-		return
+		return fmt.Errorf("error sending message to Mattermost channel %s: %v", m.Channel, err)
 	}
-
-	log.Printf("Message successfully sent to channel %s at %s", m.Channel, time.Now())
+	return nil
 }
 
 func checkMissingMattermostVars(s *Mattermost) error {
@@ -123,10 +127,14 @@ func postMessage(url string, mattermostMessage *MattermostMessage) error {
 	req.Header.Add("Content-Type", "application/json")
 
 	client := &http.Client{}
-	_, err = client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
 	return nil
 }
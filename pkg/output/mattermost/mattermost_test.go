@@ -1,9 +1,39 @@
 package mattermost
 
-import "testing"
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+)
 
 func Test(t *testing.T) {
+	var received MattermostMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("error decoding message: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	m, err := New(output.ExporterConfig{"channel": "channel", "url": server.URL, "username": "user"})
+	if err != nil {
+		t.Fatalf("error creating exporter: %v", err)
+	}
+	err = m.Export(output.Message{Title: "Volumes for tenant", Output: "raw", Content: "test text\n"})
+	if err != nil {
+		t.Fatalf("error exporting message: %v", err)
+	}
 
-	New().SendMessage("test text")
+	if received.Channel != "channel" || received.Username != "user" || received.Text != "Volumes for tenant:\n\n````\ntest text\n````\n\n" {
+		t.Errorf("unexpected message: %+v", received)
+	}
+}
 
+func TestMissingConfig(t *testing.T) {
+	if _, err := New(output.ExporterConfig{"channel": "", "url": "", "username": ""}); err == nil {
+		t.Errorf("expected error for missing config")
+	}
 }
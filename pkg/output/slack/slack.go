@@ -0,0 +1,170 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+)
+
+func init() {
+	output.RegisterExporter("slack", New)
+}
+
+// maxSectionLength is the maximum length of the text of a section block
+// See https://api.slack.com/reference/block-kit/blocks#section
+const maxSectionLength = 3000
+
+// maxBlocks is the maximum number of blocks of a message, longer content is sent as multiple messages
+// See https://api.slack.com/reference/block-kit/blocks
+const maxBlocks = 50
+
+// Slack implements the output.Exporter interface,
+// it sends messages to a Slack incoming webhook
+type Slack struct {
+	Url      string
+	Channel  string
+	Username string
+}
+
+type SlackMessage struct {
+	Channel  string       `json:"channel,omitempty"`
+	Username string       `json:"username,omitempty"`
+	IconUrl  string       `json:"icon_url,omitempty"`
+	Text     string       `json:"text"`
+	Blocks   []SlackBlock `json:"blocks"`
+}
+
+type SlackBlock struct {
+	Type string     `json:"type"`
+	Text *SlackText `json:"text,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// New prepares Slack configuration, the config keys url, channel and username
+// default to the env vars KUBECTL_OS_SLACK_URL, KUBECTL_OS_SLACK_CHANNEL and KUBECTL_OS_SLACK_USERNAME.
+// Channel and username are optional, by default the ones configured for the webhook are used.
+func New(config output.ExporterConfig) (output.Exporter, error) {
+	s := &Slack{
+		Url:      config.Get("url", "KUBECTL_OS_SLACK_URL"),
+		Channel:  config.Get("channel", "KUBECTL_OS_SLACK_CHANNEL"),
+		Username: config.Get("username", "KUBECTL_OS_SLACK_USERNAME"),
+	}
+	if s.Url == "" {
+		return nil, fmt.Errorf("missing Slack url")
+	}
+	return s, nil
+}
+
+// Export sends the message to the webhook, the content is sent as code sections. Content which
+// doesn't fit into the blocks of one message is sent as multiple messages.
+func (s *Slack) Export(msg output.Message) error {
+	for _, slackMessage := range prepareSlackMessages(s, msg) {
+		err := postMessage(s.Url, slackMessage)
+		if err != nil {
+			return fmt.Errorf("error sending message to Slack: %v", err)
+		}
+	}
+	return nil
+}
+
+func prepareSlackMessages(s *Slack, msg output.Message) []*SlackMessage {
+	chunks := splitLines(msg.Content, maxSectionLength-len("``````"))
+	// the first block of every message is the title
+	perMessage := maxBlocks - 1
+	count := (len(chunks) + perMessage - 1) / perMessage
+	if count == 0 {
+		count = 1
+	}
+
+	var messages []*SlackMessage
+	for i := 0; i < count; i++ {
+		title := fmt.Sprintf("%s:", msg.Title)
+		if count > 1 {
+			title = fmt.Sprintf("%s (%d/%d):", msg.Title, i+1, count)
+		}
+		blocks := []SlackBlock{
+			{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*", title)}},
+		}
+		end := (i + 1) * perMessage
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+		for _, chunk := range chunks[i*perMessage : end] {
+			blocks = append(blocks, SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("```%s```", chunk)}})
+		}
+
+		messages = append(messages, &SlackMessage{
+			Channel:  s.Channel,
+			Username: s.Username,
+			IconUrl:  "https://raw.githubusercontent.com/sbueringer/kubectl-openstack-plugin/master/openstack-logo.png",
+			// text is used as fallback for notifications
+			Text:   title,
+			Blocks: blocks,
+		})
+	}
+	return messages
+}
+
+// splitLines splits content in chunks of at most max bytes, if possible on line breaks. Lines
+// are only cut on rune boundaries, so every chunk is valid UTF-8.
+func splitLines(content string, max int) []string {
+	var chunks []string
+	var chunk strings.Builder
+	for _, line := range strings.SplitAfter(content, "\n") {
+		for len(line) > max {
+			if chunk.Len() > 0 {
+				chunks = append(chunks, chunk.String())
+				chunk.Reset()
+			}
+			cut := max
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			chunks = append(chunks, line[:cut])
+			line = line[cut:]
+		}
+		if chunk.Len()+len(line) > max {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+		}
+		chunk.WriteString(line)
+	}
+	if chunk.Len() > 0 {
+		chunks = append(chunks, chunk.String())
+	}
+	return chunks
+}
+
+func postMessage(url string, slackMessage *SlackMessage) error {
+	message, err := json.Marshal(slackMessage)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
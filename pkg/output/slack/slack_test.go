@@ -0,0 +1,94 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+)
+
+func Test(t *testing.T) {
+	var received SlackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("error decoding message: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	s, err := New(output.ExporterConfig{"url": server.URL})
+	if err != nil {
+		t.Fatalf("error creating exporter: %v", err)
+	}
+	err = s.Export(output.Message{Title: "Volumes for tenant", Output: "raw", Content: "test text\n"})
+	if err != nil {
+		t.Fatalf("error exporting message: %v", err)
+	}
+
+	if received.Text != "Volumes for tenant:" || len(received.Blocks) != 2 || received.Blocks[1].Text.Text != "```test text\n```" {
+		t.Errorf("unexpected message: %+v", received)
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	s, err := New(output.ExporterConfig{"url": server.URL})
+	if err != nil {
+		t.Fatalf("error creating exporter: %v", err)
+	}
+	if err := s.Export(output.Message{Title: "Volumes for tenant", Content: "test text\n"}); err == nil {
+		t.Errorf("expected error for status code 404")
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	chunks := splitLines(strings.Repeat("1234\n", 5), 10)
+	if len(chunks) != 3 || chunks[0] != "1234\n1234\n" || chunks[2] != "1234\n" {
+		t.Errorf("unexpected chunks: %q", chunks)
+	}
+	chunks = splitLines("123456789012\n", 5)
+	if len(chunks) != 3 || chunks[0] != "12345" || chunks[2] != "12\n" {
+		t.Errorf("unexpected chunks: %q", chunks)
+	}
+	chunks = splitLines("aäääää\n", 4)
+	for _, chunk := range chunks {
+		if !utf8.ValidString(chunk) || len(chunk) > 4 {
+			t.Errorf("unexpected chunks: %q", chunks)
+		}
+	}
+	if strings.Join(chunks, "") != "aäääää\n" {
+		t.Errorf("unexpected chunks: %q", chunks)
+	}
+}
+
+func TestPrepareSlackMessages(t *testing.T) {
+	content := strings.Repeat(strings.Repeat("x", 99)+"\n", 30*maxBlocks)
+	messages := prepareSlackMessages(&Slack{}, output.Message{Title: "Volumes", Content: content})
+	if len(messages) < 2 {
+		t.Fatalf("expected multiple messages, got %d", len(messages))
+	}
+	var sent strings.Builder
+	for _, m := range messages {
+		if len(m.Blocks) > maxBlocks {
+			t.Errorf("message %q has %d blocks", m.Text, len(m.Blocks))
+		}
+		for _, b := range m.Blocks[1:] {
+			sent.WriteString(strings.TrimSuffix(strings.TrimPrefix(b.Text.Text, "```"), "```"))
+		}
+	}
+	if sent.String() != content {
+		t.Errorf("content of the messages differs from the exported content")
+	}
+	if messages[0].Text != fmt.Sprintf("Volumes (1/%d):", len(messages)) {
+		t.Errorf("unexpected title %q", messages[0].Text)
+	}
+}
@@ -0,0 +1,126 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// APIVersion is the version of the structured output documents. It must be bumped on
+// incompatible changes of the record types.
+const APIVersion = "kubectl-openstack.sbueringer.github.com/v1alpha1"
+
+// List is the envelope for structured output
+type List struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Items      interface{} `json:"items"`
+}
+
+const (
+	goTemplatePrefix     = "go-template="
+	goTemplateFilePrefix = "go-template-file="
+	jsonPathPrefix       = "jsonpath="
+)
+
+// IsStructured returns true if the output format is rendered from records instead of table lines
+func IsStructured(output string) bool {
+	switch output {
+	case "json", "yaml":
+		return true
+	}
+	return strings.HasPrefix(output, goTemplatePrefix) || strings.HasPrefix(output, goTemplateFilePrefix) || strings.HasPrefix(output, jsonPathPrefix)
+}
+
+// ConvertToStructured renders items as a versioned List of the given kind
+func ConvertToStructured(kind string, items interface{}, output string) (string, error) {
+	list := List{
+		APIVersion: APIVersion,
+		Kind:       kind,
+		Items:      items,
+	}
+
+	switch output {
+	case "json":
+		out, err := json.MarshalIndent(list, "", "    ")
+		if err != nil {
+			return "", fmt.Errorf("error marshalling %s to json: %v", kind, err)
+		}
+		return string(out) + "\n", nil
+	case "yaml":
+		out, err := yaml.Marshal(list)
+		if err != nil {
+			return "", fmt.Errorf("error marshalling %s to yaml: %v", kind, err)
+		}
+		return string(out), nil
+	}
+
+	switch {
+	case strings.HasPrefix(output, goTemplatePrefix):
+		return ExecuteGoTemplate(list, strings.TrimPrefix(output, goTemplatePrefix))
+	case strings.HasPrefix(output, goTemplateFilePrefix):
+		file := strings.TrimPrefix(output, goTemplateFilePrefix)
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("error reading template file %s: %v", file, err)
+		}
+		return ExecuteGoTemplate(list, string(content))
+	case strings.HasPrefix(output, jsonPathPrefix):
+		return executeJSONPath(list, strings.TrimPrefix(output, jsonPathPrefix))
+	}
+	return "", fmt.Errorf("unknown output: %s", output)
+}
+
+// ExecuteGoTemplate evaluates the template against the json representation of obj,
+// so fields are accessed by their json names like with kubectl, e.g. {{range .items}}{{.cluster}}{{end}}
+func ExecuteGoTemplate(obj interface{}, text string) (string, error) {
+	tmpl, err := template.New("output").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing template %s: %v", text, err)
+	}
+	data, err := toUnstructured(obj)
+	if err != nil {
+		return "", err
+	}
+	buff := &bytes.Buffer{}
+	if err := tmpl.Execute(buff, data); err != nil {
+		return "", fmt.Errorf("error executing template %s: %v", text, err)
+	}
+	return buff.String(), nil
+}
+
+// executeJSONPath evaluates the jsonpath expression against the json representation of the list,
+// e.g. {.items[*].cinder.id}
+func executeJSONPath(list List, text string) (string, error) {
+	j := jsonpath.New("output").AllowMissingKeys(true)
+	if err := j.Parse(text); err != nil {
+		return "", fmt.Errorf("error parsing jsonpath %s: %v", text, err)
+	}
+	data, err := toUnstructured(list)
+	if err != nil {
+		return "", err
+	}
+	buff := &bytes.Buffer{}
+	if err := j.Execute(buff, data); err != nil {
+		return "", fmt.Errorf("error executing jsonpath %s: %v", text, err)
+	}
+	return buff.String(), nil
+}
+
+func toUnstructured(obj interface{}) (interface{}, error) {
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling to json: %v", err)
+	}
+	var data interface{}
+	if err := json.Unmarshal(out, &data); err != nil {
+		return nil, fmt.Errorf("error unmarshalling from json: %v", err)
+	}
+	return data, nil
+}
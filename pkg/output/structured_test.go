@@ -0,0 +1,54 @@
+package output
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvertToStructured(t *testing.T) {
+	items := []struct {
+		Name string `json:"name"`
+	}{{Name: "a"}}
+
+	out, err := ConvertToStructured("TestList", items, "json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, `"apiVersion": "`+APIVersion+`"`) || !strings.Contains(out, `"kind": "TestList"`) || !strings.Contains(out, `"name": "a"`) {
+		t.Errorf("unexpected json output:\n%s", out)
+	}
+
+	out, err = ConvertToStructured("TestList", items, "yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "kind: TestList") || !strings.Contains(out, "- name: a") {
+		t.Errorf("unexpected yaml output:\n%s", out)
+	}
+
+	if _, err := ConvertToStructured("TestList", items, "xml"); err == nil {
+		t.Errorf("expected error for unknown output")
+	}
+}
+
+func TestConvertToStructuredTemplates(t *testing.T) {
+	items := []struct {
+		Name string `json:"name"`
+	}{{Name: "a"}, {Name: "b"}}
+
+	out, err := ConvertToStructured("TestList", items, `go-template={{range .items}}{{.name}} {{end}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "a b " {
+		t.Errorf("unexpected go-template output: %q", out)
+	}
+
+	out, err = ConvertToStructured("TestList", items, `jsonpath={.items[*].name}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out != "a b" {
+		t.Errorf("unexpected jsonpath output: %q", out)
+	}
+}
@@ -53,7 +53,7 @@ func ConvertToTable(t Table) (string, error) {
 		table.AppendBulk(t.Lines)
 		table.Render()
 	default:
-		panic(fmt.Errorf("unknown output: %s", t.Output))
+		return "", fmt.Errorf("unknown output: %s", t.Output)
 	}
 
 	return buff.String(), nil
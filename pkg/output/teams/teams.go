@@ -0,0 +1,142 @@
+package teams
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+)
+
+func init() {
+	output.RegisterExporter("teams", New)
+}
+
+// maxTextLength is the maximum length of the escaped content of a card. Teams rejects messages
+// larger than about 28 KB.
+// See https://docs.microsoft.com/en-us/microsoftteams/limits-specifications-teams#chat
+const maxTextLength = 20000
+
+// Teams implements the output.Exporter interface,
+// it sends messages to a Microsoft Teams incoming webhook
+type Teams struct {
+	Url string
+}
+
+// TeamsMessageCard is a legacy actionable message card, which is supported by incoming webhooks
+// See https://docs.microsoft.com/en-us/outlook/actionable-messages/message-card-reference
+type TeamsMessageCard struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	Summary    string `json:"summary"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+	ThemeColor string `json:"themeColor,omitempty"`
+}
+
+// New prepares Teams configuration, the config key url defaults to the env var KUBECTL_OS_TEAMS_URL
+func New(config output.ExporterConfig) (output.Exporter, error) {
+	t := &Teams{
+		Url: config.Get("url", "KUBECTL_OS_TEAMS_URL"),
+	}
+	if t.Url == "" {
+		return nil, fmt.Errorf("missing Teams url")
+	}
+	return t, nil
+}
+
+// Export sends the message to the webhook, the content is sent preformatted. Content which
+// doesn't fit into one card is sent as multiple cards.
+func (t *Teams) Export(msg output.Message) error {
+	for _, card := range prepareTeamsMessageCards(msg) {
+		err := postMessage(t.Url, card)
+		if err != nil {
+			return fmt.Errorf("error sending message to Teams: %v", err)
+		}
+	}
+	return nil
+}
+
+func prepareTeamsMessageCards(msg output.Message) []*TeamsMessageCard {
+	chunks := splitEscaped(msg.Content, maxTextLength-len("<pre></pre>"))
+	if len(chunks) == 0 {
+		chunks = []string{""}
+	}
+
+	var cards []*TeamsMessageCard
+	for i, chunk := range chunks {
+		title := fmt.Sprintf("%s:", msg.Title)
+		if len(chunks) > 1 {
+			title = fmt.Sprintf("%s (%d/%d):", msg.Title, i+1, len(chunks))
+		}
+		cards = append(cards, &TeamsMessageCard{
+			Type:       "MessageCard",
+			Context:    "https://schema.org/extensions",
+			Summary:    title,
+			Title:      title,
+			Text:       fmt.Sprintf("<pre>%s</pre>", chunk),
+			ThemeColor: "ED1944",
+		})
+	}
+	return cards
+}
+
+// splitEscaped html escapes content and splits it in chunks of at most max bytes, if possible on
+// line breaks. Lines are only cut between runes, so entities and runes are never split.
+func splitEscaped(content string, max int) []string {
+	var chunks []string
+	var chunk strings.Builder
+	flush := func() {
+		if chunk.Len() > 0 {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+		}
+	}
+	for _, line := range strings.SplitAfter(content, "\n") {
+		escaped := html.EscapeString(line)
+		if chunk.Len()+len(escaped) > max {
+			flush()
+		}
+		if len(escaped) <= max {
+			chunk.WriteString(escaped)
+			continue
+		}
+		for _, r := range line {
+			escapedRune := html.EscapeString(string(r))
+			if chunk.Len()+len(escapedRune) > max {
+				flush()
+			}
+			chunk.WriteString(escapedRune)
+		}
+	}
+	flush()
+	return chunks
+}
+
+func postMessage(url string, card *TeamsMessageCard) error {
+	message, err := json.Marshal(card)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package teams
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+)
+
+func Test(t *testing.T) {
+	var received TeamsMessageCard
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("error decoding message: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	s, err := New(output.ExporterConfig{"url": server.URL})
+	if err != nil {
+		t.Fatalf("error creating exporter: %v", err)
+	}
+	err = s.Export(output.Message{Title: "Volumes for tenant", Output: "raw", Content: "1 => <none>\n"})
+	if err != nil {
+		t.Fatalf("error exporting message: %v", err)
+	}
+
+	if received.Type != "MessageCard" || received.Title != "Volumes for tenant:" || received.Text != "<pre>1 =&gt; &lt;none&gt;\n</pre>" {
+		t.Errorf("unexpected message: %+v", received)
+	}
+}
+
+func TestMissingConfig(t *testing.T) {
+	if _, err := New(output.ExporterConfig{"url": ""}); err == nil {
+		t.Errorf("expected error for missing url")
+	}
+}
+
+func TestSplitEscaped(t *testing.T) {
+	chunks := splitEscaped("<a>\n<b>\n", 10)
+	if len(chunks) != 2 || chunks[0] != "&lt;a&gt;\n" || chunks[1] != "&lt;b&gt;\n" {
+		t.Errorf("unexpected chunks: %q", chunks)
+	}
+	chunks = splitEscaped(strings.Repeat("<", 5), 9)
+	if len(chunks) != 3 || chunks[0] != "&lt;&lt;" || chunks[2] != "&lt;" {
+		t.Errorf("unexpected chunks: %q", chunks)
+	}
+
+	cards := prepareTeamsMessageCards(output.Message{Title: "Volumes", Content: strings.Repeat(strings.Repeat("x", 99)+"\n", 500)})
+	if len(cards) != 3 || cards[0].Title != "Volumes (1/3):" {
+		t.Errorf("unexpected cards: %d", len(cards))
+	}
+	for _, card := range cards {
+		if len(card.Text) > maxTextLength {
+			t.Errorf("card %q is too long: %d", card.Title, len(card.Text))
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+)
+
+func init() {
+	output.RegisterExporter("webhook", New)
+}
+
+// SignatureHeader contains the hex encoded HMAC-SHA256 of the body, prefixed with sha256=
+const SignatureHeader = "X-Kubectl-Openstack-Signature-256"
+
+// Webhook implements the output.Exporter interface,
+// it posts a json document or a templated body to an url
+type Webhook struct {
+	Url        string
+	Headers    map[string]string
+	Template   string
+	HMACSecret string
+	Retries    int
+	Backoff    time.Duration
+}
+
+// WebhookPayload is the default body which is sent to the webhook
+type WebhookPayload struct {
+	APIVersion string      `json:"apiVersion"`
+	Command    string      `json:"command"`
+	Title      string      `json:"title"`
+	Contexts   []string    `json:"contexts"`
+	Tenants    []string    `json:"tenants"`
+	Rows       interface{} `json:"rows"`
+	Notes      []string    `json:"notes,omitempty"`
+}
+
+// New prepares webhook configuration. The following config keys are supported, the
+// corresponding env vars are used as default:
+// * url (KUBECTL_OS_WEBHOOK_URL): the url the payload is posted to
+// * header.<name> (KUBECTL_OS_WEBHOOK_HEADERS as comma-separated <name>=<value>): additional headers
+// * template (KUBECTL_OS_WEBHOOK_TEMPLATE): go template which is evaluated against the payload to create the body
+// * template-file (KUBECTL_OS_WEBHOOK_TEMPLATE_FILE): file containing the go template
+// * hmac-secret (KUBECTL_OS_WEBHOOK_HMAC_SECRET): if set the body is signed via the SignatureHeader
+// * retries (KUBECTL_OS_WEBHOOK_RETRIES): how often a failed delivery is retried, default 3
+// * backoff (KUBECTL_OS_WEBHOOK_BACKOFF): the wait time before the first retry which is doubled on every retry, default 1s
+func New(config output.ExporterConfig) (output.Exporter, error) {
+	w := &Webhook{
+		Url:        config.Get("url", "KUBECTL_OS_WEBHOOK_URL"),
+		Headers:    map[string]string{},
+		Template:   config.Get("template", "KUBECTL_OS_WEBHOOK_TEMPLATE"),
+		HMACSecret: config.Get("hmac-secret", "KUBECTL_OS_WEBHOOK_HMAC_SECRET"),
+		Retries:    3,
+		Backoff:    time.Second,
+	}
+	if w.Url == "" {
+		return nil, fmt.Errorf("missing webhook url")
+	}
+
+	if headers := os.Getenv("KUBECTL_OS_WEBHOOK_HEADERS"); headers != "" {
+		for _, header := range strings.Split(headers, ",") {
+			kv := strings.SplitN(header, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("invalid header %q, expected <name>=<value>", header)
+			}
+			w.Headers[kv[0]] = kv[1]
+		}
+	}
+	for key, value := range config {
+		if strings.HasPrefix(key, "header.") {
+			w.Headers[strings.TrimPrefix(key, "header.")] = value
+		}
+	}
+
+	if templateFile := config.Get("template-file", "KUBECTL_OS_WEBHOOK_TEMPLATE_FILE"); templateFile != "" {
+		content, err := ioutil.ReadFile(templateFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading template file %s: %v", templateFile, err)
+		}
+		w.Template = string(content)
+	}
+
+	if retries := config.Get("retries", "KUBECTL_OS_WEBHOOK_RETRIES"); retries != "" {
+		var err error
+		w.Retries, err = strconv.Atoi(retries)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing retries %q: %v", retries, err)
+		}
+	}
+	if backoff := config.Get("backoff", "KUBECTL_OS_WEBHOOK_BACKOFF"); backoff != "" {
+		var err error
+		w.Backoff, err = time.ParseDuration(backoff)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing backoff %q: %v", backoff, err)
+		}
+	}
+	return w, nil
+}
+
+// Export posts the payload created from the message to the webhook
+func (w *Webhook) Export(msg output.Message) error {
+	payload := &WebhookPayload{
+		APIVersion: output.APIVersion,
+		Command:    msg.Command,
+		Title:      msg.Title,
+		Contexts:   msg.Contexts,
+		Tenants:    msg.TenantIDs,
+		Rows:       msg.Records,
+		Notes:      msg.Notes,
+	}
+
+	body, contentType, err := w.createBody(payload)
+	if err != nil {
+		return fmt.Errorf("error creating webhook body: %v", err)
+	}
+
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body, contentType)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.Retries {
+			return fmt.Errorf("error sending message to webhook after %d attempt(s): %v", attempt+1, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) createBody(payload *WebhookPayload) ([]byte, string, error) {
+	if w.Template != "" {
+		body, err := output.ExecuteGoTemplate(payload, w.Template)
+		if err != nil {
+			return nil, "", err
+		}
+		return []byte(body), "text/plain", nil
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, "application/json", nil
+}
+
+// post sends the body once, it returns if a failed request should be retried
+func (w *Webhook) post(body []byte, contentType string) (bool, error) {
+	req, err := http.NewRequest("POST", w.Url, bytes.NewBuffer(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Add("Content-Type", contentType)
+	for name, value := range w.Headers {
+		req.Header.Set(name, value)
+	}
+	if w.HMACSecret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+sign(body, w.HMACSecret))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+func sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
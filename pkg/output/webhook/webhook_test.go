@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sbueringer/kubectl-openstack-plugin/pkg/output"
+)
+
+var msg = output.Message{
+	Command:   "volumes",
+	Title:     "Volumes for tenant",
+	Contexts:  []string{"tenant-admin"},
+	TenantIDs: []string{"tenant"},
+	Records:   []map[string]string{{"cluster": "tenant-admin"}},
+	Notes:     []string{"tenant-admin/disk: multiple attachments"},
+}
+
+func Test(t *testing.T) {
+	var received WebhookPayload
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("error decoding payload: %v", err)
+		}
+		if r.Header.Get(SignatureHeader) != "sha256="+sign(body, "secret") {
+			t.Errorf("unexpected signature %q", r.Header.Get(SignatureHeader))
+		}
+	}))
+	defer server.Close()
+
+	w, err := New(output.ExporterConfig{"url": server.URL, "header.Authorization": "Bearer token", "hmac-secret": "secret"})
+	if err != nil {
+		t.Fatalf("error creating exporter: %v", err)
+	}
+	if err := w.Export(msg); err != nil {
+		t.Fatalf("error exporting message: %v", err)
+	}
+
+	if header.Get("Authorization") != "Bearer token" {
+		t.Errorf("expected Authorization header, got %v", header)
+	}
+	if received.Command != "volumes" || received.Contexts[0] != "tenant-admin" || received.Tenants[0] != "tenant" || len(received.Notes) != 1 {
+		t.Errorf("unexpected payload: %+v", received)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+
+	w, err := New(output.ExporterConfig{"url": server.URL, "template": `{{.command}}: {{range .notes}}{{.}}{{end}}`})
+	if err != nil {
+		t.Fatalf("error creating exporter: %v", err)
+	}
+	if err := w.Export(msg); err != nil {
+		t.Fatalf("error exporting message: %v", err)
+	}
+	if body != "volumes: tenant-admin/disk: multiple attachments" {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	w, err := New(output.ExporterConfig{"url": server.URL, "retries": "2", "backoff": "1ms"})
+	if err != nil {
+		t.Fatalf("error creating exporter: %v", err)
+	}
+	if err := w.Export(msg); err != nil {
+		t.Fatalf("error exporting message: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+
+	requests = -10
+	if err := w.Export(msg); err == nil {
+		t.Errorf("expected error after all retries failed")
+	}
+	if requests != -7 {
+		t.Errorf("expected 3 requests, got %d", requests+10)
+	}
+}
@@ -0,0 +1,36 @@
+package parallel
+
+import "sync"
+
+// Run calls all fns with at most workers concurrent calls and waits until all of them are done.
+// The first error is returned.
+func Run(workers int, fns ...func() error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	var lock sync.Mutex
+	var firstErr error
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, fn := range fns {
+		fn := fn
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := fn(); err != nil {
+				lock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
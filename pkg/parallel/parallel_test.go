@@ -0,0 +1,43 @@
+package parallel
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	var running, maxRunning, calls int32
+	var fns []func() error
+	for i := 0; i < 10; i++ {
+		i := i
+		fns = append(fns, func() error {
+			atomic.AddInt32(&calls, 1)
+			current := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			if i == 5 {
+				return fmt.Errorf("error %d", i)
+			}
+			return nil
+		})
+	}
+
+	err := Run(3, fns...)
+	if err == nil || err.Error() != "error 5" {
+		t.Errorf("expected error 5, got %v", err)
+	}
+	if calls != 10 {
+		t.Errorf("expected 10 calls, got %d", calls)
+	}
+	if maxRunning > 3 {
+		t.Errorf("expected at most 3 concurrent calls, got %d", maxRunning)
+	}
+}
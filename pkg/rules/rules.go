@@ -0,0 +1,123 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity is the severity of a finding
+type Severity string
+
+const (
+	// Info findings are worth a look but don't need action, e.g. orphaned volumes
+	Info Severity = "info"
+	// Warning findings are inconsistencies which don't affect running workloads yet
+	Warning Severity = "warning"
+	// Critical findings are inconsistencies which break or will break workloads
+	Critical Severity = "critical"
+)
+
+// severities are ordered from the least to the most severe
+var severities = []Severity{Info, Warning, Critical}
+
+// ParseSeverity parses info, warning or critical
+func ParseSeverity(s string) (Severity, error) {
+	for _, severity := range severities {
+		if string(severity) == s {
+			return severity, nil
+		}
+	}
+	return "", fmt.Errorf("unknown severity %q, available severities are: info, warning, critical", s)
+}
+
+// AtLeast returns true if s is as severe as or more severe than other
+func (s Severity) AtLeast(other Severity) bool {
+	return s.rank() >= other.rank()
+}
+
+func (s Severity) rank() int {
+	for i, severity := range severities {
+		if severity == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Rule is a named consistency check of a kind of record, e.g. of volumes or server
+type Rule struct {
+	ID          string   `json:"id"`
+	Kind        string   `json:"kind"`
+	Severity    Severity `json:"severity"`
+	Description string   `json:"description"`
+}
+
+// Finding is a violation of a rule by a record
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Selection are the enabled rules. A nil Selection enables all rules.
+type Selection struct {
+	enabled map[string]bool
+}
+
+// Select returns a selection of the rules in ids or, if ids is empty, of all rules. The rules
+// in disabled are removed from the selection. Unknown rule ids are an error.
+func Select(rules []Rule, ids, disabled []string) (*Selection, error) {
+	known := map[string]bool{}
+	for _, r := range rules {
+		known[r.ID] = true
+	}
+	for _, id := range append(append([]string{}, ids...), disabled...) {
+		if !known[id] {
+			return nil, fmt.Errorf("unknown rule %q, available rules are: %s", id, strings.Join(IDs(rules), ", "))
+		}
+	}
+
+	s := &Selection{enabled: map[string]bool{}}
+	if len(ids) == 0 {
+		ids = IDs(rules)
+	}
+	for _, id := range ids {
+		s.enabled[id] = true
+	}
+	for _, id := range disabled {
+		delete(s.enabled, id)
+	}
+	return s, nil
+}
+
+// Enabled returns true if the rule with the id is enabled
+func (s *Selection) Enabled(id string) bool {
+	if s == nil {
+		return true
+	}
+	return s.enabled[id]
+}
+
+// IDs returns the sorted and unique ids of the rules, rules of different kinds can share an id
+func IDs(rules []Rule) []string {
+	seen := map[string]bool{}
+	var ids []string
+	for _, r := range rules {
+		if !seen[r.ID] {
+			seen[r.ID] = true
+			ids = append(ids, r.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Messages returns the messages of the findings
+func Messages(findings []Finding) []string {
+	var messages []string
+	for _, f := range findings {
+		messages = append(messages, f.Message)
+	}
+	return messages
+}
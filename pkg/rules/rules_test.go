@@ -0,0 +1,71 @@
+package rules
+
+import (
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	rules := []Rule{
+		{ID: "multi-attach", Kind: "Volume"},
+		{ID: "multi-attach", Kind: "Server"},
+		{ID: "orphan", Kind: "Volume"},
+		{ID: "in-use-detached", Kind: "Volume"},
+	}
+
+	tests := []struct {
+		name     string
+		ids      []string
+		disabled []string
+		enabled  []string
+		err      bool
+	}{
+		{name: "all rules", enabled: []string{"multi-attach", "orphan", "in-use-detached"}},
+		{name: "selected rules", ids: []string{"multi-attach", "orphan"}, enabled: []string{"multi-attach", "orphan"}},
+		{name: "disabled rules", disabled: []string{"orphan"}, enabled: []string{"multi-attach", "in-use-detached"}},
+		{name: "unknown rule", ids: []string{"foo"}, err: true},
+		{name: "unknown disabled rule", disabled: []string{"foo"}, err: true},
+	}
+	for _, tt := range tests {
+		s, err := Select(rules, tt.ids, tt.disabled)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var enabled []string
+		for _, id := range IDs(rules) {
+			if s.Enabled(id) {
+				enabled = append(enabled, id)
+			}
+		}
+		if len(enabled) != len(tt.enabled) {
+			t.Errorf("%s: expected enabled rules %v, got %v", tt.name, tt.enabled, enabled)
+			continue
+		}
+		for _, id := range tt.enabled {
+			if !s.Enabled(id) {
+				t.Errorf("%s: expected rule %s to be enabled", tt.name, id)
+			}
+		}
+	}
+
+	var s *Selection
+	if !s.Enabled("orphan") {
+		t.Errorf("expected all rules to be enabled in a nil selection")
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	severity, err := ParseSeverity("warning")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !Critical.AtLeast(severity) || !Warning.AtLeast(severity) || Info.AtLeast(severity) {
+		t.Errorf("unexpected order of severities")
+	}
+	if _, err := ParseSeverity("error"); err == nil {
+		t.Errorf("expected error for unknown severity")
+	}
+}